@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+const STOP_REASON = "video was cancelled"
+
+type Config struct {
+	config.AWS
+	Metrics     metrics.LambdaConfig
+	AccessToken string `env:"CANCEL_VIDEO_ACCESS_TOKEN" required:"true"`
+	Launcher    task.LauncherConfig
+}
+
+type RequestBody struct {
+	VideoKey    string `json:"video_key"`
+	AccessToken string `json:"access_token"`
+}
+
+type Response struct {
+	Video video.Video `json:"video"`
+}
+
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+type App struct {
+	token    string
+	videos   video.VideoRepository
+	launcher task.Launcher
+}
+
+func main() {
+	logging.Setup("cancel-video-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("cancel-video-lambda", cfg.Metrics.Config())
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	launcher, err := task.NewLauncher(sess, cfg.Launcher)
+	if err != nil {
+		logging.Fatal("invalid launcher configuration", err)
+	}
+
+	dynamoClient := dynamodb.New(sess)
+
+	app := App{
+		token:    cfg.AccessToken,
+		videos:   video.NewDynamoRepository(dynamoClient),
+		launcher: launcher,
+	}
+
+	lambda.Start(metrics.CountRequests(app.HandleRequest))
+}
+
+func (app *App) HandleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	logger := logging.FromLambda(ctx)
+
+	var reqBody RequestBody
+	err := json.Unmarshal([]byte(request.Body), &reqBody)
+	if err != nil {
+		logger.Error("failed to unmarshal request body", logging.ERROR, err)
+		return nil, err
+	}
+
+	if reqBody.AccessToken == "" {
+		errResp, err := generateErrorResponse("access token is missing", 400)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	if reqBody.AccessToken != app.token {
+		errResp, err := generateErrorResponse("invalid access token", 401)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	if reqBody.VideoKey == "" {
+		errResp, err := generateErrorResponse("video key is missing", 400)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	logger = logger.With(logging.VIDEO_KEY, reqBody.VideoKey)
+
+	v, err := app.videos.Get(reqBody.VideoKey)
+	if err == video.ErrNotFound {
+		errResp, err := generateErrorResponse("video not found", 404)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+	if err != nil {
+		logger.Error("failed to get video from dynamodb", logging.ERROR, err)
+		return nil, err
+	}
+
+	// A queued job is dropped by the dispatcher once it sees the video is
+	// cancelled, and a running transcoder stops at its next check
+	err = app.videos.Update(reqBody.VideoKey, video.Update{Status: video.STATUS_CANCELLED})
+	if err == video.ErrInvalidTransition {
+		// Read it again, the status may have changed since the Get
+		if current, err := app.videos.Get(reqBody.VideoKey); err == nil {
+			v = current
+		}
+
+		errResp, err := generateErrorResponse(fmt.Sprintf("video is already %s", v.Status), 409)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+	if err != nil {
+		logger.Error("failed to cancel video", logging.ERROR, err)
+		return nil, err
+	}
+
+	v.Status = video.STATUS_CANCELLED
+	logger.Info("cancelled video", logging.JOB_ID, v.JobID)
+
+	if v.TaskArn != "" {
+		if err := app.stopTask(logger, v.TaskArn); err != nil {
+			// The video is cancelled either way, the transcoder notices it
+			// at its next check and removes what it uploaded
+			logger.Error("failed to stop task", logging.TASK_ID, v.TaskArn, logging.ERROR, err)
+		}
+	}
+
+	resp, err := json.Marshal(Response{Video: *v})
+	if err != nil {
+		logger.Error("failed to marshal response", logging.ERROR, err)
+		return nil, err
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(resp),
+	}, nil
+}
+
+// stopTask stops the transcoding task if it is still running. Tasks of the
+// queue workers are left alone, since the worker moves on to its next job
+// once it notices the cancellation.
+func (app *App) stopTask(logger *slog.Logger, taskArn string) error {
+	status, err := app.launcher.Describe(taskArn)
+	if err == task.ErrTaskNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if status.Stopped || !status.Launched {
+		return nil
+	}
+
+	if err := app.launcher.Stop(taskArn, STOP_REASON); err != nil {
+		return err
+	}
+
+	logger.Info("stopped task", logging.TASK_ID, taskArn)
+	return nil
+}
+
+func generateErrorResponse(msg string, status int) (*events.APIGatewayProxyResponse, error) {
+	errMsg := ErrorResponse{Message: msg}
+	body, err := json.Marshal(errMsg)
+	if err != nil {
+		slog.Error("failed to marshal error response", logging.ERROR, err)
+		return nil, err
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Body:       string(body),
+	}, nil
+}
@@ -1,15 +1,13 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-)
-
-const (
-	REGION = "ap-south-1"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
 )
 
 type VideoItem struct {
@@ -17,22 +15,50 @@ type VideoItem struct {
 	UploadedAt string
 }
 
+var statusIndex = &dynamodb.GlobalSecondaryIndex{
+	IndexName: aws.String(video.STATUS_INDEX_NAME),
+	KeySchema: []*dynamodb.KeySchemaElement{
+		{
+			AttributeName: aws.String("Status"),
+			KeyType:       aws.String("HASH"),
+		},
+	},
+	Projection: &dynamodb.Projection{
+		ProjectionType: aws.String("ALL"),
+	},
+	ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(5),
+		WriteCapacityUnits: aws.Int64(5),
+	},
+}
+
+// The stream carries the videos removed by the TTL to the
+// expired-videos-lambda, which purges their objects, and the status changes
+// of the videos to the webhook-lambda, which needs both images
+var stream = &dynamodb.StreamSpecification{
+	StreamEnabled:  aws.Bool(true),
+	StreamViewType: aws.String(dynamodb.StreamViewTypeNewAndOldImages),
+}
+
 func main() {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(REGION),
-	})
+	logging.Setup("create-video-table")
+
+	var cfg config.AWS
+	config.MustLoad(&cfg)
+
+	sess, err := cfg.Session()
 	if err != nil {
-		log.Fatalf("failed to create AWS session, %v", err)
+		logging.Fatal("failed to create AWS session", err)
 	}
 
 	dynamoClient := dynamodb.New(sess)
 
-	_, err = dynamoClient.DescribeTable(&dynamodb.DescribeTableInput{
-		TableName: aws.String("Videos"),
+	output, err := dynamoClient.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(video.TABLE_NAME),
 	})
 	if err != nil {
 		_, err = dynamoClient.CreateTable(&dynamodb.CreateTableInput{
-			TableName: aws.String("Videos"),
+			TableName: aws.String(video.TABLE_NAME),
 			KeySchema: []*dynamodb.KeySchemaElement{
 				{
 					AttributeName: aws.String("Key"),
@@ -44,17 +70,188 @@ func main() {
 					AttributeName: aws.String("Key"),
 					AttributeType: aws.String("S"),
 				},
+				{
+					AttributeName: aws.String("Status"),
+					AttributeType: aws.String("S"),
+				},
 			},
+			GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{statusIndex},
+			StreamSpecification:    stream,
 			ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
 				ReadCapacityUnits:  aws.Int64(10),
 				WriteCapacityUnits: aws.Int64(10),
 			},
 		})
 		if err != nil {
-			log.Fatalf("failed to create table, %v", err)
+			logging.Fatal("failed to create table", err)
 		}
-		log.Println("table created successfully")
+		slog.Info("table created successfully")
 	} else {
-		log.Println("table already exists")
+		slog.Info("table already exists")
+
+		// Tables created before the status index was introduced
+		if !hasIndex(output.Table, video.STATUS_INDEX_NAME) {
+			_, err = dynamoClient.UpdateTable(&dynamodb.UpdateTableInput{
+				TableName: aws.String(video.TABLE_NAME),
+				AttributeDefinitions: []*dynamodb.AttributeDefinition{
+					{
+						AttributeName: aws.String("Status"),
+						AttributeType: aws.String("S"),
+					},
+				},
+				GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{
+					{
+						Create: &dynamodb.CreateGlobalSecondaryIndexAction{
+							IndexName:             statusIndex.IndexName,
+							KeySchema:             statusIndex.KeySchema,
+							Projection:            statusIndex.Projection,
+							ProvisionedThroughput: statusIndex.ProvisionedThroughput,
+						},
+					},
+				},
+			})
+			if err != nil {
+				logging.Fatal("failed to create status index", err)
+			}
+			slog.Info("status index created successfully")
+		}
+
+		// The view type of a stream can't be changed, the stream of tables
+		// created before webhooks has to be replaced
+		spec := output.Table.StreamSpecification
+		if spec != nil && aws.BoolValue(spec.StreamEnabled) && aws.StringValue(spec.StreamViewType) != aws.StringValue(stream.StreamViewType) {
+			_, err = dynamoClient.UpdateTable(&dynamodb.UpdateTableInput{
+				TableName:           aws.String(video.TABLE_NAME),
+				StreamSpecification: &dynamodb.StreamSpecification{StreamEnabled: aws.Bool(false)},
+			})
+			if err != nil {
+				logging.Fatal("failed to disable the table stream", err)
+			}
+
+			err = dynamoClient.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+				TableName: aws.String(video.TABLE_NAME),
+			})
+			if err != nil {
+				logging.Fatal("failed to wait for the table", err)
+			}
+
+			spec = nil
+			slog.Info("table stream disabled, point the event source mappings of the stream at the new one")
+		}
+
+		// Tables created before videos expired
+		if spec == nil || !aws.BoolValue(spec.StreamEnabled) {
+			_, err = dynamoClient.UpdateTable(&dynamodb.UpdateTableInput{
+				TableName:           aws.String(video.TABLE_NAME),
+				StreamSpecification: stream,
+			})
+			if err != nil {
+				logging.Fatal("failed to enable the table stream", err)
+			}
+			slog.Info("table stream enabled successfully")
+		}
 	}
+
+	// The TTL can only be set once the table exists
+	err = dynamoClient.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+		TableName: aws.String(video.TABLE_NAME),
+	})
+	if err != nil {
+		logging.Fatal("failed to wait for the table", err)
+	}
+
+	ttl, err := dynamoClient.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(video.TABLE_NAME),
+	})
+	if err != nil {
+		logging.Fatal("failed to describe time to live", err)
+	}
+
+	if aws.StringValue(ttl.TimeToLiveDescription.TimeToLiveStatus) == dynamodb.TimeToLiveStatusDisabled {
+		_, err = dynamoClient.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
+			TableName: aws.String(video.TABLE_NAME),
+			TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+				AttributeName: aws.String(video.TTL_ATTRIBUTE_NAME),
+				Enabled:       aws.Bool(true),
+			},
+		})
+		if err != nil {
+			logging.Fatal("failed to enable time to live", err)
+		}
+		slog.Info("time to live enabled successfully")
+	}
+
+	_, err = dynamoClient.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(video.DEAD_LETTER_TABLE_NAME),
+	})
+	if err != nil {
+		_, err = dynamoClient.CreateTable(&dynamodb.CreateTableInput{
+			TableName: aws.String(video.DEAD_LETTER_TABLE_NAME),
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("Key"),
+					KeyType:       aws.String("HASH"),
+				},
+			},
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("Key"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			BillingMode: aws.String("PAY_PER_REQUEST"),
+		})
+		if err != nil {
+			logging.Fatal("failed to create dead letter table", err)
+		}
+		slog.Info("dead letter table created successfully")
+	} else {
+		slog.Info("dead letter table already exists")
+	}
+
+	_, err = dynamoClient.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(video.AUDIT_TABLE_NAME),
+	})
+	if err != nil {
+		_, err = dynamoClient.CreateTable(&dynamodb.CreateTableInput{
+			TableName: aws.String(video.AUDIT_TABLE_NAME),
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("Key"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("At"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("Key"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("At"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			BillingMode: aws.String("PAY_PER_REQUEST"),
+		})
+		if err != nil {
+			logging.Fatal("failed to create audit table", err)
+		}
+		slog.Info("audit table created successfully")
+	} else {
+		slog.Info("audit table already exists")
+	}
+}
+
+func hasIndex(table *dynamodb.TableDescription, name string) bool {
+	for _, index := range table.GlobalSecondaryIndexes {
+		if aws.StringValue(index.IndexName) == name {
+			return true
+		}
+	}
+
+	return false
 }
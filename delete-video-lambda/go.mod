@@ -0,0 +1,20 @@
+module github.com/thegeorgenikhil/video-transcoding-service/delete-video-lambda
+
+go 1.21.6
+
+require (
+	github.com/aws/aws-lambda-go v1.46.0
+	github.com/aws/aws-sdk-go v1.51.2
+	github.com/thegeorgenikhil/video-transcoding-service/internal v0.0.0
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	go.opentelemetry.io/otel v1.24.0 // indirect
+	go.opentelemetry.io/otel/trace v1.24.0 // indirect
+)
+
+replace github.com/thegeorgenikhil/video-transcoding-service/internal => ../internal
+
+replace github.com/thegeorgenikhil/video-transcoding-service/videoevents => ../videoevents
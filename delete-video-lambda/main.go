@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/cleanup"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// Actor recorded when API Gateway didn't authenticate the caller, who only
+// had the shared access token
+const DEFAULT_ACTOR = "api"
+
+type Config struct {
+	config.AWS
+	Metrics     metrics.LambdaConfig
+	AccessToken string `env:"DELETE_VIDEO_ACCESS_TOKEN" required:"true"`
+
+	// How long a deleted video can be restored for
+	GracePeriod time.Duration `env:"DELETE_GRACE_PERIOD_HOURS" default:"168" unit:"hours" min:"0"`
+
+	Buckets cleanup.Buckets
+}
+
+type RequestBody struct {
+	VideoKey    string `json:"video_key"`
+	AccessToken string `json:"access_token"`
+
+	// Permanent removes the video and its objects right away, Restore undoes
+	// an earlier delete while its grace period hasn't run out
+	Permanent bool `json:"permanent"`
+	Restore   bool `json:"restore"`
+
+	// Who asked for the change, kept in the audit record as a note. The
+	// actor of the record is the caller authenticated by API Gateway.
+	RequestedBy string `json:"requested_by"`
+}
+
+type Response struct {
+	Video   *video.Video `json:"video,omitempty"`
+	Purged  []string     `json:"purged,omitempty"`
+	Message string       `json:"message,omitempty"`
+}
+
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+type App struct {
+	token       string
+	videos      video.VideoRepository
+	audit       video.AuditRepository
+	purger      *cleanup.Purger
+	gracePeriod time.Duration
+}
+
+func main() {
+	logging.Setup("delete-video-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("delete-video-lambda", cfg.Metrics.Config())
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	dynamoClient := dynamodb.New(sess)
+	videos := video.NewDynamoRepository(dynamoClient)
+
+	app := App{
+		token:  cfg.AccessToken,
+		videos: videos,
+		audit:  video.NewDynamoAuditRepository(dynamoClient),
+		purger: &cleanup.Purger{
+			S3:      s3.New(sess),
+			Videos:  videos,
+			Buckets: cfg.Buckets,
+		},
+		gracePeriod: cfg.GracePeriod,
+	}
+
+	lambda.Start(metrics.CountRequests(app.HandleRequest))
+}
+
+func (app *App) HandleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	logger := logging.FromLambda(ctx)
+
+	var reqBody RequestBody
+	err := json.Unmarshal([]byte(request.Body), &reqBody)
+	if err != nil {
+		logger.Error("failed to unmarshal request body", logging.ERROR, err)
+		return nil, err
+	}
+
+	if reqBody.AccessToken == "" {
+		errResp, err := generateErrorResponse("access token is missing", 400)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	if reqBody.AccessToken != app.token {
+		errResp, err := generateErrorResponse("invalid access token", 401)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	if reqBody.VideoKey == "" {
+		errResp, err := generateErrorResponse("video key is missing", 400)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	if reqBody.Permanent && reqBody.Restore {
+		errResp, err := generateErrorResponse("permanent and restore can't be used together", 400)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	logger = logger.With(logging.VIDEO_KEY, reqBody.VideoKey)
+
+	v, err := app.videos.Get(reqBody.VideoKey)
+	if err == video.ErrNotFound {
+		errResp, err := generateErrorResponse("video not found", 404)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+	if err != nil {
+		logger.Error("failed to get video from dynamodb", logging.ERROR, err)
+		return nil, err
+	}
+
+	record := video.AuditRecord{
+		Key:         v.Key,
+		At:          time.Now().Format(time.RFC3339Nano),
+		Actor:       actor(request.RequestContext),
+		RequestedBy: reqBody.RequestedBy,
+		SourceIP:    request.RequestContext.Identity.SourceIP,
+		RequestID:   request.RequestContext.RequestID,
+		Status:      v.Status,
+	}
+
+	if reqBody.Restore {
+		return app.restore(logger, v, record)
+	}
+
+	// Videos still being worked on have to be cancelled first, or the
+	// transcoder would upload outputs for a video that is gone
+	if v.Status != video.STATUS_DELETED {
+		now := time.Now()
+
+		err = app.videos.Update(v.Key, video.Update{
+			Status:      video.STATUS_DELETED,
+			DeletedAt:   now.Format(time.RFC3339),
+			PurgeAfter:  now.Add(app.gracePeriod).Format(time.RFC3339),
+			DeletedFrom: v.Status,
+		})
+		if err == video.ErrInvalidTransition {
+			errResp, err := generateErrorResponse(fmt.Sprintf("video is %s, cancel it before deleting it", v.Status), 409)
+			if err != nil {
+				logger.Error("failed to generate error response", logging.ERROR, err)
+				return nil, err
+			}
+
+			return errResp, nil
+		}
+		if err != nil {
+			logger.Error("failed to delete video", logging.ERROR, err)
+			return nil, err
+		}
+
+		record.Action = video.AUDIT_ACTION_DELETE
+		if err := app.audit.Put(record); err != nil {
+			logger.Error("failed to write audit record", logging.ERROR, err)
+			return nil, err
+		}
+
+		logger.Info("deleted video", "actor", record.Actor)
+	}
+
+	if !reqBody.Permanent {
+		v, err = app.videos.Get(v.Key)
+		if err != nil {
+			logger.Error("failed to get video from dynamodb", logging.ERROR, err)
+			return nil, err
+		}
+
+		return generateResponse(Response{Video: v}, 200)
+	}
+
+	purged, err := app.purger.Purge(*v)
+	if err != nil {
+		// The video stays deleted, the next purge run picks it up again
+		logger.Error("failed to purge video", logging.ERROR, err)
+		return nil, err
+	}
+
+	record.Action = video.AUDIT_ACTION_PURGE
+	record.At = time.Now().Format(time.RFC3339Nano)
+	record.Status = video.STATUS_DELETED
+	record.Objects = purged
+	if err := app.audit.Put(record); err != nil {
+		logger.Error("failed to write audit record", logging.ERROR, err)
+		return nil, err
+	}
+
+	logger.Info("purged video", "actor", record.Actor, "objects", len(purged))
+
+	return generateResponse(Response{Purged: purged, Message: "video purged"}, 200)
+}
+
+// restore moves a deleted video back to the status it was deleted from.
+func (app *App) restore(logger *slog.Logger, v *video.Video, record video.AuditRecord) (*events.APIGatewayProxyResponse, error) {
+	if v.Status != video.STATUS_DELETED || v.DeletedFrom == "" {
+		errResp, err := generateErrorResponse(fmt.Sprintf("video is %s, only deleted videos can be restored", v.Status), 409)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	err := app.videos.Update(v.Key, video.Update{Status: v.DeletedFrom, Undelete: true})
+	if err == video.ErrInvalidTransition || err == video.ErrNotFound {
+		// Purged or restored since the Get
+		errResp, err := generateErrorResponse("video can no longer be restored", 409)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+	if err != nil {
+		logger.Error("failed to restore video", logging.ERROR, err)
+		return nil, err
+	}
+
+	record.Action = video.AUDIT_ACTION_RESTORE
+	if err := app.audit.Put(record); err != nil {
+		logger.Error("failed to write audit record", logging.ERROR, err)
+		return nil, err
+	}
+
+	logger.Info("restored video", "actor", record.Actor, "status", v.DeletedFrom)
+
+	v, err = app.videos.Get(v.Key)
+	if err != nil {
+		logger.Error("failed to get video from dynamodb", logging.ERROR, err)
+		return nil, err
+	}
+
+	return generateResponse(Response{Video: v}, 200)
+}
+
+// actor returns the caller API Gateway authenticated: the principal of a
+// Lambda authorizer, the subject of the claims of a Cognito or JWT
+// authorizer, or the IAM caller. DEFAULT_ACTOR is returned when none of
+// them is set.
+func actor(rc events.APIGatewayProxyRequestContext) string {
+	if principal, ok := rc.Authorizer["principalId"].(string); ok && principal != "" {
+		return principal
+	}
+
+	if claims, ok := rc.Authorizer["claims"].(map[string]interface{}); ok {
+		if sub, ok := claims["sub"].(string); ok && sub != "" {
+			return sub
+		}
+	}
+
+	if rc.Identity.UserArn != "" {
+		return rc.Identity.UserArn
+	}
+
+	return DEFAULT_ACTOR
+}
+
+func generateResponse(body Response, status int) (*events.APIGatewayProxyResponse, error) {
+	resp, err := json.Marshal(body)
+	if err != nil {
+		slog.Error("failed to marshal response", logging.ERROR, err)
+		return nil, err
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Body:       string(resp),
+	}, nil
+}
+
+func generateErrorResponse(msg string, status int) (*events.APIGatewayProxyResponse, error) {
+	errMsg := ErrorResponse{Message: msg}
+	body, err := json.Marshal(errMsg)
+	if err != nil {
+		slog.Error("failed to marshal error response", logging.ERROR, err)
+		return nil, err
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Body:       string(body),
+	}, nil
+}
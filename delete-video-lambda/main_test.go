@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+const testKey = "id/source/video.mp4"
+
+func newTestApp(status video.Status) (*App, *video.MemoryRepository, *video.MemoryAuditRepository) {
+	videos := video.NewMemoryRepository()
+	videos.Put(video.Video{Key: testKey, Status: status})
+
+	audit := &video.MemoryAuditRepository{}
+
+	return &App{token: "token", videos: videos, audit: audit}, videos, audit
+}
+
+func request(body RequestBody, rc events.APIGatewayProxyRequestContext) events.APIGatewayProxyRequest {
+	body.AccessToken = "token"
+	raw, _ := json.Marshal(body)
+
+	return events.APIGatewayProxyRequest{Body: string(raw), RequestContext: rc}
+}
+
+func TestDeleteRecordsTheAuthenticatedCaller(t *testing.T) {
+	tests := []struct {
+		name  string
+		rc    events.APIGatewayProxyRequestContext
+		actor string
+	}{
+		{
+			name:  "lambda authorizer",
+			rc:    events.APIGatewayProxyRequestContext{Authorizer: map[string]interface{}{"principalId": "user-1"}},
+			actor: "user-1",
+		},
+		{
+			name:  "cognito authorizer",
+			rc:    events.APIGatewayProxyRequestContext{Authorizer: map[string]interface{}{"claims": map[string]interface{}{"sub": "user-2"}}},
+			actor: "user-2",
+		},
+		{
+			name:  "iam",
+			rc:    events.APIGatewayProxyRequestContext{Identity: events.APIGatewayRequestIdentity{UserArn: "arn:aws:iam::123456789012:user/ops"}},
+			actor: "arn:aws:iam::123456789012:user/ops",
+		},
+		{
+			name:  "access token only",
+			actor: DEFAULT_ACTOR,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, videos, audit := newTestApp(video.STATUS_COMPLETED)
+
+			resp, err := app.HandleRequest(context.Background(), request(RequestBody{VideoKey: testKey, RequestedBy: "someone else"}, tt.rc))
+			if err != nil || resp.StatusCode != 200 {
+				t.Fatalf("HandleRequest() = %+v, %v", resp, err)
+			}
+
+			if v, _ := videos.Get(testKey); v.Status != video.STATUS_DELETED || v.DeletedFrom != video.STATUS_COMPLETED {
+				t.Errorf("video is %s, deleted from %s", v.Status, v.DeletedFrom)
+			}
+
+			records, _ := audit.List(testKey)
+			if len(records) != 1 {
+				t.Fatalf("audit records = %+v, want the delete", records)
+			}
+			if r := records[0]; r.Action != video.AUDIT_ACTION_DELETE || r.Actor != tt.actor || r.RequestedBy != "someone else" {
+				t.Errorf("audit record = %+v, want a delete by %s requested by someone else", r, tt.actor)
+			}
+		})
+	}
+}
+
+func TestDeleteRefusesVideosBeingTranscoded(t *testing.T) {
+	app, videos, audit := newTestApp(video.STATUS_PROCESSING)
+
+	resp, err := app.HandleRequest(context.Background(), request(RequestBody{VideoKey: testKey}, events.APIGatewayProxyRequestContext{}))
+	if err != nil || resp.StatusCode != 409 {
+		t.Fatalf("HandleRequest() = %+v, %v, want a 409", resp, err)
+	}
+
+	if v, _ := videos.Get(testKey); v.Status != video.STATUS_PROCESSING {
+		t.Errorf("video is %s, want it left processing", v.Status)
+	}
+	if records, _ := audit.List(testKey); len(records) != 0 {
+		t.Errorf("audit records = %+v for a refused delete", records)
+	}
+}
+
+func TestRestoreMovesTheVideoBack(t *testing.T) {
+	app, videos, audit := newTestApp(video.STATUS_FAILED)
+	rc := events.APIGatewayProxyRequestContext{Authorizer: map[string]interface{}{"principalId": "user-1"}}
+
+	for _, body := range []RequestBody{{VideoKey: testKey}, {VideoKey: testKey, Restore: true}} {
+		resp, err := app.HandleRequest(context.Background(), request(body, rc))
+		if err != nil || resp.StatusCode != 200 {
+			t.Fatalf("HandleRequest(%+v) = %+v, %v", body, resp, err)
+		}
+	}
+
+	if v, _ := videos.Get(testKey); v.Status != video.STATUS_FAILED || v.DeletedAt != "" {
+		t.Errorf("restored video is %s, deleted at %q", v.Status, v.DeletedAt)
+	}
+
+	records, _ := audit.List(testKey)
+	if len(records) != 2 || records[1].Action != video.AUDIT_ACTION_RESTORE || records[1].Status != video.STATUS_DELETED {
+		t.Errorf("audit records = %+v, want the delete and the restore", records)
+	}
+}
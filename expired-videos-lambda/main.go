@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/cleanup"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+const (
+	// Principal of the deletions made by DynamoDB's TTL
+	TTL_PRINCIPAL = "dynamodb.amazonaws.com"
+
+	// Recorded as the actor of the expiries in the audit records
+	ACTOR = "expired-videos-lambda"
+)
+
+type Config struct {
+	config.AWS
+	Metrics metrics.LambdaConfig
+	Buckets cleanup.Buckets
+}
+
+type App struct {
+	audit  video.AuditRepository
+	purger *cleanup.Purger
+}
+
+func main() {
+	logging.Setup("expired-videos-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("expired-videos-lambda", cfg.Metrics.Config())
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	dynamoClient := dynamodb.New(sess)
+
+	app := App{
+		audit: video.NewDynamoAuditRepository(dynamoClient),
+		purger: &cleanup.Purger{
+			S3:      s3.New(sess),
+			Videos:  video.NewDynamoRepository(dynamoClient),
+			Buckets: cfg.Buckets,
+		},
+	}
+
+	lambda.Start(metrics.CountInvocations(app.HandleRequest))
+}
+
+// HandleRequest follows the stream of the Videos table and purges the
+// objects of every video DynamoDB removed because its ExpiresAt was reached.
+// An error makes the stream deliver the batch again, purging is safe to
+// repeat.
+func (app *App) HandleRequest(ctx context.Context, event events.DynamoDBEvent) error {
+	logger := logging.FromLambda(ctx)
+
+	for _, record := range event.Records {
+		if !isExpiry(record) {
+			continue
+		}
+
+		v, err := video.UnmarshalStreamImage(record.Change.OldImage)
+		if err != nil {
+			logger.Error("failed to unmarshal expired video", logging.ERROR, err)
+			return err
+		}
+
+		logger := logger.With(logging.VIDEO_KEY, v.Key)
+
+		purged, err := app.purger.PurgeObjects(v)
+		if err != nil {
+			logger.Error("failed to purge expired video", logging.ERROR, err)
+			return err
+		}
+
+		err = app.audit.Put(video.AuditRecord{
+			Key:     v.Key,
+			At:      time.Now().Format(time.RFC3339Nano),
+			Action:  video.AUDIT_ACTION_EXPIRE,
+			Actor:   ACTOR,
+			Status:  v.Status,
+			Objects: purged,
+		})
+		if err != nil {
+			logger.Error("failed to write audit record", logging.ERROR, err)
+			return err
+		}
+
+		logger.Info("purged expired video", "objects", len(purged))
+	}
+
+	return nil
+}
+
+// isExpiry reports whether the record is a video removed by the TTL, rather
+// than one deleted by us.
+func isExpiry(record events.DynamoDBEventRecord) bool {
+	return record.EventName == string(events.DynamoDBOperationTypeRemove) &&
+		record.UserIdentity != nil &&
+		record.UserIdentity.Type == "Service" &&
+		record.UserIdentity.PrincipalID == TTL_PRINCIPAL
+}
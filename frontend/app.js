@@ -8,6 +8,7 @@ let setTimeoutId;
 const UPLOAD_LAMBDA_URL =
   "";
 const ACCESS_TOKEN = "";
+const BUCKET_LINK = "";
 
 window.onload = async () => {
   showToast(toastEl, "Loading videos...", "green");
@@ -69,6 +70,9 @@ function renderVideoList(videos) {
     // Video Key
     const keyCell = row.insertCell();
     keyCell.textContent = truncateMiddle(video["key"], 20);
+    if (video["preview_key"]) {
+      attachPreview(keyCell, BUCKET_LINK + video["preview_key"]);
+    }
 
     // Status
     const statusCell = row.insertCell();
@@ -95,7 +99,7 @@ function renderVideoList(videos) {
     if (video["status"] != "completed") {
       playVideoCell.classList.add("col-disabled");
     }
-    playVideoCell.innerHTML = `<a href="/frontend/play.html?video=${video.key}">
+    playVideoCell.innerHTML = `<a href="/frontend/play.html?video=${encodeURIComponent(video.key)}">
     <img src="./icons/play.png" style="width: 20px;height: 20px" />
     </a>`;
     playVideoCell.ariaDisabled = true;
@@ -129,6 +133,7 @@ uploadBtn.addEventListener("click", async () => {
       body: file,
       headers: {
         "Content-Type": file.type,
+        ...(data.upload_headers || {}),
       },
     });
     if (!videoUploadRes.ok) {
@@ -141,6 +146,28 @@ uploadBtn.addEventListener("click", async () => {
   }
 });
 
+// Shows the looping preview clip while hovering over the given cell
+function attachPreview(cell, previewUrl) {
+  const isVideo = previewUrl.endsWith(".mp4");
+  const preview = document.createElement(isVideo ? "video" : "img");
+  preview.classList.add("video-preview");
+  if (isVideo) {
+    preview.muted = true;
+    preview.loop = true;
+  }
+
+  cell.addEventListener("mouseenter", () => {
+    preview.src = previewUrl;
+    cell.appendChild(preview);
+    if (isVideo) {
+      preview.play();
+    }
+  });
+  cell.addEventListener("mouseleave", () => {
+    preview.remove();
+  });
+}
+
 function showToast(toastEl, message, color = "#0d6efd") {
   toastEl.className = "";
 
@@ -1,25 +1,25 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
-	"os"
-	"time"
+	"log/slog"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
 )
 
-const (
-	REGION      = "ap-south-1"
-	BUCKET_NAME = "" // TODO: get from environment
-
-	EXPIRY_IN_MINUTES = 60 * time.Minute
-)
+type Config struct {
+	config.AWS
+	Metrics     metrics.LambdaConfig
+	AccessToken string `env:"GET_VIDEO_INFO_ACCESS_TOKEN" required:"true"`
+}
 
 type RequestBody struct {
 	VideoKey    string `json:"video_key"`
@@ -27,7 +27,7 @@ type RequestBody struct {
 }
 
 type Response struct {
-	Video Video `json:"video"`
+	Video video.Video `json:"video"`
 }
 
 type ErrorResponse struct {
@@ -35,50 +35,43 @@ type ErrorResponse struct {
 }
 
 type App struct {
-	token    string
-	dynamoCl *dynamodb.DynamoDB
-}
-
-type Video struct {
-	Key              string            `json:"key" dynamodbav:"Key"`
-	Status           string            `json:"status" dynamodbav:"Status"`
-	TranscodedFiles map[string]string `json:"transcoding_files" dynamodbav:"TranscodedFiles"`
-	TranscodingTime  string            `json:"transcoding_time" dynamodbav:"TranscodingTime"`
-	UploadedAt       string            `json:"uploaded_at" dynamodbav:"UploadedAt"`
+	token  string
+	videos video.VideoRepository
 }
 
 func main() {
-	token := os.Getenv("GET_VIDEO_INFO_ACCESS_TOKEN")
-	if token == "" {
-		log.Fatalf("GET_VIDEO_INFO_ACCESS_TOKEN is not set")
-	}
+	logging.Setup("get-video-info-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("get-video-info-lambda", cfg.Metrics.Config())
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(REGION),
-	})
+	sess, err := cfg.Session()
 	if err != nil {
-		log.Fatalf("failed to create AWS session, %v", err)
+		logging.Fatal("failed to create AWS session", err)
 	}
 
 	dynamoClient := dynamodb.New(sess)
 
-	app := App{token: token, dynamoCl: dynamoClient}
+	app := App{token: cfg.AccessToken, videos: video.NewDynamoRepository(dynamoClient)}
 
-	lambda.Start(app.HandleRequest)
+	lambda.Start(metrics.CountRequests(app.HandleRequest))
 }
 
-func (app *App) HandleRequest(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (app *App) HandleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	logger := logging.FromLambda(ctx)
+
 	var reqBody RequestBody
 	err := json.Unmarshal([]byte(request.Body), &reqBody)
 	if err != nil {
-		log.Printf("failed to unmarshal request body, %v\n", err)
+		logger.Error("failed to unmarshal request body", logging.ERROR, err)
 		return nil, err
 	}
 
 	if reqBody.AccessToken == "" {
 		errResp, err := generateErrorResponse("access token is missing", 400)
 		if err != nil {
-			log.Printf("failed to generate error response, %v\n", err)
+			logger.Error("failed to generate error response", logging.ERROR, err)
 			return nil, err
 		}
 
@@ -88,7 +81,7 @@ func (app *App) HandleRequest(request events.APIGatewayProxyRequest) (*events.AP
 	if reqBody.AccessToken != app.token {
 		errResp, err := generateErrorResponse("invalid access token", 401)
 		if err != nil {
-			log.Printf("failed to generate error response, %v\n", err)
+			logger.Error("failed to generate error response", logging.ERROR, err)
 			return nil, err
 		}
 
@@ -98,34 +91,40 @@ func (app *App) HandleRequest(request events.APIGatewayProxyRequest) (*events.AP
 	if reqBody.VideoKey == "" {
 		errResp, err := generateErrorResponse("video key is missing", 400)
 		if err != nil {
-			log.Printf("failed to generate error response, %v\n", err)
-			return errResp, nil
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
 		}
+
+		return errResp, nil
 	}
 
-	output, err := app.dynamoCl.GetItem(&dynamodb.GetItemInput{
-		Key: map[string]*dynamodb.AttributeValue{
-			"Key": {
-				S: aws.String(reqBody.VideoKey),
-			},
-		},
-		TableName: aws.String("Videos"),
-	})
+	logger = logger.With(logging.VIDEO_KEY, reqBody.VideoKey)
+
+	// Deleted videos are only kept around to be restored
+	v, err := app.videos.Get(reqBody.VideoKey)
+	if err == video.ErrNotFound || (err == nil && v.Status == video.STATUS_DELETED) {
+		errResp, err := generateErrorResponse("video not found", 404)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
 	if err != nil {
-		log.Printf("failed to get video info from dynamodb, %v\n", err)
+		logger.Error("failed to get video info from dynamodb", logging.ERROR, err)
 		return nil, err
 	}
 
-	var video Video
-	err = dynamodbattribute.UnmarshalMap(output.Item, &video)
-	if err != nil {
-		log.Printf("failed to unmarshal video info, %v\n", err)
-		return nil, err
+	// Videos uploaded before scheduling classes were introduced were
+	// transcoded like the default class
+	if v.Class == "" {
+		v.Class = task.DEFAULT_CLASS
 	}
 
-	resp, err := json.Marshal(Response{Video: video})
+	resp, err := json.Marshal(Response{Video: *v})
 	if err != nil {
-		log.Printf("failed to marshal response, %v\n", err)
+		logger.Error("failed to marshal response", logging.ERROR, err)
 		return nil, err
 	}
 
@@ -139,7 +138,7 @@ func generateErrorResponse(msg string, status int) (*events.APIGatewayProxyRespo
 	errMsg := ErrorResponse{Message: msg}
 	body, err := json.Marshal(errMsg)
 	if err != nil {
-		log.Printf("failed to marshal error response, %v\n", err)
+		slog.Error("failed to marshal error response", logging.ERROR, err)
 		return nil, err
 	}
 
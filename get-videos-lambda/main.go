@@ -1,32 +1,31 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
-	"os"
-	"time"
+	"log/slog"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
 )
 
-const (
-	REGION      = "ap-south-1"
-	BUCKET_NAME = "" // TODO: get from enviroment
-
-	EXPIRY_IN_MINUTES = 60 * time.Minute
-)
+type Config struct {
+	config.AWS
+	Metrics     metrics.LambdaConfig
+	AccessToken string `env:"GET_VIDEOS_ACCESS_TOKEN" required:"true"`
+}
 
 type RequestBody struct {
 	AccessToken string `json:"access_token"`
 }
 
 type Response struct {
-	Videos []Video `json:"videos"`
+	Videos []video.Video `json:"videos"`
 }
 
 type ErrorResponse struct {
@@ -34,49 +33,43 @@ type ErrorResponse struct {
 }
 
 type App struct {
-	token    string
-	dynamoCl *dynamodb.DynamoDB
-}
-
-type Video struct {
-	Key             string            `json:"key" dynamodbav:"Key"`
-	Status          string            `json:"status" dynamodbav:"Status"`
-	TranscodingTime string            `json:"transcoding_time" dynamodbav:"TranscodingTime"`
-	UploadedAt      string            `json:"uploaded_at" dynamodbav:"UploadedAt"`
+	token  string
+	videos video.VideoRepository
 }
 
 func main() {
-	token := os.Getenv("GET_VIDEOS_ACCESS_TOKEN")
-	if token == "" {
-		log.Fatalf("GET_VIDEOS_ACCESS_TOKEN is not set")
-	}
+	logging.Setup("get-videos-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("get-videos-lambda", cfg.Metrics.Config())
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(REGION),
-	})
+	sess, err := cfg.Session()
 	if err != nil {
-		log.Fatalf("failed to create AWS session, %v", err)
+		logging.Fatal("failed to create AWS session", err)
 	}
 
 	dynamoClient := dynamodb.New(sess)
 
-	app := App{token: token, dynamoCl: dynamoClient}
+	app := App{token: cfg.AccessToken, videos: video.NewDynamoRepository(dynamoClient)}
 
-	lambda.Start(app.HandleRequest)
+	lambda.Start(metrics.CountRequests(app.HandleRequest))
 }
 
-func (app *App) HandleRequest(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (app *App) HandleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	logger := logging.FromLambda(ctx)
+
 	var reqBody RequestBody
 	err := json.Unmarshal([]byte(request.Body), &reqBody)
 	if err != nil {
-		log.Printf("failed to unmarshal request body, %v\n", err)
+		logger.Error("failed to unmarshal request body", logging.ERROR, err)
 		return nil, err
 	}
 
 	if reqBody.AccessToken == "" {
 		errResp, err := generateErrorResponse("access token is missing", 400)
 		if err != nil {
-			log.Printf("failed to generate error response, %v\n", err)
+			logger.Error("failed to generate error response", logging.ERROR, err)
 			return nil, err
 		}
 
@@ -86,38 +79,30 @@ func (app *App) HandleRequest(request events.APIGatewayProxyRequest) (*events.AP
 	if reqBody.AccessToken != app.token {
 		errResp, err := generateErrorResponse("invalid access token", 401)
 		if err != nil {
-			log.Printf("failed to generate error response, %v\n", err)
+			logger.Error("failed to generate error response", logging.ERROR, err)
 			return nil, err
 		}
 
 		return errResp, nil
 	}
 
-	input := &dynamodb.ScanInput{
-		TableName: aws.String("Videos"),
-	}
-
-	result, err := app.dynamoCl.Scan(input)
+	videos, err := app.videos.List()
 	if err != nil {
-		log.Println("failed to scan videos, ", err)
+		logger.Error("failed to scan videos", logging.ERROR, err)
 		return nil, err
 	}
 
-	videos := []Video{}
-	for _, item := range result.Items {
-		video := Video{}
-		err = dynamodbattribute.UnmarshalMap(item, &video)
-		if err != nil {
-			log.Printf("failed to unmarshal video, %v\n", err)
-			return nil, err
+	// Deleted videos are only kept around to be restored
+	listed := []video.Video{}
+	for _, v := range videos {
+		if v.Status != video.STATUS_DELETED {
+			listed = append(listed, v)
 		}
-
-		videos = append(videos, video)
 	}
 
-	resp, err := json.Marshal(Response{Videos: videos})
+	resp, err := json.Marshal(Response{Videos: listed})
 	if err != nil {
-		log.Printf("failed to marshal response, %v\n", err)
+		logger.Error("failed to marshal response", logging.ERROR, err)
 		return nil, err
 	}
 
@@ -131,7 +116,7 @@ func generateErrorResponse(msg string, status int) (*events.APIGatewayProxyRespo
 	errMsg := ErrorResponse{Message: msg}
 	body, err := json.Marshal(errMsg)
 	if err != nil {
-		log.Printf("failed to marshal error response, %v\n", err)
+		slog.Error("failed to marshal error response", logging.ERROR, err)
 		return nil, err
 	}
 
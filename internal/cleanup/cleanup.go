@@ -0,0 +1,142 @@
+// Package cleanup removes a video and every object stored for it.
+package cleanup
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/keys"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// Most keys a single DeleteObjects request accepts
+const MAX_DELETE_BATCH = 1000
+
+// Buckets a video's objects may be stored in. Empty buckets are skipped.
+type Buckets struct {
+	Temporary string `env:"TEMPORARY_BUCKET_NAME" required:"true"`
+	Output    string `env:"OUTPUT_BUCKET_NAME" required:"true"`
+	Retained  string `env:"RETAINED_BUCKET_NAME"`
+}
+
+type Purger struct {
+	S3      s3iface.S3API
+	Videos  video.VideoRepository
+	Buckets Buckets
+}
+
+// Purge removes the objects of the video, see PurgeObjects, and then the
+// video itself. The video is only removed once every object is, so a failed
+// purge can be run again.
+func (p *Purger) Purge(v video.Video) ([]string, error) {
+	removed, err := p.PurgeObjects(v)
+	if err != nil {
+		return removed, err
+	}
+
+	err = p.Videos.Delete(v.Key)
+	if err != nil && err != video.ErrNotFound {
+		return removed, fmt.Errorf("failed to delete video %s, %v", v.Key, err)
+	}
+
+	return removed, nil
+}
+
+// PurgeObjects removes the renditions, the preview and anything else stored
+// under the video's prefix in the output bucket, and the source wherever it
+// is kept. It returns the removed objects as bucket/key.
+func (p *Purger) PurgeObjects(v video.Video) ([]string, error) {
+	objects := map[string]map[string]bool{}
+	add := func(bucket string, key string) {
+		if bucket == "" || key == "" {
+			return
+		}
+
+		if objects[bucket] == nil {
+			objects[bucket] = map[string]bool{}
+		}
+		objects[bucket][key] = true
+	}
+
+	for _, key := range v.TranscodedFiles {
+		add(p.Buckets.Output, key)
+	}
+	add(p.Buckets.Output, v.PreviewKey)
+
+	if p.Buckets.Output != "" {
+		err := p.S3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+			Bucket: aws.String(p.Buckets.Output),
+			Prefix: aws.String(keys.Prefix(keys.Parse(v.Key).VideoID)),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, object := range page.Contents {
+				add(p.Buckets.Output, aws.StringValue(object.Key))
+			}
+
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list outputs of %s, %v", v.Key, err)
+		}
+	}
+
+	add(v.SourceBucket, v.Key)
+	add(p.Buckets.Temporary, v.Key)
+	add(p.Buckets.Retained, v.Key)
+
+	removed := []string{}
+	for bucket, keys := range objects {
+		list := make([]string, 0, len(keys))
+		for key := range keys {
+			list = append(list, key)
+		}
+		sort.Strings(list)
+
+		for start := 0; start < len(list); start += MAX_DELETE_BATCH {
+			end := start + MAX_DELETE_BATCH
+			if end > len(list) {
+				end = len(list)
+			}
+
+			if err := p.deleteObjects(bucket, list[start:end]); err != nil {
+				return removed, err
+			}
+
+			for _, key := range list[start:end] {
+				removed = append(removed, bucket+"/"+key)
+			}
+		}
+	}
+
+	sort.Strings(removed)
+	return removed, nil
+}
+
+func (p *Purger) deleteObjects(bucket string, keys []string) error {
+	identifiers := make([]*s3.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		identifiers[i] = &s3.ObjectIdentifier{Key: aws.String(key)}
+	}
+
+	output, err := p.S3.DeleteObjects(&s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &s3.Delete{
+			Objects: identifiers,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete objects from %s, %v", bucket, err)
+	}
+
+	// Keys which don't exist are not errors, only those S3 failed to remove
+	if len(output.Errors) > 0 {
+		e := output.Errors[0]
+		return fmt.Errorf("failed to delete %d objects from %s, %s: %s",
+			len(output.Errors), bucket, aws.StringValue(e.Key), aws.StringValue(e.Message))
+	}
+
+	return nil
+}
@@ -0,0 +1,405 @@
+// Package config loads the configuration of the Lambdas and the transcoder
+// from their environment into a struct, checking it once at cold start.
+//
+// Fields are read from the variable named by their env tag:
+//
+//	type Config struct {
+//		config.AWS
+//		Token      string        `env:"ACCESS_TOKEN" required:"true"`
+//		MaxTasks   int           `env:"MAX_CONCURRENT_TASKS" default:"10" min:"1"`
+//		Timeout    time.Duration `env:"TIMEOUT_SECONDS" unit:"seconds"`
+//		QueueURLs  []string      `env:"JOB_QUEUE_URLS"`
+//		Retention  string        `env:"SOURCE_RETENTION" oneof:"keep delete archive"`
+//	}
+//
+// Strings, numbers, booleans, durations, comma separated lists and
+// comma separated key=value lists of integers are supported. A duration is
+// either a Go duration ("90s") or a number in the unit of the field. Nested
+// structs without an env tag are loaded as well.
+//
+// A value of the form "ssm:<name>" is replaced by the SSM parameter of that
+// name, and "secretsmanager:<id>" by the secret, or by one of its keys with
+// "secretsmanager:<id>#<key>" when the secret is a JSON object. This keeps
+// access tokens out of the function configuration.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+)
+
+const (
+	// Region used when none is set, e.g. when running locally
+	DEFAULT_REGION = "ap-south-1"
+
+	SSM_PREFIX             = "ssm:"
+	SECRETS_MANAGER_PREFIX = "secretsmanager:"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+var units = map[string]time.Duration{
+	"":        time.Second,
+	"seconds": time.Second,
+	"minutes": time.Minute,
+	"hours":   time.Hour,
+	"days":    24 * time.Hour,
+}
+
+// AWS is embedded in the configuration of every binary talking to AWS.
+// Lambdas get AWS_REGION from their runtime, DEFAULT_REGION is used when it
+// isn't set.
+type AWS struct {
+	Region string `env:"AWS_REGION"`
+	Endpoints
+}
+
+// Endpoints point the SDK at local stand-ins of the AWS services, like MinIO
+// and DynamoDB Local, see local-harness. AWS_ENDPOINT_URL is used for the
+// services without an endpoint of their own. Nothing is set on AWS.
+type Endpoints struct {
+	Default  string `env:"AWS_ENDPOINT_URL"`
+	S3       string `env:"AWS_ENDPOINT_URL_S3"`
+	DynamoDB string `env:"AWS_ENDPOINT_URL_DYNAMODB"`
+	SQS      string `env:"AWS_ENDPOINT_URL_SQS"`
+}
+
+// Session returns a session for the configured region and endpoints.
+func (c AWS) Session() (*session.Session, error) {
+	region := c.Region
+	if region == "" {
+		region = DEFAULT_REGION
+	}
+
+	cfg := &aws.Config{
+		Region: aws.String(region),
+	}
+
+	if c.Endpoints != (Endpoints{}) {
+		cfg.EndpointResolver = c.Endpoints
+		// S3 compatible stores rarely support virtual hosted buckets
+		cfg.S3ForcePathStyle = aws.Bool(c.S3 != "" || c.Default != "")
+	}
+
+	return session.NewSession(cfg)
+}
+
+// EndpointFor resolves the endpoint of a service, falling back to the AWS
+// endpoint of the service when no local one is set.
+func (e Endpoints) EndpointFor(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+	url := map[string]string{
+		endpoints.S3ServiceID:       e.S3,
+		endpoints.DynamodbServiceID: e.DynamoDB,
+		endpoints.SqsServiceID:      e.SQS,
+	}[service]
+	if url == "" {
+		url = e.Default
+	}
+
+	if url == "" {
+		return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	}
+
+	return endpoints.ResolvedEndpoint{URL: url, SigningRegion: region}, nil
+}
+
+// Loader loads configurations. The zero value reads the process environment
+// and creates the SSM and Secrets Manager clients when a value refers to
+// them.
+type Loader struct {
+	Lookup         func(name string) (string, bool)
+	SSM            ssmiface.SSMAPI
+	SecretsManager secretsmanageriface.SecretsManagerAPI
+}
+
+// Load loads cfg, a pointer to a struct, from the process environment.
+func Load(cfg interface{}) error {
+	return (&Loader{}).Load(cfg)
+}
+
+// MustLoad loads cfg and exits listing every invalid setting when it fails.
+// It is meant to be called first thing in main.
+func MustLoad(cfg interface{}) {
+	if err := Load(cfg); err != nil {
+		logging.Fatal("invalid configuration", err)
+	}
+}
+
+// Load sets every field of cfg, a pointer to a struct, from its variable.
+// All the invalid settings are reported together.
+func (l *Loader) Load(cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a pointer to a struct, got %T", cfg)
+	}
+
+	if l.Lookup == nil {
+		l.Lookup = os.LookupEnv
+	}
+
+	var errs []error
+	l.loadStruct(v.Elem(), &errs)
+
+	return errors.Join(errs...)
+}
+
+func (l *Loader) loadStruct(v reflect.Value, errs *[]error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+				l.loadStruct(v.Field(i), errs)
+			}
+			continue
+		}
+
+		if err := l.loadField(v.Field(i), field, name); err != nil {
+			*errs = append(*errs, err)
+		}
+	}
+}
+
+func (l *Loader) loadField(v reflect.Value, field reflect.StructField, name string) error {
+	value, ok := l.Lookup(name)
+	value = strings.TrimSpace(value)
+	if !ok || value == "" {
+		value = field.Tag.Get("default")
+	}
+
+	if value == "" {
+		if field.Tag.Get("required") == "true" {
+			return fmt.Errorf("%s is not set", name)
+		}
+		return nil
+	}
+
+	value, err := l.resolve(value)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	if oneof := field.Tag.Get("oneof"); oneof != "" {
+		allowed := strings.Fields(oneof)
+		found := false
+		for _, a := range allowed {
+			found = found || a == value
+		}
+
+		if !found {
+			return fmt.Errorf("%s is %q, must be one of %s", name, value, strings.Join(allowed, ", "))
+		}
+	}
+
+	if err := set(v, field, value); err != nil {
+		return fmt.Errorf("%s is %q, %v", name, value, err)
+	}
+
+	return nil
+}
+
+// set parses value into v, the field.
+func set(v reflect.Value, field reflect.StructField, value string) error {
+	min, hasMin := int64(0), false
+	if m := field.Tag.Get("min"); m != "" {
+		n, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid min tag %q", m)
+		}
+		min, hasMin = n, true
+	}
+
+	switch {
+	case v.Type() == durationType:
+		unit, ok := units[field.Tag.Get("unit")]
+		if !ok {
+			return fmt.Errorf("unknown unit %q", field.Tag.Get("unit"))
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			n, nerr := strconv.ParseInt(value, 10, 64)
+			if nerr != nil {
+				return errors.New("expected a duration or a number")
+			}
+			d = time.Duration(n) * unit
+		}
+
+		if hasMin && d < time.Duration(min)*unit {
+			return fmt.Errorf("must be at least %d %s", min, field.Tag.Get("unit"))
+		}
+
+		v.SetInt(int64(d))
+
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+
+	case v.Kind() == reflect.Int, v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("expected a number")
+		}
+
+		if hasMin && n < min {
+			return fmt.Errorf("must be at least %d", min)
+		}
+
+		v.SetInt(n)
+
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("expected a number")
+		}
+
+		if hasMin && f < float64(min) {
+			return fmt.Errorf("must be at least %d", min)
+		}
+
+		v.SetFloat(f)
+
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("expected true or false")
+		}
+
+		v.SetBool(b)
+
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = reflect.Append(list, reflect.ValueOf(item).Convert(v.Type().Elem()))
+			}
+		}
+
+		v.Set(list)
+
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && v.Type().Elem().Kind() == reflect.Int:
+		m := reflect.MakeMap(v.Type())
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+
+			key, item, ok := strings.Cut(entry, "=")
+			if !ok {
+				return fmt.Errorf("invalid entry %q, expected <key>=<number>", entry)
+			}
+
+			n, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil {
+				return fmt.Errorf("invalid entry %q, expected <key>=<number>", entry)
+			}
+
+			if hasMin && int64(n) < min {
+				return fmt.Errorf("invalid entry %q, must be at least %d", entry, min)
+			}
+
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)), reflect.ValueOf(n))
+		}
+
+		v.Set(m)
+
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+
+	return nil
+}
+
+// resolve returns the SSM parameter or the secret value refers to, or value
+// itself.
+func (l *Loader) resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SSM_PREFIX):
+		if l.SSM == nil {
+			sess, err := l.session()
+			if err != nil {
+				return "", err
+			}
+			l.SSM = ssm.New(sess)
+		}
+
+		name := strings.TrimPrefix(value, SSM_PREFIX)
+		output, err := l.SSM.GetParameter(&ssm.GetParameterInput{
+			Name:           aws.String(name),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to get SSM parameter %s, %v", name, err)
+		}
+
+		return aws.StringValue(output.Parameter.Value), nil
+
+	case strings.HasPrefix(value, SECRETS_MANAGER_PREFIX):
+		if l.SecretsManager == nil {
+			sess, err := l.session()
+			if err != nil {
+				return "", err
+			}
+			l.SecretsManager = secretsmanager.New(sess)
+		}
+
+		id, key, hasKey := strings.Cut(strings.TrimPrefix(value, SECRETS_MANAGER_PREFIX), "#")
+		output, err := l.SecretsManager.GetSecretValue(&secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(id),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to get secret %s, %v", id, err)
+		}
+
+		secret := aws.StringValue(output.SecretString)
+		if !hasKey {
+			return secret, nil
+		}
+
+		var fields map[string]string
+		if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+			return "", fmt.Errorf("secret %s is not a JSON object, %v", id, err)
+		}
+
+		field, ok := fields[key]
+		if !ok {
+			return "", fmt.Errorf("secret %s has no key %q", id, key)
+		}
+
+		return field, nil
+	}
+
+	return value, nil
+}
+
+// session returns a session for looking up parameters and secrets, which is
+// only needed by configurations referring to them.
+func (l *Loader) session() (*session.Session, error) {
+	region, _ := l.Lookup("AWS_REGION")
+
+	sess, err := AWS{Region: region}.Session()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session, %v", err)
+	}
+
+	return sess, nil
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// fakeSSM returns the parameters it holds.
+type fakeSSM struct {
+	ssmiface.SSMAPI
+	parameters map[string]string
+}
+
+func (f *fakeSSM) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	value, ok := f.parameters[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, errors.New("ParameterNotFound")
+	}
+
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String(value)}}, nil
+}
+
+// fakeSecretsManager returns the secrets it holds.
+type fakeSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	secrets map[string]string
+}
+
+func (f *fakeSecretsManager) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := f.secrets[aws.StringValue(input.SecretId)]
+	if !ok {
+		return nil, errors.New("ResourceNotFoundException")
+	}
+
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+type Retry struct {
+	MaxAttempts int           `env:"MAX_ATTEMPTS" default:"3" min:"1"`
+	Delay       time.Duration `env:"RETRY_DELAY_MINUTES" default:"1" unit:"minutes"`
+}
+
+type testConfig struct {
+	AWS
+	Token     string         `env:"ACCESS_TOKEN" required:"true"`
+	MaxTasks  int            `env:"MAX_CONCURRENT_TASKS" default:"10" min:"1"`
+	Timeout   time.Duration  `env:"TIMEOUT_SECONDS" default:"30" unit:"seconds" min:"1"`
+	Ratio     float64        `env:"RATIO" min:"0"`
+	Enabled   bool           `env:"ENABLED"`
+	QueueURLs []string       `env:"JOB_QUEUE_URLS"`
+	Retention string         `env:"SOURCE_RETENTION" default:"keep" oneof:"keep delete archive"`
+	Days      map[string]int `env:"RETENTION_DAYS" min:"1"`
+	Retry     Retry
+
+	unexported string
+}
+
+func load(env map[string]string) (testConfig, error) {
+	l := &Loader{
+		Lookup: func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		},
+		SSM: &fakeSSM{parameters: map[string]string{
+			"/video/token": "from-ssm",
+		}},
+		SecretsManager: &fakeSecretsManager{secrets: map[string]string{
+			"token":  "from-secret",
+			"tokens": `{"access":"from-secret-key"}`,
+		}},
+	}
+
+	var cfg testConfig
+	err := l.Load(&cfg)
+	return cfg, err
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(map[string]string{"ACCESS_TOKEN": "token"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.MaxTasks != 10 || cfg.Timeout != 30*time.Second || cfg.Retention != "keep" {
+		t.Errorf("defaults = %d tasks, %s timeout, retention %q", cfg.MaxTasks, cfg.Timeout, cfg.Retention)
+	}
+	if cfg.Retry.MaxAttempts != 3 || cfg.Retry.Delay != time.Minute {
+		t.Errorf("nested defaults = %+v", cfg.Retry)
+	}
+	if cfg.Region != "" || cfg.QueueURLs != nil || cfg.Days != nil || cfg.Enabled {
+		t.Errorf("unset fields = %+v", cfg)
+	}
+}
+
+func TestLoadValues(t *testing.T) {
+	cfg, err := load(map[string]string{
+		"AWS_REGION":           "eu-west-1",
+		"AWS_ENDPOINT_URL_S3":  "http://localhost:9000",
+		"ACCESS_TOKEN":         " token ",
+		"MAX_CONCURRENT_TASKS": "4",
+		"TIMEOUT_SECONDS":      "90",
+		"RATIO":                "0.5",
+		"ENABLED":              "true",
+		"JOB_QUEUE_URLS":       "express, standard,,bulk",
+		"SOURCE_RETENTION":     "archive",
+		"RETENTION_DAYS":       "acme=30, default = 7",
+		"MAX_ATTEMPTS":         "5",
+		"RETRY_DELAY_MINUTES":  "90s",
+	})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := testConfig{
+		AWS:       AWS{Region: "eu-west-1", Endpoints: Endpoints{S3: "http://localhost:9000"}},
+		Token:     "token",
+		MaxTasks:  4,
+		Timeout:   90 * time.Second,
+		Ratio:     0.5,
+		Enabled:   true,
+		QueueURLs: []string{"express", "standard", "bulk"},
+		Retention: "archive",
+		Days:      map[string]int{"acme": 30, "default": 7},
+		Retry:     Retry{MaxAttempts: 5, Delay: 90 * time.Second},
+	}
+
+	if cfg.AWS != want.AWS || cfg.Token != want.Token || cfg.MaxTasks != want.MaxTasks || cfg.Timeout != want.Timeout ||
+		cfg.Ratio != want.Ratio || cfg.Enabled != want.Enabled || cfg.Retention != want.Retention || cfg.Retry != want.Retry {
+		t.Errorf("Load() = %+v, want %+v", cfg, want)
+	}
+	if strings.Join(cfg.QueueURLs, " ") != strings.Join(want.QueueURLs, " ") {
+		t.Errorf("QueueURLs = %q, want %q", cfg.QueueURLs, want.QueueURLs)
+	}
+	if len(cfg.Days) != 2 || cfg.Days["acme"] != 30 || cfg.Days["default"] != 7 {
+		t.Errorf("Days = %v, want %v", cfg.Days, want.Days)
+	}
+}
+
+func TestLoadResolvesParametersAndSecrets(t *testing.T) {
+	tests := []struct {
+		value string
+		token string
+		err   string
+	}{
+		{"ssm:/video/token", "from-ssm", ""},
+		{"secretsmanager:token", "from-secret", ""},
+		{"secretsmanager:tokens#access", "from-secret-key", ""},
+		{"ssm:/video/missing", "", "failed to get SSM parameter /video/missing"},
+		{"secretsmanager:missing", "", "failed to get secret missing"},
+		{"secretsmanager:tokens#missing", "", `secret tokens has no key "missing"`},
+		{"secretsmanager:token#access", "", "secret token is not a JSON object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg, err := load(map[string]string{"ACCESS_TOKEN": tt.value})
+
+			if tt.err == "" && (err != nil || cfg.Token != tt.token) {
+				t.Errorf("Load() = %q, %v, want %q", cfg.Token, err, tt.token)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), "ACCESS_TOKEN: "+tt.err)) {
+				t.Errorf("Load() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryInvalidSetting(t *testing.T) {
+	tests := []struct {
+		env map[string]string
+		err string
+	}{
+		{map[string]string{}, "ACCESS_TOKEN is not set"},
+		{map[string]string{"ACCESS_TOKEN": "  "}, "ACCESS_TOKEN is not set"},
+		{map[string]string{"MAX_CONCURRENT_TASKS": "0"}, `MAX_CONCURRENT_TASKS is "0", must be at least 1`},
+		{map[string]string{"MAX_CONCURRENT_TASKS": "ten"}, `MAX_CONCURRENT_TASKS is "ten", expected a number`},
+		{map[string]string{"TIMEOUT_SECONDS": "0"}, `TIMEOUT_SECONDS is "0", must be at least 1 seconds`},
+		{map[string]string{"TIMEOUT_SECONDS": "soon"}, `TIMEOUT_SECONDS is "soon", expected a duration or a number`},
+		{map[string]string{"RATIO": "-1"}, `RATIO is "-1", must be at least 0`},
+		{map[string]string{"ENABLED": "yes"}, `ENABLED is "yes", expected true or false`},
+		{map[string]string{"SOURCE_RETENTION": "forever"}, `SOURCE_RETENTION is "forever", must be one of keep, delete, archive`},
+		{map[string]string{"RETENTION_DAYS": "acme"}, `invalid entry "acme", expected <key>=<number>`},
+		{map[string]string{"RETENTION_DAYS": "acme=0"}, `invalid entry "acme=0", must be at least 1`},
+		{map[string]string{"MAX_ATTEMPTS": "0"}, `MAX_ATTEMPTS is "0", must be at least 1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err, func(t *testing.T) {
+			_, err := load(tt.env)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Load() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	// Every one of them at once
+	_, err := load(map[string]string{"MAX_CONCURRENT_TASKS": "0", "ENABLED": "yes"})
+	if err == nil || len(strings.Split(err.Error(), "\n")) != 3 {
+		t.Errorf("Load() error = %v, want the token, the tasks and enabled", err)
+	}
+}
+
+func TestLoadRefusesWhatIsntAPointerToAStruct(t *testing.T) {
+	var cfg testConfig
+	for _, v := range []interface{}{cfg, &cfg.Token, nil} {
+		if err := (&Loader{}).Load(v); err == nil {
+			t.Errorf("Load(%T) error = nil", v)
+		}
+	}
+}
+
+func TestLoadRefusesUnsupportedFields(t *testing.T) {
+	var cfg struct {
+		Unsupported []int `env:"UNSUPPORTED"`
+	}
+
+	l := &Loader{Lookup: func(string) (string, bool) { return "1,2", true }}
+	if err := l.Load(&cfg); err == nil || !strings.Contains(err.Error(), "unsupported field type []int") {
+		t.Errorf("Load() error = %v", err)
+	}
+}
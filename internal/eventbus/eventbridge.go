@@ -0,0 +1,60 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	"github.com/thegeorgenikhil/video-transcoding-service/videoevents"
+)
+
+// EventBridgePublisher puts the events on a bus. The envelope of the event is
+// the detail, and its type the detail-type, which rules can match on.
+type EventBridgePublisher struct {
+	cl       eventbridgeiface.EventBridgeAPI
+	producer string
+	bus      string
+	source   string
+}
+
+func NewEventBridgePublisher(cl eventbridgeiface.EventBridgeAPI, producer, bus, source string) *EventBridgePublisher {
+	return &EventBridgePublisher{cl: cl, producer: producer, bus: bus, source: source}
+}
+
+func (p *EventBridgePublisher) Publish(ctx context.Context, event videoevents.Event) error {
+	envelope, err := newEnvelope(p.producer, event)
+	if err != nil {
+		return err
+	}
+
+	detail, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	output, err := p.cl.PutEventsWithContext(ctx, &eventbridge.PutEventsInput{
+		Entries: []*eventbridge.PutEventsRequestEntry{
+			{
+				EventBusName: aws.String(p.bus),
+				Source:       aws.String(p.source),
+				DetailType:   aws.String(envelope.Type),
+				Detail:       aws.String(string(detail)),
+				Time:         aws.Time(envelope.OccurredAt),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Entries are refused one by one, without failing the request
+	if aws.Int64Value(output.FailedEntryCount) > 0 && len(output.Entries) > 0 {
+		entry := output.Entries[0]
+		return fmt.Errorf("event was refused, %s: %s", aws.StringValue(entry.ErrorCode), aws.StringValue(entry.ErrorMessage))
+	}
+
+	return nil
+}
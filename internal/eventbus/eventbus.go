@@ -0,0 +1,79 @@
+// Package eventbus publishes the domain events of the pipeline, defined by
+// the videoevents module, for other services to react to. They go to an
+// EventBridge bus or an SNS topic, or nowhere, which is the default.
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/google/uuid"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/videoevents"
+)
+
+const (
+	BACKEND_NONE        = "none"
+	BACKEND_EVENTBRIDGE = "eventbridge"
+	BACKEND_SNS         = "sns"
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, event videoevents.Event) error
+}
+
+// Config selects where the events go.
+type Config struct {
+	Backend string `env:"EVENTS" default:"none" oneof:"none eventbridge sns"`
+
+	// eventbridge, the bus the events are put on and their source
+	BusName string `env:"EVENTS_BUS_NAME" default:"default"`
+	Source  string `env:"EVENTS_SOURCE" default:"video-transcoding-service"`
+
+	// sns, the topic the events are published to
+	TopicARN string `env:"EVENTS_TOPIC_ARN"`
+}
+
+// New returns the publisher of the configured backend. The events name the
+// producer which published them.
+func New(sess *session.Session, producer string, cfg Config) (Publisher, error) {
+	switch cfg.Backend {
+	case BACKEND_NONE, "":
+		return discard{}, nil
+
+	case BACKEND_EVENTBRIDGE:
+		return NewEventBridgePublisher(eventbridge.New(sess), producer, cfg.BusName, cfg.Source), nil
+
+	case BACKEND_SNS:
+		if cfg.TopicARN == "" {
+			return nil, errors.New("EVENTS_TOPIC_ARN is not set")
+		}
+
+		return NewSNSPublisher(sns.New(sess), producer, cfg.TopicARN), nil
+	}
+
+	return nil, fmt.Errorf("unknown events backend %q", cfg.Backend)
+}
+
+// Publish publishes the event with p, logging the failure when it can't be.
+// Events only tell others what happened, a job doesn't fail when one of them
+// is lost.
+func Publish(ctx context.Context, p Publisher, logger *slog.Logger, event videoevents.Event) {
+	if err := p.Publish(ctx, event); err != nil {
+		logger.Error("failed to publish event", "event_type", event.EventType(), logging.ERROR, err)
+	}
+}
+
+func newEnvelope(producer string, event videoevents.Event) (videoevents.Envelope, error) {
+	return videoevents.NewEnvelope(uuid.NewString(), producer, time.Now(), event)
+}
+
+type discard struct{}
+
+func (discard) Publish(context.Context, videoevents.Event) error { return nil }
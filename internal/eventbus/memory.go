@@ -0,0 +1,40 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/videoevents"
+)
+
+// MemoryPublisher keeps the published events in memory. It is meant for
+// tests, which can check what was published with Envelopes.
+type MemoryPublisher struct {
+	envelopes []videoevents.Envelope
+	sync.Mutex
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, event videoevents.Event) error {
+	envelope, err := newEnvelope("memory", event)
+	if err != nil {
+		return err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.envelopes = append(p.envelopes, envelope)
+	return nil
+}
+
+// Envelopes returns the published events, in the order they were published.
+func (p *MemoryPublisher) Envelopes() []videoevents.Envelope {
+	p.Lock()
+	defer p.Unlock()
+
+	return append([]videoevents.Envelope(nil), p.envelopes...)
+}
@@ -0,0 +1,54 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/thegeorgenikhil/video-transcoding-service/videoevents"
+)
+
+// SNSPublisher publishes the events to a topic. The envelope of the event is
+// the message, and its type and version are message attributes, which
+// subscriptions can filter on.
+type SNSPublisher struct {
+	cl       snsiface.SNSAPI
+	producer string
+	topicARN string
+}
+
+func NewSNSPublisher(cl snsiface.SNSAPI, producer, topicARN string) *SNSPublisher {
+	return &SNSPublisher{cl: cl, producer: producer, topicARN: topicARN}
+}
+
+func (p *SNSPublisher) Publish(ctx context.Context, event videoevents.Event) error {
+	envelope, err := newEnvelope(p.producer, event)
+	if err != nil {
+		return err
+	}
+
+	message, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.cl.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn: aws.String(p.topicARN),
+		Message:  aws.String(string(message)),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			"type": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(envelope.Type),
+			},
+			"version": {
+				DataType:    aws.String("Number"),
+				StringValue: aws.String(strconv.Itoa(envelope.Version)),
+			},
+		},
+	})
+
+	return err
+}
@@ -0,0 +1,138 @@
+// Package keys defines how objects belonging to a video are laid out in the
+// buckets. Every object of a video lives under the video's ID:
+//
+//	<videoID>/source/<file>      the original upload in the temporary bucket
+//	<videoID>/<rendition>/<file> transcoded outputs in the output bucket
+//
+// The file name of an output is the base name of the upload with the
+// extension of the output container, so "my.holiday.video.mov" transcoded to
+// 720p becomes "<videoID>/720p/my.holiday.video.mp4". Re-transcoded outputs
+// go to a versioned rendition, "<videoID>/720p-v2/my.holiday.video.mp4".
+package keys
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SOURCE_RENDITION  = "source"
+	PREVIEW_RENDITION = "preview"
+
+	// Used when nothing is left of the uploaded file name after sanitizing it
+	DEFAULT_FILE_NAME = "video"
+)
+
+// Layout is a parsed object key.
+type Layout struct {
+	VideoID   string
+	Rendition string
+	File      string
+}
+
+func (l Layout) String() string {
+	return l.VideoID + "/" + l.Rendition + "/" + l.File
+}
+
+// BaseName returns the file name without its extension.
+func (l Layout) BaseName() string {
+	return strings.TrimSuffix(l.File, path.Ext(l.File))
+}
+
+// NewVideoID returns a new, time ordered, video ID.
+func NewVideoID() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+
+	return id.String(), nil
+}
+
+// SourceKey returns the key the original upload is stored under.
+func SourceKey(videoID string, fileName string) string {
+	return Layout{VideoID: videoID, Rendition: SOURCE_RENDITION, File: SanitizeFileName(fileName)}.String()
+}
+
+// RenditionKey returns the key of the given rendition of the video uploaded
+// as sourceKey, using ext as the file extension.
+func RenditionKey(sourceKey string, rendition string, ext string) string {
+	l := Parse(sourceKey)
+
+	return Layout{VideoID: l.VideoID, Rendition: rendition, File: l.BaseName() + "." + ext}.String()
+}
+
+// VersionedRenditionKey returns the key of the given version of a rendition.
+// Every re-transcode of a video writes its outputs under a new version, so
+// the files players are streaming stay in place until the video points to
+// the new ones. Version 1 is the first transcode, stored under RenditionKey.
+func VersionedRenditionKey(sourceKey string, rendition string, ext string, version int) string {
+	if version > 1 {
+		rendition = fmt.Sprintf("%s-v%d", rendition, version)
+	}
+
+	return RenditionKey(sourceKey, rendition, ext)
+}
+
+// Parse splits the key into its parts. Keys written before this layout was
+// introduced ("<name>-<uuid>.<ext>") are returned with the key without its
+// extension as the video ID, which keeps the outputs of older uploads under a
+// prefix of their own.
+func Parse(key string) Layout {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) == 3 && parts[0] != "" && parts[1] != "" && parts[2] != "" {
+		return Layout{VideoID: parts[0], Rendition: parts[1], File: parts[2]}
+	}
+
+	file := path.Base(key)
+	id := strings.TrimSuffix(file, path.Ext(file))
+	if id == "" {
+		id = file
+	}
+
+	return Layout{VideoID: id, Rendition: SOURCE_RENDITION, File: file}
+}
+
+// IsLegacy reports whether the key predates the layout.
+func IsLegacy(key string) bool {
+	return len(strings.SplitN(key, "/", 3)) != 3
+}
+
+// SanitizeFileName reduces the uploaded file name to a safe base name. Only
+// letters, digits, dots, dashes and underscores are kept.
+func SanitizeFileName(fileName string) string {
+	fileName = path.Base(strings.ReplaceAll(fileName, "\\", "/"))
+
+	var b strings.Builder
+	for _, r := range fileName {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	name := strings.TrimLeft(b.String(), ".")
+	if strings.Trim(name, "_") == "" {
+		return DEFAULT_FILE_NAME
+	}
+
+	if len(name) > 200 {
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = name[:200-len(ext)] + ext
+	}
+
+	return name
+}
+
+// Prefix returns the prefix all objects of the video are stored under.
+func Prefix(videoID string) string {
+	return videoID + "/"
+}
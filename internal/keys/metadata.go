@@ -0,0 +1,12 @@
+package keys
+
+// Keys of the user metadata the upload lambda sets on the source object, read
+// back by the upload event handler and the transcoder. The SDK canonicalizes
+// user metadata keys, hence the casing.
+const (
+	PREVIEW_START_METADATA_KEY    = "Preview-Start"
+	PREVIEW_DURATION_METADATA_KEY = "Preview-Duration"
+	TENANT_METADATA_KEY           = "Tenant"
+	CLASS_METADATA_KEY            = "Class"
+	CALLBACK_URL_METADATA_KEY     = "Callback-Url"
+)
@@ -0,0 +1,112 @@
+// Package logging sets up the structured logs of the Lambdas and the
+// transcoder. Every line is a JSON object on stdout, so CloudWatch Logs
+// Insights can follow a video through all of them:
+//
+//	fields @timestamp, service, msg, stage, duration_ms
+//	| filter video_key = "<key>"
+//	| sort @timestamp
+//
+// Lines about a video carry its key, the lines of a transcoding job its job
+// ID and the ones of a rendition its name, under the attribute names below.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes shared by the binaries
+const (
+	SERVICE    = "service"
+	REQUEST_ID = "request_id"
+	VIDEO_KEY  = "video_key"
+	JOB_ID     = "job_id"
+	TASK_ID    = "task_id"
+	TRACE_ID   = "trace_id"
+	RENDITION  = "rendition"
+	ATTEMPT    = "attempt"
+	STAGE      = "stage"
+	DURATION   = "duration_ms"
+	ERROR      = "error"
+)
+
+// Setup makes the JSON logger of the service the default one, which the log
+// package writes through as well. LOG_LEVEL sets the lowest level written,
+// debug, info (the default), warn or error. It is read on its own, so the
+// errors of loading the rest of the configuration are logged already.
+func Setup(service string) {
+	slog.SetDefault(New(os.Stdout, service, level(os.Getenv("LOG_LEVEL"))))
+}
+
+// New returns a logger writing JSON lines to w, tagged with the service.
+func New(w io.Writer, service string, level slog.Level) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	return slog.New(handler).With(SERVICE, service)
+}
+
+func level(name string) slog.Level {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// FromLambda returns the default logger with the ID of the Lambda request
+// being handled, when ctx is the one of a request.
+func FromLambda(ctx context.Context) *slog.Logger {
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		return slog.Default().With(REQUEST_ID, lc.AwsRequestID)
+	}
+
+	return slog.Default()
+}
+
+// WithTrace adds the ID of the trace of ctx to the logger, when ctx is
+// traced, so the lines of a video can be found from its trace.
+func WithTrace(logger *slog.Logger, ctx context.Context) *slog.Logger {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		return logger.With(TRACE_ID, sc.TraceID().String())
+	}
+
+	return logger
+}
+
+// Fatal logs the error and exits, for the errors a binary can't start
+// without.
+func Fatal(msg string, err error) {
+	slog.Error(msg, ERROR, err)
+	os.Exit(1)
+}
+
+// Stage starts timing a step of a job. The returned function logs that the
+// step finished with how long it took, along with the given attributes, and
+// records the duration as the StageDuration metric of the stage.
+func Stage(logger *slog.Logger, stage string) func(args ...any) {
+	return StageSince(logger, stage, time.Now())
+}
+
+// StageSince is Stage for a step which started at start, before the binary
+// got to it, e.g. the wait of a job in the queue.
+func StageSince(logger *slog.Logger, stage string, start time.Time) func(args ...any) {
+	return func(args ...any) {
+		duration := time.Since(start).Milliseconds()
+		metrics.Put(metrics.STAGE_DURATION, float64(duration), metrics.UNIT_MILLISECONDS, metrics.Dimensions{metrics.STAGE: stage})
+
+		args = append([]any{STAGE, stage, DURATION, duration}, args...)
+		logger.Info("stage finished", args...)
+	}
+}
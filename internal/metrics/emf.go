@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EMFRecorder writes every value as a line in the CloudWatch embedded metric
+// format. Written to stdout, which the Lambdas and the ECS tasks send to
+// CloudWatch Logs, the values show up as metrics of the namespace.
+type EMFRecorder struct {
+	w         io.Writer
+	namespace string
+	service   string
+	sync.Mutex
+}
+
+// NewEMFRecorder returns a recorder writing to w, stdout when w is nil.
+func NewEMFRecorder(w io.Writer, namespace, service string) *EMFRecorder {
+	if w == nil {
+		w = os.Stdout
+	}
+
+	return &EMFRecorder{w: w, namespace: namespace, service: service}
+}
+
+func (r *EMFRecorder) Put(name string, value float64, unit Unit, dimensions Dimensions) {
+	names := []string{SERVICE}
+	line := map[string]any{SERVICE: r.service, name: value}
+	for k, v := range dimensions {
+		names = append(names, k)
+		line[k] = v
+	}
+	sort.Strings(names[1:])
+
+	line["_aws"] = map[string]any{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []any{map[string]any{
+			"Namespace":  r.namespace,
+			"Dimensions": [][]string{names},
+			"Metrics":    []any{map[string]any{"Name": name, "Unit": unit}},
+		}},
+	}
+
+	body, err := json.Marshal(line)
+	if err != nil {
+		slog.Error("failed to marshal metric", "metric", name, "error", err)
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.w.Write(append(body, '\n'))
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// LambdaConfig is the Config of the Lambdas. They can't be scraped by
+// Prometheus, so its backend isn't accepted.
+type LambdaConfig struct {
+	Backend   string `env:"METRICS" default:"emf" oneof:"emf none"`
+	Namespace string `env:"METRICS_NAMESPACE" default:"VideoTranscoding"`
+}
+
+// Config returns the configuration to pass to Setup.
+func (c LambdaConfig) Config() Config {
+	return Config{Backend: c.Backend, Namespace: c.Namespace}
+}
+
+type APIHandler func(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error)
+
+// CountRequests counts the requests of an API Lambda by the status code of
+// their response. API Gateway answers a returned error with a 502.
+func CountRequests(h APIHandler) APIHandler {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+		resp, err := h(ctx, request)
+
+		status := 502
+		if err == nil && resp != nil {
+			status = resp.StatusCode
+		}
+		Put(REQUESTS, 1, UNIT_COUNT, Dimensions{STATUS_CODE: strconv.Itoa(status)})
+
+		return resp, err
+	}
+}
+
+// CountInvocations counts the invocations of an event Lambda by whether the
+// handler returned an error.
+func CountInvocations[E any](h func(ctx context.Context, event E) error) func(ctx context.Context, event E) error {
+	return func(ctx context.Context, event E) error {
+		err := h(ctx, event)
+
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		Put(INVOCATIONS, 1, UNIT_COUNT, Dimensions{RESULT: result})
+
+		return err
+	}
+}
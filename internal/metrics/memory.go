@@ -0,0 +1,44 @@
+package metrics
+
+import "sync"
+
+// MemoryRecorder keeps the recorded values in memory. It is meant for tests,
+// which can check what was recorded with Values.
+type MemoryRecorder struct {
+	data []Datum
+	sync.Mutex
+}
+
+type Datum struct {
+	Name       string
+	Value      float64
+	Unit       Unit
+	Dimensions Dimensions
+}
+
+func NewMemoryRecorder() *MemoryRecorder {
+	return &MemoryRecorder{}
+}
+
+func (r *MemoryRecorder) Put(name string, value float64, unit Unit, dimensions Dimensions) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.data = append(r.data, Datum{Name: name, Value: value, Unit: unit, Dimensions: dimensions})
+}
+
+// Values returns the values recorded for the metric, in the order they were
+// recorded.
+func (r *MemoryRecorder) Values(name string) []Datum {
+	r.Lock()
+	defer r.Unlock()
+
+	values := []Datum{}
+	for _, d := range r.data {
+		if d.Name == name {
+			values = append(values, d)
+		}
+	}
+
+	return values
+}
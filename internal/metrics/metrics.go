@@ -0,0 +1,146 @@
+// Package metrics records the metrics of the Lambdas and the transcoder. By
+// default they are written to stdout in the CloudWatch embedded metric
+// format, which CloudWatch Logs turns into metrics of METRICS_NAMESPACE. A
+// transcoder running as a queue worker can serve them to Prometheus instead.
+//
+// Every metric has the service which recorded it as a dimension, along with
+// the dimensions given when recording it.
+package metrics
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+const (
+	BACKEND_EMF        = "emf"
+	BACKEND_PROMETHEUS = "prometheus"
+	BACKEND_NONE       = "none"
+)
+
+// Metrics recorded by the binaries
+const (
+	// How long a step of a job took, by stage
+	STAGE_DURATION = "StageDuration"
+	// Seconds of video encoded per second, by rendition
+	ENCODE_SPEED = "EncodeSpeed"
+	// Size of the downloaded sources, and of the uploaded outputs by
+	// rendition
+	BYTES_IN  = "BytesIn"
+	BYTES_OUT = "BytesOut"
+	// Jobs which completed, and the ones which failed by reason
+	JOBS_COMPLETED = "JobsCompleted"
+	FAILURES       = "Failures"
+	// Requests of the API Lambdas by status code, and invocations of the
+	// other Lambdas by result
+	REQUESTS    = "Requests"
+	INVOCATIONS = "Invocations"
+	// Webhooks sent, by result
+	WEBHOOK_DELIVERIES = "WebhookDeliveries"
+	// Jobs in the queues, by queue, and the transcoding tasks running, as
+	// seen by the dispatcher
+	QUEUE_DEPTH   = "QueueDepth"
+	RUNNING_TASKS = "RunningTasks"
+)
+
+// Dimensions of the metrics
+const (
+	SERVICE     = "service"
+	STAGE       = "stage"
+	RENDITION   = "rendition"
+	REASON      = "reason"
+	STATUS_CODE = "status_code"
+	RESULT      = "result"
+	QUEUE       = "queue"
+)
+
+type Unit string
+
+const (
+	UNIT_COUNT        Unit = "Count"
+	UNIT_MILLISECONDS Unit = "Milliseconds"
+	UNIT_BYTES        Unit = "Bytes"
+	UNIT_NONE         Unit = "None"
+)
+
+type Dimensions map[string]string
+
+type Recorder interface {
+	Put(name string, value float64, unit Unit, dimensions Dimensions)
+}
+
+// Config selects where the metrics go.
+type Config struct {
+	Backend   string `env:"METRICS" default:"emf" oneof:"emf prometheus none"`
+	Namespace string `env:"METRICS_NAMESPACE" default:"VideoTranscoding"`
+
+	// prometheus, the address the metrics are served on at /metrics
+	Address string `env:"METRICS_ADDRESS" default:":9102"`
+}
+
+var (
+	defaultRecorder Recorder = discard{}
+	mu              sync.RWMutex
+)
+
+// Setup makes the recorder selected by cfg the default one, tagged with the
+// service. With the prometheus backend it starts serving the metrics.
+func Setup(service string, cfg Config) Recorder {
+	var r Recorder
+	switch cfg.Backend {
+	case BACKEND_PROMETHEUS:
+		p := NewPrometheusRecorder(cfg.Namespace, service)
+		go serve(cfg.Address, p)
+		r = p
+	case BACKEND_NONE:
+		r = discard{}
+	default:
+		r = NewEMFRecorder(nil, cfg.Namespace, service)
+	}
+
+	SetDefault(r)
+	return r
+}
+
+func serve(address string, p *PrometheusRecorder) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", p)
+
+	err := http.ListenAndServe(address, mux)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("failed to serve metrics", "address", address, "error", err)
+	}
+}
+
+// SetDefault makes r the recorder Put records to. Until it is called the
+// metrics are discarded.
+func SetDefault(r Recorder) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	defaultRecorder = r
+}
+
+func Default() Recorder {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return defaultRecorder
+}
+
+// Put records a value of the metric with the default recorder.
+func Put(name string, value float64, unit Unit, dimensions Dimensions) {
+	Default().Put(name, value, unit, dimensions)
+}
+
+type discard struct{}
+
+func (discard) Put(string, float64, Unit, Dimensions) {}
+
+// CountFailure records a failed job, by a short reason such as the stage
+// which failed. Reasons are dimensions, they must not carry error messages.
+func CountFailure(reason string) {
+	Put(FAILURES, 1, UNIT_COUNT, Dimensions{REASON: reason})
+}
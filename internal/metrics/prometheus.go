@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const OPENMETRICS_CONTENT_TYPE = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// PrometheusRecorder keeps the metrics to serve them in the OpenMetrics text
+// format. Counts are exposed as counters, other values as summaries with
+// their count and sum, e.g. video_transcoding_stage_duration_milliseconds.
+type PrometheusRecorder struct {
+	namespace string
+	service   string
+	families  map[string]*family
+	sync.Mutex
+}
+
+type family struct {
+	name   string
+	unit   Unit
+	series map[string]*series
+}
+
+type series struct {
+	labels string
+	count  float64
+	sum    float64
+}
+
+func NewPrometheusRecorder(namespace, service string) *PrometheusRecorder {
+	return &PrometheusRecorder{namespace: namespace, service: service, families: map[string]*family{}}
+}
+
+func (r *PrometheusRecorder) Put(name string, value float64, unit Unit, dimensions Dimensions) {
+	r.Lock()
+	defer r.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: r.familyName(name, unit), unit: unit, series: map[string]*series{}}
+		r.families[name] = f
+	}
+
+	labels := formatLabels(r.service, dimensions)
+	s, ok := f.series[labels]
+	if !ok {
+		s = &series{labels: labels}
+		f.series[labels] = s
+	}
+
+	s.count++
+	s.sum += value
+}
+
+func (r *PrometheusRecorder) familyName(name string, unit Unit) string {
+	n := snakeCase(r.namespace) + "_" + snakeCase(name)
+	if unit != UNIT_COUNT && unit != UNIT_NONE {
+		n += "_" + strings.ToLower(string(unit))
+	}
+
+	return n
+}
+
+// ServeHTTP writes the metrics recorded so far.
+func (r *PrometheusRecorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	w.Header().Set("Content-Type", OPENMETRICS_CONTENT_TYPE)
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		f := r.families[name]
+
+		labels := make([]string, 0, len(f.series))
+		for l := range f.series {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+
+		if f.unit == UNIT_COUNT {
+			fmt.Fprintf(&b, "# TYPE %s counter\n", f.name)
+			for _, l := range labels {
+				fmt.Fprintf(&b, "%s_total{%s} %g\n", f.name, l, f.series[l].sum)
+			}
+			continue
+		}
+
+		fmt.Fprintf(&b, "# TYPE %s summary\n", f.name)
+		if f.unit != UNIT_NONE {
+			fmt.Fprintf(&b, "# UNIT %s %s\n", f.name, strings.ToLower(string(f.unit)))
+		}
+		for _, l := range labels {
+			fmt.Fprintf(&b, "%s_count{%s} %g\n", f.name, l, f.series[l].count)
+			fmt.Fprintf(&b, "%s_sum{%s} %g\n", f.name, l, f.series[l].sum)
+		}
+	}
+	b.WriteString("# EOF\n")
+
+	w.Write([]byte(b.String()))
+}
+
+func formatLabels(service string, dimensions Dimensions) string {
+	names := make([]string, 0, len(dimensions))
+	for k := range dimensions {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	labels := []string{fmt.Sprintf("%s=%q", SERVICE, escapeLabel(service))}
+	for _, k := range names {
+		labels = append(labels, fmt.Sprintf("%s=%q", k, escapeLabel(dimensions[k])))
+	}
+
+	return strings.Join(labels, ",")
+}
+
+// escapeLabel leaves only printable characters in a label value, which %q
+// quotes the way OpenMetrics expects.
+func escapeLabel(value string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// snakeCase turns StageDuration into stage_duration.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
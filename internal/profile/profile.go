@@ -0,0 +1,59 @@
+// Package profile defines the renditions a video is transcoded to.
+package profile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile describes a rendition. The container decides the extension of the
+// output, whatever the uploaded file was.
+type Profile struct {
+	Scale      string
+	Container  string
+	VideoCodec string
+	AudioCodec string
+}
+
+// Profiles holds every rendition by name. Adding a profile here only
+// transcodes new uploads to it, older videos are re-transcoded to pick it up.
+var Profiles = map[string]Profile{
+	"144p":  {Scale: "256:144", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac"},
+	"240p":  {Scale: "426:240", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac"},
+	"360p":  {Scale: "640:360", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac"},
+	"480p":  {Scale: "854:480", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac"},
+	"720p":  {Scale: "1280:720", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac"},
+	"1080p": {Scale: "1920:1080", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac"},
+}
+
+// Names returns the names of every profile, sorted.
+func Names() []string {
+	names := make([]string, 0, len(Profiles))
+	for name := range Profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Select returns the profiles with the given names, or every profile when
+// no names are given.
+func Select(names []string) (map[string]Profile, error) {
+	if len(names) == 0 {
+		return Profiles, nil
+	}
+
+	selected := make(map[string]Profile, len(names))
+	for _, name := range names {
+		p, ok := Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q, must be one of %s", name, strings.Join(Names(), ", "))
+		}
+
+		selected[name] = p
+	}
+
+	return selected, nil
+}
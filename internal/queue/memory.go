@@ -0,0 +1,125 @@
+package queue
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryQueue keeps jobs in memory. It is meant for tests and local runs,
+// where there is no SQS queue to talk to.
+type MemoryQueue struct {
+	name     string
+	messages []memoryMessage
+	nextID   int
+	sync.Mutex
+}
+
+type memoryMessage struct {
+	id           string
+	job          Job
+	visibleAfter time.Time
+	received     bool
+}
+
+func NewMemoryQueue(name string) *MemoryQueue {
+	return &MemoryQueue{name: name}
+}
+
+func (q *MemoryQueue) Name() string {
+	return q.name
+}
+
+func (q *MemoryQueue) Enqueue(job Job, delay time.Duration) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if job.ID == "" {
+		job.ID = NewJobID()
+	}
+
+	if job.EnqueuedAt == "" {
+		job.EnqueuedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	job.AvailableAt = time.Now().Add(delay).UTC().Format(time.RFC3339)
+
+	q.nextID++
+	q.messages = append(q.messages, memoryMessage{
+		id:           strconv.Itoa(q.nextID),
+		job:          job,
+		visibleAfter: time.Now().Add(delay),
+	})
+
+	return nil
+}
+
+func (q *MemoryQueue) Receive(max int, wait time.Duration) ([]Message, error) {
+	deadline := time.Now().Add(wait)
+
+	for {
+		messages := q.receive(max)
+		if len(messages) > 0 || !time.Now().Before(deadline) {
+			return messages, nil
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (q *MemoryQueue) receive(max int) []Message {
+	q.Lock()
+	defer q.Unlock()
+
+	now := time.Now()
+	messages := []Message{}
+	for i := range q.messages {
+		m := &q.messages[i]
+		if m.received || m.visibleAfter.After(now) {
+			continue
+		}
+
+		m.received = true
+		messages = append(messages, Message{Job: m.job, Handle: m.id})
+
+		if len(messages) == max {
+			break
+		}
+	}
+
+	return messages
+}
+
+func (q *MemoryQueue) Delete(msg Message) error {
+	q.Lock()
+	defer q.Unlock()
+
+	for i, m := range q.messages {
+		if m.id == msg.Handle {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (q *MemoryQueue) Release(msg Message) error {
+	q.Lock()
+	defer q.Unlock()
+
+	for i := range q.messages {
+		if q.messages[i].id == msg.Handle {
+			q.messages[i].received = false
+			q.messages[i].visibleAfter = time.Now()
+		}
+	}
+
+	return nil
+}
+
+func (q *MemoryQueue) Depth() (int, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	return len(q.messages), nil
+}
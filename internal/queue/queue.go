@@ -0,0 +1,81 @@
+// Package queue holds the transcoding jobs waiting for a task. Uploads and
+// retries are enqueued, and the dispatcher starts tasks for them as capacity
+// frees up.
+package queue
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job asks for one attempt at transcoding a video. Its ID is given when it
+// is enqueued, and ties the logs of the attempt together.
+type Job struct {
+	ID         string `json:"id"`
+	Key        string `json:"key"`
+	Bucket     string `json:"bucket"`
+	Tenant     string `json:"tenant"`
+	Class      string `json:"class,omitempty"`
+	Priority   int    `json:"priority"`
+	Attempt    int    `json:"attempt"`
+	EnqueuedAt string `json:"enqueued_at"`
+
+	// When the job became available to receive, once the delay of its last
+	// enqueue was over. Unlike EnqueuedAt, it is set again when a job is
+	// enqueued again.
+	AvailableAt string `json:"available_at,omitempty"`
+
+	// Set for re-transcodes, see task.Job
+	Profiles []string `json:"profiles,omitempty"`
+	Version  int      `json:"version,omitempty"`
+
+	// Trace context of the upload, in the W3C traceparent format
+	TraceParent string `json:"traceparent,omitempty"`
+}
+
+// Message is a received job, which has to be deleted once handled or
+// released to make it available again.
+type Message struct {
+	Job    Job
+	Handle string
+}
+
+// NewJobID returns the ID of a new job, for the callers who log it before
+// enqueueing the job. Enqueue gives one to jobs without an ID.
+func NewJobID() string {
+	return uuid.NewString()
+}
+
+type Queue interface {
+	// Enqueue adds the job, making it available after delay.
+	Enqueue(job Job, delay time.Duration) error
+	// Receive returns up to max jobs, hiding them from other receivers
+	// until they are deleted or released. It waits up to wait for a job to
+	// arrive when the queue is empty.
+	Receive(max int, wait time.Duration) ([]Message, error)
+	Delete(msg Message) error
+	Release(msg Message) error
+	// Depth returns the number of jobs in the queue, including the ones
+	// which are delayed or received but not deleted yet.
+	Depth() (int, error)
+	Name() string
+}
+
+// Queues are ordered by priority, the most urgent one first.
+type Queues []Queue
+
+// For returns the queue a job of the given priority goes to. Priorities
+// start at 0 and higher is more urgent, those above the number of queues
+// end up in the first one.
+func (qs Queues) For(priority int) Queue {
+	i := len(qs) - 1 - priority
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(qs) {
+		i = len(qs) - 1
+	}
+
+	return qs[i]
+}
@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"encoding/json"
+	"log/slog"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+)
+
+// Longest delay SQS supports on a message
+const MAX_SQS_DELAY = 15 * time.Minute
+
+type SQSQueue struct {
+	cl  sqsiface.SQSAPI
+	url string
+}
+
+func NewSQSQueue(cl sqsiface.SQSAPI, url string) *SQSQueue {
+	return &SQSQueue{cl: cl, url: url}
+}
+
+// NewSQSQueues returns the queues for the URLs, ordered like the URLs.
+func NewSQSQueues(cl sqsiface.SQSAPI, urls []string) Queues {
+	qs := make(Queues, len(urls))
+	for i, url := range urls {
+		qs[i] = NewSQSQueue(cl, url)
+	}
+
+	return qs
+}
+
+func (q *SQSQueue) Name() string {
+	return path.Base(q.url)
+}
+
+func (q *SQSQueue) Enqueue(job Job, delay time.Duration) error {
+	if job.ID == "" {
+		job.ID = NewJobID()
+	}
+
+	if job.EnqueuedAt == "" {
+		job.EnqueuedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	if delay > MAX_SQS_DELAY {
+		delay = MAX_SQS_DELAY
+	}
+	job.AvailableAt = time.Now().Add(delay).UTC().Format(time.RFC3339)
+
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.cl.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:     aws.String(q.url),
+		MessageBody:  aws.String(string(body)),
+		DelaySeconds: aws.Int64(int64(delay.Seconds())),
+	})
+
+	return err
+}
+
+// Receive returns the jobs of the received messages. A message which isn't a
+// job can never be handled, it is logged and deleted instead of failing the
+// jobs received with it.
+func (q *SQSQueue) Receive(max int, wait time.Duration) ([]Message, error) {
+	if max > 10 {
+		max = 10
+	}
+
+	output, err := q.cl.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.url),
+		MaxNumberOfMessages: aws.Int64(int64(max)),
+		WaitTimeSeconds:     aws.Int64(int64(wait.Seconds())),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message, 0, len(output.Messages))
+	for _, m := range output.Messages {
+		msg := Message{Handle: aws.StringValue(m.ReceiptHandle)}
+		if err := json.Unmarshal([]byte(aws.StringValue(m.Body)), &msg.Job); err != nil {
+			slog.Error("dropping message which isn't a job", "queue", q.Name(), "message_id", aws.StringValue(m.MessageId), logging.ERROR, err)
+			if err := q.Delete(msg); err != nil {
+				slog.Error("failed to delete message", "queue", q.Name(), "message_id", aws.StringValue(m.MessageId), logging.ERROR, err)
+			}
+			continue
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func (q *SQSQueue) Delete(msg Message) error {
+	_, err := q.cl.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.url),
+		ReceiptHandle: aws.String(msg.Handle),
+	})
+
+	return err
+}
+
+func (q *SQSQueue) Release(msg Message) error {
+	_, err := q.cl.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(q.url),
+		ReceiptHandle:     aws.String(msg.Handle),
+		VisibilityTimeout: aws.Int64(0),
+	})
+
+	return err
+}
+
+func (q *SQSQueue) Depth() (int, error) {
+	output, err := q.cl.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(q.url),
+		AttributeNames: aws.StringSlice([]string{
+			sqs.QueueAttributeNameApproximateNumberOfMessages,
+			sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+		}),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	depth := 0
+	for _, v := range output.Attributes {
+		n, err := strconv.Atoi(aws.StringValue(v))
+		if err != nil {
+			return 0, err
+		}
+		depth += n
+	}
+
+	return depth, nil
+}
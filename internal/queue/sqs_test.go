@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// fakeSQS returns the given messages and records the deleted ones.
+type fakeSQS struct {
+	sqsiface.SQSAPI
+	messages []*sqs.Message
+	deleted  []string
+}
+
+func (f *fakeSQS) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	return &sqs.ReceiveMessageOutput{Messages: f.messages}, nil
+}
+
+func (f *fakeSQS) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	f.deleted = append(f.deleted, aws.StringValue(input.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestSQSReceiveDropsMessagesWhichArentJobs(t *testing.T) {
+	cl := &fakeSQS{messages: []*sqs.Message{
+		{MessageId: aws.String("1"), ReceiptHandle: aws.String("h1"), Body: aws.String(`{"id":"job-1","key":"a/source/a.mp4","attempt":1}`)},
+		{MessageId: aws.String("2"), ReceiptHandle: aws.String("h2"), Body: aws.String(`not a job`)},
+		{MessageId: aws.String("3"), ReceiptHandle: aws.String("h3"), Body: aws.String(`{"id":"job-3","key":"b/source/b.mp4","attempt":2}`)},
+	}}
+	q := NewSQSQueue(cl, "https://sqs.ap-south-1.amazonaws.com/123456789012/standard")
+
+	messages, err := q.Receive(10, 0)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+
+	if len(messages) != 2 || messages[0].Job.ID != "job-1" || messages[1].Job.ID != "job-3" || messages[1].Handle != "h3" {
+		t.Errorf("Receive() = %+v, want job-1 and job-3", messages)
+	}
+
+	if len(cl.deleted) != 1 || cl.deleted[0] != "h2" {
+		t.Errorf("deleted %v, want the message which isn't a job", cl.deleted)
+	}
+}
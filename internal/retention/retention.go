@@ -0,0 +1,53 @@
+// Package retention decides how long the sources and outputs of a video are
+// kept once it is transcoded.
+package retention
+
+import "time"
+
+type SourcePolicy string
+
+// What happens to the uploaded source once its video is transcoded. Deleted
+// sources can't be re-transcoded, unless a copy is retained in
+// RETAINED_BUCKET_NAME. Archived sources are moved there in the archive
+// storage class, Glacier Instant Retrieval by default, which can still be
+// read by a re-transcode without restoring the object first.
+const (
+	SOURCE_KEEP    SourcePolicy = "keep"
+	SOURCE_DELETE  SourcePolicy = "delete"
+	SOURCE_ARCHIVE SourcePolicy = "archive"
+)
+
+// Tenant in OUTPUT_TTL_DAYS whose TTL applies to the tenants not listed
+const ANY_TENANT = "*"
+
+type Policy struct {
+	Source              SourcePolicy `env:"SOURCE_RETENTION" default:"keep" oneof:"keep delete archive"`
+	ArchiveStorageClass string       `env:"SOURCE_ARCHIVE_STORAGE_CLASS" default:"GLACIER_IR"`
+
+	// Days the outputs are kept by tenant, e.g. "acme=90,*=30". Outputs of
+	// tenants without one never expire.
+	TTLDays map[string]int `env:"OUTPUT_TTL_DAYS" min:"1"`
+}
+
+// TTL returns how long the outputs of the tenant are kept, 0 when they
+// never expire.
+func (p Policy) TTL(tenant string) time.Duration {
+	days, ok := p.TTLDays[tenant]
+	if !ok {
+		days = p.TTLDays[ANY_TENANT]
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ExpiresAt returns when the outputs of a video of the tenant, transcoded at
+// now, expire, as the Unix time stored in the video's DynamoDB TTL attribute.
+// It returns 0 when they never expire.
+func (p Policy) ExpiresAt(tenant string, now time.Time) int64 {
+	ttl := p.TTL(tenant)
+	if ttl == 0 {
+		return 0
+	}
+
+	return now.Add(ttl).Unix()
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStorage keeps the objects as files under Root, a directory per bucket
+// and the key as the path within it. Metadata isn't kept, and the content
+// type of an object is guessed from its extension.
+type FileStorage struct {
+	Root string
+}
+
+// path returns the file of the object, refusing buckets and keys which would
+// lead out of the bucket.
+func (s *FileStorage) path(bucket, key string) (string, error) {
+	dir := filepath.Join(s.Root, bucket)
+	path := filepath.Join(dir, filepath.FromSlash(key))
+	if bucket == "" || bucket == "." || bucket == ".." || strings.ContainsAny(bucket, `/\`) || !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object %s/%s", bucket, key)
+	}
+
+	return path, nil
+}
+
+func (s *FileStorage) Download(ctx context.Context, bucket, key string, w io.WriterAt) error {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(io.NewOffsetWriter(w, 0), file)
+	return err
+}
+
+func (s *FileStorage) Head(ctx context.Context, bucket, key string) (*Object, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(path)),
+		Metadata:    map[string]string{},
+	}, nil
+}
+
+// Upload writes the object next to its file first, so a reader never sees
+// half of it.
+func (s *FileStorage) Upload(ctx context.Context, bucket, key string, body io.ReadSeeker, contentType string) error {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, body)
+}
+
+func (s *FileStorage) Copy(ctx context.Context, bucket, key, destinationBucket, storageClass string) error {
+	source, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	destination, err := s.path(destinationBucket, key)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(source)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writeFile(destination, file)
+}
+
+func (s *FileStorage) Delete(ctx context.Context, bucket, key string) error {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func writeFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestFileStorageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s := &FileStorage{Root: t.TempDir()}
+
+	if err := s.Upload(ctx, "videos", "acme/renditions/a/720p.mp4", strings.NewReader("rendition"), "video/mp4"); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	object, err := s.Head(ctx, "videos", "acme/renditions/a/720p.mp4")
+	if err != nil {
+		t.Fatalf("Head() error = %v", err)
+	}
+	if object.Size != int64(len("rendition")) || object.ContentType != "video/mp4" {
+		t.Errorf("Head() = %+v, want 9 bytes of video/mp4", object)
+	}
+
+	buf := aws.NewWriteAtBuffer(nil)
+	if err := s.Download(ctx, "videos", "acme/renditions/a/720p.mp4", buf); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if string(buf.Bytes()) != "rendition" {
+		t.Errorf("Download() = %q, want %q", buf.Bytes(), "rendition")
+	}
+
+	if err := s.Copy(ctx, "videos", "acme/renditions/a/720p.mp4", "archive", "GLACIER"); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if _, err := s.Head(ctx, "archive", "acme/renditions/a/720p.mp4"); err != nil {
+		t.Errorf("Head() of the copy error = %v", err)
+	}
+
+	if err := s.Delete(ctx, "videos", "acme/renditions/a/720p.mp4"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := s.Head(ctx, "videos", "acme/renditions/a/720p.mp4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Head() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "videos", "acme/renditions/a/720p.mp4"); err != nil {
+		t.Errorf("Delete() of a missing object error = %v", err)
+	}
+
+	// The temporary file of the upload is gone
+	entries, _ := os.ReadDir(filepath.Join(s.Root, "videos", "acme", "renditions", "a"))
+	if len(entries) != 0 {
+		t.Errorf("left %d files behind", len(entries))
+	}
+}
+
+func TestFileStorageMissingObjects(t *testing.T) {
+	ctx := context.Background()
+	s := &FileStorage{Root: t.TempDir()}
+	if err := s.Upload(ctx, "videos", "acme/source/a.mp4", strings.NewReader("source"), ""); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	if err := s.Download(ctx, "videos", "acme/source/b.mp4", aws.NewWriteAtBuffer(nil)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Download() error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Head(ctx, "videos", "acme/source/b.mp4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Head() error = %v, want ErrNotFound", err)
+	}
+	if err := s.Copy(ctx, "videos", "acme/source/b.mp4", "archive", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Copy() error = %v, want ErrNotFound", err)
+	}
+
+	// A prefix is a directory on disk, not an object
+	if _, err := s.Head(ctx, "videos", "acme/source"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Head() of a prefix error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFileStorageRefusesObjectsOutsideTheBucket(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	s := &FileStorage{Root: filepath.Join(root, "storage")}
+
+	tests := []struct {
+		bucket string
+		key    string
+	}{
+		{"videos", "../archive/a.mp4"},
+		{"videos", "acme/../../archive/a.mp4"},
+		{"videos", "../../escaped.mp4"},
+		{"videos", ""},
+		{"videos", "."},
+		{"", "escaped.mp4"},
+		{"..", "escaped.mp4"},
+		{"videos/acme", "a.mp4"},
+		{`videos\acme`, "a.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bucket+"/"+tt.key, func(t *testing.T) {
+			if err := s.Upload(ctx, tt.bucket, tt.key, strings.NewReader("x"), ""); err == nil {
+				t.Errorf("Upload() error = nil")
+			}
+			if err := s.Download(ctx, tt.bucket, tt.key, aws.NewWriteAtBuffer(nil)); err == nil || errors.Is(err, ErrNotFound) {
+				t.Errorf("Download() error = %v, want an invalid object", err)
+			}
+			if _, err := s.Head(ctx, tt.bucket, tt.key); err == nil || errors.Is(err, ErrNotFound) {
+				t.Errorf("Head() error = %v, want an invalid object", err)
+			}
+			if err := s.Copy(ctx, "videos", "a.mp4", tt.bucket, ""); tt.key == "a.mp4" && err == nil {
+				t.Errorf("Copy() error = nil")
+			}
+			if err := s.Delete(ctx, tt.bucket, tt.key); err == nil {
+				t.Errorf("Delete() error = nil")
+			}
+		})
+	}
+
+	// Nothing was written outside of the root
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 0 {
+		t.Errorf("wrote %d files next to the root", len(entries))
+	}
+}
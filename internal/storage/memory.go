@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// MemoryStorage keeps objects in memory. It is meant for tests, which can
+// put the sources in with Put and read the outputs back with Get.
+type MemoryStorage struct {
+	objects map[string]memoryObject
+	sync.Mutex
+}
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	metadata    map[string]string
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{objects: map[string]memoryObject{}}
+}
+
+// Put adds an object with the given metadata.
+func (s *MemoryStorage) Put(bucket, key string, data []byte, metadata map[string]string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.objects[bucket+"/"+key] = memoryObject{data: data, metadata: metadata}
+}
+
+// Get returns the data of an object and whether it exists.
+func (s *MemoryStorage) Get(bucket, key string) ([]byte, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	o, ok := s.objects[bucket+"/"+key]
+	return o.data, ok
+}
+
+func (s *MemoryStorage) Download(ctx context.Context, bucket, key string, w io.WriterAt) error {
+	data, ok := s.Get(bucket, key)
+	if !ok {
+		return ErrNotFound
+	}
+
+	_, err := w.WriteAt(data, 0)
+	return err
+}
+
+func (s *MemoryStorage) Head(ctx context.Context, bucket, key string) (*Object, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	o, ok := s.objects[bucket+"/"+key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	object := &Object{
+		Size:        int64(len(o.data)),
+		ContentType: o.contentType,
+		Metadata:    map[string]string{},
+	}
+	for k, v := range o.metadata {
+		object.Metadata[k] = v
+	}
+
+	return object, nil
+}
+
+func (s *MemoryStorage) Upload(ctx context.Context, bucket, key string, body io.ReadSeeker, contentType string) error {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, body); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.objects[bucket+"/"+key] = memoryObject{data: buf.Bytes(), contentType: contentType}
+
+	return nil
+}
+
+func (s *MemoryStorage) Copy(ctx context.Context, bucket, key, destinationBucket, storageClass string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	o, ok := s.objects[bucket+"/"+key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	s.objects[destinationBucket+"/"+key] = o
+	return nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, bucket, key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.objects, bucket+"/"+key)
+	return nil
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+)
+
+// S3Storage keeps the objects in S3, or in a store speaking its API.
+type S3Storage struct {
+	S3         s3iface.S3API
+	Downloader s3manageriface.DownloaderAPI
+}
+
+func NewS3Storage(sess *session.Session) *S3Storage {
+	return &S3Storage{
+		S3:         s3.New(sess),
+		Downloader: s3manager.NewDownloader(sess),
+	}
+}
+
+// NewS3CompatibleStorage returns the storage of a store speaking the S3 API
+// at cfg.Endpoint. Path-style addressing is what MinIO expects, R2 and the
+// XML API of Cloud Storage take both.
+func NewS3CompatibleStorage(sess *session.Session, cfg Config) *S3Storage {
+	awsCfg := &aws.Config{
+		Region:           aws.String(cfg.Region),
+		Endpoint:         aws.String(cfg.Endpoint),
+		S3ForcePathStyle: aws.Bool(cfg.PathStyle),
+	}
+	if cfg.AccessKeyID != "" {
+		awsCfg.Credentials = credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, "")
+	}
+
+	return NewS3Storage(sess.Copy(awsCfg))
+}
+
+func (s *S3Storage) Download(ctx context.Context, bucket, key string, w io.WriterAt) error {
+	_, err := s.Downloader.DownloadWithContext(ctx, w, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	return notFound(err)
+}
+
+func (s *S3Storage) Head(ctx context.Context, bucket, key string) (*Object, error) {
+	output, err := s.S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	object := &Object{
+		Size:        aws.Int64Value(output.ContentLength),
+		ContentType: aws.StringValue(output.ContentType),
+		Metadata:    map[string]string{},
+	}
+	for k, v := range output.Metadata {
+		object.Metadata[k] = aws.StringValue(v)
+	}
+
+	return object, nil
+}
+
+func (s *S3Storage) Upload(ctx context.Context, bucket, key string, body io.ReadSeeker, contentType string) error {
+	_, err := s.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+
+	return err
+}
+
+func (s *S3Storage) Copy(ctx context.Context, bucket, key, destinationBucket, storageClass string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(destinationBucket),
+		Key:        aws.String(key),
+		CopySource: aws.String(bucket + "/" + strings.ReplaceAll(url.PathEscape(key), "%2F", "/")),
+	}
+	if storageClass != "" {
+		input.StorageClass = aws.String(storageClass)
+	}
+
+	_, err := s.S3.CopyObjectWithContext(ctx, input)
+	return notFound(err)
+}
+
+func (s *S3Storage) Delete(ctx context.Context, bucket, key string) error {
+	_, err := s.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	return err
+}
+
+// notFound turns the errors of missing objects into ErrNotFound. HEAD
+// requests have no body, so S3 only answers NotFound for them.
+func notFound(err error) error {
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return ErrNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,85 @@
+// Package storage holds the objects the transcoder reads and writes: the
+// uploaded sources and the renditions. Objects are addressed by bucket and
+// key on every backend, S3, a store speaking the S3 API such as MinIO, R2 or
+// Cloud Storage, or a directory of the local filesystem.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const (
+	STORAGE_S3            = "s3"
+	STORAGE_S3_COMPATIBLE = "s3-compatible"
+	STORAGE_LOCAL         = "local"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type Storage interface {
+	// Download writes the object to w.
+	Download(ctx context.Context, bucket, key string, w io.WriterAt) error
+	// Head returns the attributes of the object, or ErrNotFound.
+	Head(ctx context.Context, bucket, key string) (*Object, error)
+	Upload(ctx context.Context, bucket, key string, body io.ReadSeeker, contentType string) error
+	// Copy copies the object to the same key of another bucket, in the
+	// given storage class when it isn't empty.
+	Copy(ctx context.Context, bucket, key, destinationBucket, storageClass string) error
+	// Delete removes the object, an object which doesn't exist is not an
+	// error.
+	Delete(ctx context.Context, bucket, key string) error
+}
+
+// Object holds the attributes of a stored object. Metadata keys are
+// canonicalized like the S3 SDK does, e.g. "Preview-Start".
+type Object struct {
+	Size        int64
+	ContentType string
+	Metadata    map[string]string
+}
+
+// Config selects the backend the objects are kept in.
+type Config struct {
+	Backend string `env:"STORAGE" default:"s3" oneof:"s3 s3-compatible local"`
+
+	// s3-compatible, the endpoint of the store and its credentials. The
+	// credentials of the AWS session are used when no key is set.
+	Endpoint        string `env:"STORAGE_ENDPOINT"`
+	Region          string `env:"STORAGE_REGION" default:"us-east-1"`
+	AccessKeyID     string `env:"STORAGE_ACCESS_KEY_ID"`
+	SecretAccessKey string `env:"STORAGE_SECRET_ACCESS_KEY"`
+	PathStyle       bool   `env:"STORAGE_PATH_STYLE" default:"true"`
+
+	// local, the directory holding a directory per bucket
+	Root string `env:"STORAGE_ROOT"`
+}
+
+// New returns the storage of the configured backend. S3 is reached with the
+// AWS session.
+func New(sess *session.Session, cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case STORAGE_S3, "":
+		return NewS3Storage(sess), nil
+
+	case STORAGE_S3_COMPATIBLE:
+		if cfg.Endpoint == "" {
+			return nil, errors.New("STORAGE_ENDPOINT is not set")
+		}
+
+		return NewS3CompatibleStorage(sess, cfg), nil
+
+	case STORAGE_LOCAL:
+		if cfg.Root == "" {
+			return nil, errors.New("STORAGE_ROOT is not set")
+		}
+
+		return &FileStorage{Root: cfg.Root}, nil
+	}
+
+	return nil, fmt.Errorf("unknown storage %q", cfg.Backend)
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// s3Server answers every request as S3 would a successful HEAD, and records
+// the host, the path and the credential of the last one.
+type s3Server struct {
+	host, path, authorization string
+}
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.host, s.path, s.authorization = r.Host, r.URL.Path, r.Header.Get("Authorization")
+	w.Header().Set("Content-Length", "0")
+}
+
+// testSession returns a session whose requests are all sent to addr, so the
+// bucket hosts of virtual hosted requests reach it too.
+func testSession(t *testing.T, addr string) *session.Session {
+	dial := func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("ap-south-1"),
+		Credentials: credentials.NewStaticCredentials("SESSIONKEY", "secret", ""),
+		MaxRetries:  aws.Int(0),
+		HTTPClient:  &http.Client{Transport: &http.Transport{DialContext: dial}},
+	})
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+
+	return sess
+}
+
+func TestS3CompatibleStorage(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		host       string
+		path       string
+		credential string
+	}{
+		{
+			name:       "path style with its own key",
+			cfg:        Config{Region: "us-east-1", PathStyle: true, AccessKeyID: "MINIOKEY", SecretAccessKey: "minio"},
+			host:       "",
+			path:       "/videos/acme/source/a.mp4",
+			credential: "Credential=MINIOKEY/",
+		},
+		{
+			name:       "path style with the key of the session",
+			cfg:        Config{Region: "auto", PathStyle: true},
+			host:       "",
+			path:       "/videos/acme/source/a.mp4",
+			credential: "Credential=SESSIONKEY/",
+		},
+		{
+			name:       "virtual hosted style",
+			cfg:        Config{Region: "us-east-1", AccessKeyID: "MINIOKEY", SecretAccessKey: "minio"},
+			host:       "videos.",
+			path:       "/acme/source/a.mp4",
+			credential: "Credential=MINIOKEY/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &s3Server{}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			tt.cfg.Backend = STORAGE_S3_COMPATIBLE
+			tt.cfg.Endpoint = ts.URL
+			s, err := New(testSession(t, ts.Listener.Addr().String()), tt.cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			if _, err := s.Head(context.Background(), "videos", "acme/source/a.mp4"); err != nil {
+				t.Fatalf("Head() error = %v", err)
+			}
+
+			if host := tt.host + ts.Listener.Addr().String(); server.host != host {
+				t.Errorf("requested %s, want %s", server.host, host)
+			}
+			if server.path != tt.path {
+				t.Errorf("requested %s, want %s", server.path, tt.path)
+			}
+			if !strings.Contains(server.authorization, tt.credential) || !strings.Contains(server.authorization, "/"+tt.cfg.Region+"/s3/") {
+				t.Errorf("Authorization = %q, want %s in %s", server.authorization, tt.credential, tt.cfg.Region)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want string
+		err  string
+	}{
+		{Config{}, "*storage.S3Storage", ""},
+		{Config{Backend: STORAGE_S3}, "*storage.S3Storage", ""},
+		{Config{Backend: STORAGE_S3_COMPATIBLE, Endpoint: "http://localhost:9000"}, "*storage.S3Storage", ""},
+		{Config{Backend: STORAGE_S3_COMPATIBLE}, "", "STORAGE_ENDPOINT is not set"},
+		{Config{Backend: STORAGE_LOCAL, Root: "/var/lib/videos"}, "*storage.FileStorage", ""},
+		{Config{Backend: STORAGE_LOCAL}, "", "STORAGE_ROOT is not set"},
+		{Config{Backend: "gcs"}, "", `unknown storage "gcs"`},
+	}
+
+	for _, tt := range tests {
+		s, err := New(testSession(t, "localhost:0"), tt.cfg)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("New(%q) error = %v, want %q", tt.cfg.Backend, err, tt.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("New(%q) error = %v", tt.cfg.Backend, err)
+		} else if got := fmt.Sprintf("%T", s); got != tt.want {
+			t.Errorf("New(%q) = %s, want %s", tt.cfg.Backend, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package task
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/batch"
+	"github.com/aws/aws-sdk-go/service/batch/batchiface"
+)
+
+// Characters Batch doesn't allow in job names
+var invalidJobName = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Statuses of the jobs which haven't finished
+var activeJobStatuses = []string{
+	batch.JobStatusSubmitted,
+	batch.JobStatusPending,
+	batch.JobStatusRunnable,
+	batch.JobStatusStarting,
+	batch.JobStatusRunning,
+}
+
+type BatchConfig struct {
+	// The job queues must only be used by the transcoder, every job in
+	// them counts as a running task
+	JobQueue      string `env:"BATCH_JOB_QUEUE"`
+	JobDefinition string `env:"BATCH_JOB_DEFINITION"`
+
+	// Job queue of the classes running on spot capacity, JobQueue when empty
+	SpotJobQueue string `env:"BATCH_SPOT_JOB_QUEUE"`
+}
+
+// BatchLauncher submits the transcoder as an AWS Batch job. Task IDs are job
+// IDs.
+type BatchLauncher struct {
+	Batch  batchiface.BatchAPI
+	Config BatchConfig
+}
+
+func (l *BatchLauncher) Launch(spec Spec) (string, error) {
+	environment := []*batch.KeyValuePair{}
+	for _, name := range sortedEnvironment(spec.Environment) {
+		environment = append(environment, &batch.KeyValuePair{
+			Name:  aws.String(name),
+			Value: aws.String(spec.Environment[name]),
+		})
+	}
+
+	queue := l.Config.JobQueue
+	if spec.Class.CapacityProvider == CAPACITY_PROVIDER_FARGATE_SPOT && l.Config.SpotJobQueue != "" {
+		queue = l.Config.SpotJobQueue
+	}
+
+	name := invalidJobName.ReplaceAllString("transcode-"+spec.Key, "-")
+	if len(name) > 128 {
+		name = name[:128]
+	}
+
+	output, err := l.Batch.SubmitJob(&batch.SubmitJobInput{
+		JobName:       aws.String(name),
+		JobQueue:      aws.String(queue),
+		JobDefinition: aws.String(l.Config.JobDefinition),
+		ContainerOverrides: &batch.ContainerOverrides{
+			Environment: environment,
+			ResourceRequirements: []*batch.ResourceRequirement{
+				{
+					Type:  aws.String(batch.ResourceTypeVcpu),
+					Value: aws.String(vCPUs(spec.Class.CPU)),
+				},
+				{
+					Type:  aws.String(batch.ResourceTypeMemory),
+					Value: aws.String(spec.Class.Memory),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(output.JobId), nil
+}
+
+// Running counts the jobs of the job queues which haven't finished.
+func (l *BatchLauncher) Running() (int, error) {
+	queues := []string{l.Config.JobQueue}
+	if l.Config.SpotJobQueue != "" && l.Config.SpotJobQueue != l.Config.JobQueue {
+		queues = append(queues, l.Config.SpotJobQueue)
+	}
+
+	count := 0
+	for _, queue := range queues {
+		for _, status := range activeJobStatuses {
+			err := l.Batch.ListJobsPages(&batch.ListJobsInput{
+				JobQueue:  aws.String(queue),
+				JobStatus: aws.String(status),
+			}, func(page *batch.ListJobsOutput, lastPage bool) bool {
+				count += len(page.JobSummaryList)
+				return true
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return count, nil
+}
+
+func (l *BatchLauncher) Describe(id string) (*Status, error) {
+	output, err := l.Batch.DescribeJobs(&batch.DescribeJobsInput{
+		Jobs: []*string{aws.String(id)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(output.Jobs) == 0 {
+		return nil, ErrTaskNotFound
+	}
+
+	job := output.Jobs[0]
+	status := &Status{Launched: true}
+
+	switch aws.StringValue(job.Status) {
+	case batch.JobStatusSucceeded, batch.JobStatusFailed:
+		status.Stopped = true
+		status.Reason = aws.StringValue(job.StatusReason)
+		if c := job.Container; c != nil && aws.Int64Value(c.ExitCode) != 0 {
+			status.Reason = fmt.Sprintf("container exited with code %d", aws.Int64Value(c.ExitCode))
+		}
+	}
+
+	return status, nil
+}
+
+// Stop terminates the job, jobs which haven't started yet are cancelled.
+func (l *BatchLauncher) Stop(id string, reason string) error {
+	_, err := l.Batch.TerminateJob(&batch.TerminateJobInput{
+		JobId:  aws.String(id),
+		Reason: aws.String(reason),
+	})
+
+	return err
+}
+
+// vCPUs converts ECS CPU units to the vCPUs Batch expects.
+func vCPUs(units string) string {
+	n, err := strconv.Atoi(units)
+	if err != nil {
+		return units
+	}
+
+	return strconv.FormatFloat(float64(n)/1024, 'f', -1, 64)
+}
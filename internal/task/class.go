@@ -0,0 +1,85 @@
+package task
+
+import "sort"
+
+const (
+	CLASS_EXPRESS  = "express"
+	CLASS_STANDARD = "standard"
+	CLASS_BULK     = "bulk"
+
+	DEFAULT_CLASS = CLASS_STANDARD
+
+	CAPACITY_PROVIDER_FARGATE      = "FARGATE"
+	CAPACITY_PROVIDER_FARGATE_SPOT = "FARGATE_SPOT"
+)
+
+// Class is a scheduling class a video is uploaded with. It decides how
+// urgent the video's job is and the size and capacity of the task started
+// for it.
+type Class struct {
+	Name string
+
+	// Higher is more urgent, see queue.Queues
+	Priority int
+
+	// Task size, in CPU units and MiB. They must be a combination Fargate
+	// supports.
+	CPU    string
+	Memory string
+
+	// FARGATE_SPOT is cheaper, but the task may be stopped at any time and
+	// is retried like any other failed task
+	CapacityProvider string
+}
+
+var classes = map[string]Class{
+	CLASS_EXPRESS: {
+		Name:             CLASS_EXPRESS,
+		Priority:         2,
+		CPU:              "4096",
+		Memory:           "8192",
+		CapacityProvider: CAPACITY_PROVIDER_FARGATE,
+	},
+	CLASS_STANDARD: {
+		Name:             CLASS_STANDARD,
+		Priority:         1,
+		CPU:              "2048",
+		Memory:           "4096",
+		CapacityProvider: CAPACITY_PROVIDER_FARGATE,
+	},
+	CLASS_BULK: {
+		Name:             CLASS_BULK,
+		Priority:         0,
+		CPU:              "1024",
+		Memory:           "2048",
+		CapacityProvider: CAPACITY_PROVIDER_FARGATE_SPOT,
+	},
+}
+
+// GetClass returns the class called name.
+func GetClass(name string) (Class, bool) {
+	c, ok := classes[name]
+	return c, ok
+}
+
+// ClassOrDefault returns the class called name, or the default class for
+// names which aren't known, like the empty name of videos uploaded before
+// classes were introduced.
+func ClassOrDefault(name string) Class {
+	if c, ok := classes[name]; ok {
+		return c
+	}
+
+	return classes[DEFAULT_CLASS]
+}
+
+// ClassNames returns the names of every class, sorted.
+func ClassNames() []string {
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,140 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Variables of the launcher handed to the containers, which need them to
+// reach AWS
+var dockerForwardedEnvironment = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_REGION",
+	"AWS_ENDPOINT_URL",
+	"AWS_ENDPOINT_URL_S3",
+	"AWS_ENDPOINT_URL_DYNAMODB",
+	"AWS_ENDPOINT_URL_SQS",
+}
+
+type DockerConfig struct {
+	Image string `env:"DOCKER_IMAGE" default:"video-transcoding-image"`
+
+	// Network the containers join, "host" to reach stand-ins listening on
+	// localhost
+	Network string `env:"DOCKER_NETWORK"`
+}
+
+// DockerLauncher runs the transcoder image with the docker CLI of the
+// machine. Task IDs are container IDs. Stopped containers are kept for
+// their exit code, remove them with
+// docker container prune --filter label=video-transcoding-service.
+type DockerLauncher struct {
+	Config DockerConfig
+}
+
+func (l *DockerLauncher) Launch(spec Spec) (string, error) {
+	args := []string{"run", "--detach", "--label", STARTED_BY + "=" + spec.Class.Name}
+
+	if l.Config.Network != "" {
+		args = append(args, "--network", l.Config.Network)
+	}
+
+	if cpus := vCPUs(spec.Class.CPU); cpus != "" {
+		args = append(args, "--cpus", cpus)
+	}
+	if spec.Class.Memory != "" {
+		args = append(args, "--memory", spec.Class.Memory+"m")
+	}
+
+	for _, name := range dockerForwardedEnvironment {
+		if _, ok := spec.Environment[name]; !ok && os.Getenv(name) != "" {
+			// Without a value docker reads it from its own environment
+			args = append(args, "--env", name)
+		}
+	}
+	for _, name := range sortedEnvironment(spec.Environment) {
+		args = append(args, "--env", name+"="+spec.Environment[name])
+	}
+
+	args = append(args, l.Config.Image)
+
+	out, err := docker(args...)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+func (l *DockerLauncher) Running() (int, error) {
+	out, err := docker("ps", "--quiet", "--filter", "label="+STARTED_BY)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(strings.Fields(out)), nil
+}
+
+func (l *DockerLauncher) Describe(id string) (*Status, error) {
+	out, err := docker("inspect", "--format", "{{json .State}}", id)
+	if err != nil {
+		if strings.Contains(err.Error(), "No such object") {
+			return nil, ErrTaskNotFound
+		}
+		return nil, err
+	}
+
+	var state struct {
+		Status    string `json:"Status"`
+		ExitCode  int    `json:"ExitCode"`
+		Error     string `json:"Error"`
+		OOMKilled bool   `json:"OOMKilled"`
+	}
+	if err := json.Unmarshal([]byte(out), &state); err != nil {
+		return nil, fmt.Errorf("failed to decode state of container %s, %v", id, err)
+	}
+
+	status := &Status{Launched: true}
+	if state.Status == "exited" || state.Status == "dead" {
+		status.Stopped = true
+
+		switch {
+		case state.OOMKilled:
+			status.Reason = "container ran out of memory"
+		case state.Error != "":
+			status.Reason = state.Error
+		case state.ExitCode != 0:
+			status.Reason = "container exited with code " + strconv.Itoa(state.ExitCode)
+		}
+	}
+
+	return status, nil
+}
+
+// Stop sends SIGTERM to the container, and kills it if it is still running
+// after the same 30 seconds ECS waits for.
+func (l *DockerLauncher) Stop(id string, reason string) error {
+	_, err := docker("stop", "--time", "30", id)
+	return err
+}
+
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s failed, %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,134 @@
+package task
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+)
+
+type ECSConfig struct {
+	Cluster        string   `env:"ECS_CLUSTER"`
+	TaskDefinition string   `env:"ECS_TASK_DEFINITION"`
+	Subnets        []string `env:"ECS_SUBNETS"`
+}
+
+// ECSLauncher runs the transcoder as an ECS task on Fargate. Task IDs are
+// task ARNs.
+type ECSLauncher struct {
+	ECS    ecsiface.ECSAPI
+	Config ECSConfig
+}
+
+func (l *ECSLauncher) Launch(spec Spec) (string, error) {
+	environment := []*ecs.KeyValuePair{}
+	for _, name := range sortedEnvironment(spec.Environment) {
+		environment = append(environment, &ecs.KeyValuePair{
+			Name:  aws.String(name),
+			Value: aws.String(spec.Environment[name]),
+		})
+	}
+
+	output, err := l.ECS.RunTask(&ecs.RunTaskInput{
+		Cluster:        aws.String(l.Config.Cluster),
+		TaskDefinition: aws.String(l.Config.TaskDefinition),
+		// The cluster must have the FARGATE_SPOT capacity provider
+		// associated for the classes using it
+		CapacityProviderStrategy: []*ecs.CapacityProviderStrategyItem{
+			{
+				CapacityProvider: aws.String(spec.Class.CapacityProvider),
+				Weight:           aws.Int64(1),
+			},
+		},
+		Count:     aws.Int64(1),
+		StartedBy: aws.String(STARTED_BY),
+		NetworkConfiguration: &ecs.NetworkConfiguration{
+			AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
+				AssignPublicIp: aws.String("ENABLED"),
+				Subnets:        aws.StringSlice(l.Config.Subnets),
+			},
+		},
+		Overrides: &ecs.TaskOverride{
+			Cpu:    aws.String(spec.Class.CPU),
+			Memory: aws.String(spec.Class.Memory),
+			ContainerOverrides: []*ecs.ContainerOverride{
+				{
+					Name:        aws.String(CONTAINER_NAME),
+					Environment: environment,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(output.Failures) > 0 {
+		f := output.Failures[0]
+		return "", fmt.Errorf("failed to start task, %s: %s", aws.StringValue(f.Reason), aws.StringValue(f.Detail))
+	}
+
+	if len(output.Tasks) == 0 {
+		return "", fmt.Errorf("failed to start task, no task was returned")
+	}
+
+	return aws.StringValue(output.Tasks[0].TaskArn), nil
+}
+
+// Running counts the tasks in the cluster which were started by a launcher
+// and are starting or running.
+func (l *ECSLauncher) Running() (int, error) {
+	count := 0
+	err := l.ECS.ListTasksPages(&ecs.ListTasksInput{
+		Cluster:       aws.String(l.Config.Cluster),
+		StartedBy:     aws.String(STARTED_BY),
+		DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+	}, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		count += len(page.TaskArns)
+		return true
+	})
+
+	return count, err
+}
+
+func (l *ECSLauncher) Describe(id string) (*Status, error) {
+	output, err := l.ECS.DescribeTasks(&ecs.DescribeTasksInput{
+		Cluster: aws.String(l.Config.Cluster),
+		Tasks:   []*string{aws.String(id)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(output.Tasks) == 0 {
+		return nil, ErrTaskNotFound
+	}
+
+	t := output.Tasks[0]
+	status := &Status{
+		Stopped:  aws.StringValue(t.LastStatus) == ecs.DesiredStatusStopped,
+		Launched: aws.StringValue(t.StartedBy) == STARTED_BY,
+	}
+
+	if status.Stopped {
+		status.Reason = aws.StringValue(t.StoppedReason)
+		for _, c := range t.Containers {
+			if aws.StringValue(c.Name) == CONTAINER_NAME && aws.Int64Value(c.ExitCode) != 0 {
+				status.Reason = fmt.Sprintf("container exited with code %d", aws.Int64Value(c.ExitCode))
+			}
+		}
+	}
+
+	return status, nil
+}
+
+func (l *ECSLauncher) Stop(id string, reason string) error {
+	_, err := l.ECS.StopTask(&ecs.StopTaskInput{
+		Cluster: aws.String(l.Config.Cluster),
+		Task:    aws.String(id),
+		Reason:  aws.String(reason),
+	})
+
+	return err
+}
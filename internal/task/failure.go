@@ -0,0 +1,109 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/eventbus"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+	"github.com/thegeorgenikhil/video-transcoding-service/videoevents"
+)
+
+// FailureRecorder decides what happens to a video whose task failed: its job
+// is queued again, delayed by the retry policy, while it has attempts left,
+// and it is failed with a dead letter record otherwise, publishing a
+// TranscodeFailed to Events when it is set.
+type FailureRecorder struct {
+	Videos      video.VideoRepository
+	DeadLetters video.DeadLetterRepository
+	Queues      queue.Queues
+	Policy      RetryPolicy
+	Events      eventbus.Publisher
+}
+
+// Record records the failure of attempt number attempts of the video. It
+// only applies while the video is still worked on by the job of v, a job
+// handed to another attempt in the meantime is left alone.
+func (r *FailureRecorder) Record(v video.Video, attempts int, reason string) error {
+	if r.Policy.ShouldRetry(attempts) {
+		err := r.Videos.Update(v.Key, video.Update{
+			Status:      video.STATUS_QUEUED,
+			Attempts:    attempts,
+			LastError:   reason,
+			NextRetryAt: r.Policy.NextRetryAt(attempts, time.Now()),
+			ForJob:      v.JobID,
+		})
+		if err == video.ErrInvalidTransition {
+			// Cancelled, finished or retried in the meantime
+			return nil
+		}
+		if err != nil {
+			slog.Error("failed to queue retry", logging.VIDEO_KEY, v.Key, logging.ERROR, err)
+			return err
+		}
+
+		job := queue.Job{
+			Key:      v.Key,
+			Bucket:   v.SourceBucket,
+			Tenant:   v.Tenant,
+			Class:    v.Class,
+			Priority: v.Priority,
+			Attempt:  attempts + 1,
+			Profiles: v.Profiles,
+			Version:  v.OutputVersion,
+		}
+		if err := r.Queues.For(v.Priority).Enqueue(job, r.Policy.Delay(attempts)); err != nil {
+			slog.Error("failed to enqueue retry", logging.VIDEO_KEY, v.Key, logging.ERROR, err)
+			return err
+		}
+
+		slog.Info("attempt failed, retrying", logging.VIDEO_KEY, v.Key, logging.ATTEMPT, attempts, "reason", reason)
+		return nil
+	}
+
+	err := r.Videos.Update(v.Key, video.Update{
+		Status:        video.STATUS_FAILED,
+		Attempts:      attempts,
+		LastError:     reason,
+		FailureReason: fmt.Sprintf("gave up after %d attempts, %s", attempts, reason),
+		ForJob:        v.JobID,
+	})
+	if err == video.ErrInvalidTransition {
+		return nil
+	}
+	if err != nil {
+		slog.Error("failed to mark video as failed", logging.VIDEO_KEY, v.Key, logging.ERROR, err)
+		return err
+	}
+
+	err = r.DeadLetters.Put(video.DeadLetter{
+		Key:          v.Key,
+		FailedAt:     time.Now().Format(time.RFC3339),
+		Attempts:     attempts,
+		LastError:    reason,
+		TaskArn:      v.TaskArn,
+		SourceBucket: v.SourceBucket,
+	})
+	if err != nil {
+		slog.Error("failed to write dead letter", logging.VIDEO_KEY, v.Key, logging.ERROR, err)
+		return err
+	}
+
+	slog.Warn("attempt failed, giving up", logging.VIDEO_KEY, v.Key, logging.ATTEMPT, attempts, "reason", reason)
+
+	if r.Events != nil {
+		eventbus.Publish(context.Background(), r.Events, slog.Default().With(logging.VIDEO_KEY, v.Key), videoevents.TranscodeFailed{
+			VideoKey: v.Key,
+			JobID:    v.JobID,
+			Reason:   videoevents.REASON_ATTEMPTS_EXHAUSTED,
+			Message:  reason,
+			Attempts: attempts,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/eventbus"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+	"github.com/thegeorgenikhil/video-transcoding-service/videoevents"
+)
+
+func TestRecordRetriesUntilTheAttemptsRunOut(t *testing.T) {
+	videos := video.NewMemoryRepository()
+	deadLetters := &video.MemoryDeadLetterRepository{}
+	q := queue.NewMemoryQueue("standard")
+	events := eventbus.NewMemoryPublisher()
+
+	r := &FailureRecorder{
+		Videos:      videos,
+		DeadLetters: deadLetters,
+		Queues:      queue.Queues{q},
+		Policy:      RetryPolicy{MaxAttempts: 2},
+		Events:      events,
+	}
+
+	v := video.Video{Key: "id/source/video.mp4", Status: video.STATUS_PROCESSING, JobID: "job-1", SourceBucket: "temp"}
+	videos.Put(v)
+
+	if err := r.Record(v, 1, "task stopped"); err != nil {
+		t.Fatalf("first Record() error = %v", err)
+	}
+
+	stored, _ := videos.Get(v.Key)
+	if stored.Status != video.STATUS_QUEUED || stored.NextRetryAt == "" {
+		t.Errorf("video is %s with next retry %q, want queued for a retry", stored.Status, stored.NextRetryAt)
+	}
+	if depth, _ := q.Depth(); depth != 1 {
+		t.Errorf("queue depth = %d, want the retry", depth)
+	}
+	if envelopes := events.Envelopes(); len(envelopes) != 0 {
+		t.Errorf("published %+v for a retried attempt", envelopes)
+	}
+
+	videos.Update(v.Key, video.Update{Status: video.STATUS_PROCESSING})
+	if err := r.Record(v, 2, "task stopped again"); err != nil {
+		t.Fatalf("second Record() error = %v", err)
+	}
+
+	stored, _ = videos.Get(v.Key)
+	if stored.Status != video.STATUS_FAILED {
+		t.Errorf("video is %s, want failed once the attempts ran out", stored.Status)
+	}
+	if len(deadLetters.DeadLetters) != 1 || deadLetters.DeadLetters[0].LastError != "task stopped again" {
+		t.Errorf("dead letters = %+v, want the last failure", deadLetters.DeadLetters)
+	}
+
+	envelopes := events.Envelopes()
+	if len(envelopes) != 1 {
+		t.Fatalf("published %d events, want a TranscodeFailed", len(envelopes))
+	}
+
+	event, err := envelopes[0].Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed, ok := event.(*videoevents.TranscodeFailed)
+	if !ok || failed.VideoKey != v.Key || failed.JobID != "job-1" || failed.Reason != videoevents.REASON_ATTEMPTS_EXHAUSTED || failed.Attempts != 2 {
+		t.Errorf("published %+v, want the attempts of the video exhausted", event)
+	}
+}
+
+func TestRecordLeavesTheAttemptWhichReplacedTheJob(t *testing.T) {
+	videos := video.NewMemoryRepository()
+	q := queue.NewMemoryQueue("standard")
+
+	r := &FailureRecorder{
+		Videos:      videos,
+		DeadLetters: &video.MemoryDeadLetterRepository{},
+		Queues:      queue.Queues{q},
+		Policy:      RetryPolicy{MaxAttempts: 3},
+	}
+
+	// The reaper queued a second attempt, which started on job-2, while
+	// the worker of job-1 was still going
+	videos.Put(video.Video{Key: "key", Status: video.STATUS_PROCESSING, JobID: "job-2", Attempts: 2})
+
+	if err := r.Record(video.Video{Key: "key", JobID: "job-1"}, 1, "ffmpeg failed"); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	if v, _ := videos.Get("key"); v.Status != video.STATUS_PROCESSING || v.Attempts != 2 || v.LastError != "" {
+		t.Errorf("video is %s after %d attempts with %q, want the second attempt left alone", v.Status, v.Attempts, v.LastError)
+	}
+	if depth, _ := q.Depth(); depth != 0 {
+		t.Errorf("queue depth = %d, want no retry of the replaced job", depth)
+	}
+}
@@ -0,0 +1,292 @@
+package task
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Label set on the jobs we start, to tell them apart from others
+	KUBERNETES_LABEL = "app.kubernetes.io/managed-by"
+
+	// Credentials of the service account of the pod, used when running in
+	// the cluster
+	SERVICE_ACCOUNT_TOKEN_FILE = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	SERVICE_ACCOUNT_CA_FILE    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+
+	// How long finished jobs are kept for their status
+	KUBERNETES_JOB_TTL_SECONDS = 24 * 60 * 60
+)
+
+type KubernetesConfig struct {
+	// API server and the bearer token and CA certificate (PEM) to reach it.
+	// The ones of the service account are used when running in the cluster.
+	API    string `env:"KUBERNETES_API_URL"`
+	Token  string `env:"KUBERNETES_TOKEN"`
+	CACert string `env:"KUBERNETES_CA_CERT"`
+
+	Namespace string `env:"KUBERNETES_NAMESPACE" default:"default"`
+	Image     string `env:"KUBERNETES_IMAGE"`
+
+	// Service account of the pods, which needs access to the buckets and
+	// tables, e.g. through IAM roles for service accounts on EKS
+	ServiceAccount string `env:"KUBERNETES_SERVICE_ACCOUNT"`
+}
+
+// KubernetesLauncher runs the transcoder as a Kubernetes Job, talking to the
+// API server directly. Task IDs are job names.
+type KubernetesLauncher struct {
+	Config KubernetesConfig
+	Client *http.Client
+}
+
+// NewKubernetesLauncher returns a launcher for the configured API server, or
+// the one of the cluster it runs in.
+func NewKubernetesLauncher(cfg KubernetesConfig) (*KubernetesLauncher, error) {
+	if cfg.API == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, errors.New("KUBERNETES_API_URL is not set")
+		}
+
+		cfg.API = "https://" + host + ":" + port
+	}
+
+	if cfg.Token == "" {
+		token, err := os.ReadFile(SERVICE_ACCOUNT_TOKEN_FILE)
+		if err != nil {
+			return nil, fmt.Errorf("KUBERNETES_TOKEN is not set and there is no service account token, %v", err)
+		}
+
+		cfg.Token = strings.TrimSpace(string(token))
+	}
+
+	if cfg.CACert == "" {
+		if ca, err := os.ReadFile(SERVICE_ACCOUNT_CA_FILE); err == nil {
+			cfg.CACert = string(ca)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(cfg.CACert)) {
+			return nil, errors.New("KUBERNETES_CA_CERT holds no PEM certificate")
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &KubernetesLauncher{
+		Config: cfg,
+		Client: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// kubernetesJob is the part of a batch/v1 Job we read.
+type kubernetesJob struct {
+	Metadata struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Status struct {
+		Active     int `json:"active"`
+		Succeeded  int `json:"succeeded"`
+		Failed     int `json:"failed"`
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// finished returns whether the job completed or failed, and the reason it
+// failed for.
+func (j kubernetesJob) finished() (bool, string) {
+	for _, c := range j.Status.Conditions {
+		if c.Status != "True" {
+			continue
+		}
+
+		switch c.Type {
+		case "Complete":
+			return true, ""
+		case "Failed":
+			return true, strings.TrimSpace(c.Reason + " " + c.Message)
+		}
+	}
+
+	return false, ""
+}
+
+func (l *KubernetesLauncher) Launch(spec Spec) (string, error) {
+	env := []map[string]string{}
+	for _, name := range sortedEnvironment(spec.Environment) {
+		env = append(env, map[string]string{"name": name, "value": spec.Environment[name]})
+	}
+
+	resources := map[string]string{"memory": spec.Class.Memory + "Mi"}
+	if n, err := strconv.Atoi(spec.Class.CPU); err == nil {
+		// 1024 ECS CPU units are a core
+		resources["cpu"] = strconv.Itoa(n*1000/1024) + "m"
+	}
+
+	labels := map[string]string{KUBERNETES_LABEL: STARTED_BY, STARTED_BY + "/class": spec.Class.Name}
+
+	podSpec := map[string]interface{}{
+		"restartPolicy": "Never",
+		"containers": []map[string]interface{}{
+			{
+				"name":  CONTAINER_NAME,
+				"image": l.Config.Image,
+				"env":   env,
+				"resources": map[string]interface{}{
+					"requests": resources,
+					"limits":   resources,
+				},
+			},
+		},
+	}
+	if l.Config.ServiceAccount != "" {
+		podSpec["serviceAccountName"] = l.Config.ServiceAccount
+	}
+
+	manifest := map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"generateName": "transcode-",
+			"labels":       labels,
+		},
+		"spec": map[string]interface{}{
+			// Retries are up to the retry policy, like on the other backends
+			"backoffLimit":            0,
+			"ttlSecondsAfterFinished": KUBERNETES_JOB_TTL_SECONDS,
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels},
+				"spec":     podSpec,
+			},
+		},
+	}
+
+	var job kubernetesJob
+	if err := l.do(http.MethodPost, l.jobsPath(), manifest, &job); err != nil {
+		return "", err
+	}
+
+	return job.Metadata.Name, nil
+}
+
+func (l *KubernetesLauncher) Running() (int, error) {
+	var list struct {
+		Items []kubernetesJob `json:"items"`
+	}
+
+	selector := url.Values{"labelSelector": {KUBERNETES_LABEL + "=" + STARTED_BY}}
+	if err := l.do(http.MethodGet, l.jobsPath()+"?"+selector.Encode(), nil, &list); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, job := range list.Items {
+		if done, _ := job.finished(); !done {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (l *KubernetesLauncher) Describe(id string) (*Status, error) {
+	var job kubernetesJob
+	if err := l.do(http.MethodGet, l.jobsPath()+"/"+url.PathEscape(id), nil, &job); err != nil {
+		return nil, err
+	}
+
+	done, reason := job.finished()
+
+	return &Status{
+		Stopped:  done,
+		Reason:   reason,
+		Launched: job.Metadata.Labels[KUBERNETES_LABEL] == STARTED_BY,
+	}, nil
+}
+
+// Stop deletes the job, whose pod gets SIGTERM and its grace period to stop.
+// The job is gone afterwards, Describe returns ErrTaskNotFound for it.
+func (l *KubernetesLauncher) Stop(id string, reason string) error {
+	options := map[string]string{"propagationPolicy": "Background"}
+
+	err := l.do(http.MethodDelete, l.jobsPath()+"/"+url.PathEscape(id), options, nil)
+	if err == ErrTaskNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (l *KubernetesLauncher) jobsPath() string {
+	return "/apis/batch/v1/namespaces/" + url.PathEscape(l.Config.Namespace) + "/jobs"
+}
+
+// do sends a request to the API server, decoding the response into out.
+func (l *KubernetesLauncher) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(l.Config.API, "/")+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+l.Config.Token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := l.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// A job which doesn't exist, rather than a namespace
+	if resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, l.jobsPath()+"/") {
+		return ErrTaskNotFound
+	}
+
+	if resp.StatusCode >= 300 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&status)
+
+		return fmt.Errorf("kubernetes API answered %s to %s %s, %s", resp.Status, method, path, status.Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,149 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/batch"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+const (
+	LAUNCHER_ECS        = "ecs"
+	LAUNCHER_BATCH      = "batch"
+	LAUNCHER_DOCKER     = "docker"
+	LAUNCHER_PROCESS    = "process"
+	LAUNCHER_KUBERNETES = "kubernetes"
+)
+
+// ErrTaskNotFound is returned for tasks the backend doesn't know of, or no
+// longer does.
+var ErrTaskNotFound = errors.New("task not found")
+
+// Launcher runs the transcoder on a compute backend. The ID of a task is
+// recorded on the video it works on as its TaskArn.
+type Launcher interface {
+	// Launch starts a task and returns its ID.
+	Launch(spec Spec) (string, error)
+	// Running returns the number of tasks started by the launcher which
+	// are starting or running.
+	Running() (int, error)
+	// Describe returns the state of a task, or ErrTaskNotFound.
+	Describe(id string) (*Status, error)
+	// Stop asks a task to stop, which gives the transcoder the chance to
+	// finish an upload it is in the middle of.
+	Stop(id string, reason string) error
+}
+
+// Spec is the transcoder a task runs.
+type Spec struct {
+	// Key of the video, for naming the task where the backend allows it
+	Key string
+
+	// Size and capacity of the task
+	Class Class
+
+	// Variables set on the transcoder
+	Environment map[string]string
+}
+
+// Status is the state of a task.
+type Status struct {
+	Stopped bool
+
+	// Why the task stopped, when it did
+	Reason string
+
+	// Whether the task was started by a launcher. The tasks of the queue
+	// workers are not, they run as a service.
+	Launched bool
+}
+
+// LauncherConfig selects the backend the transcoder runs on. Only the
+// settings of the selected backend are used.
+type LauncherConfig struct {
+	Backend string `env:"LAUNCHER" default:"ecs" oneof:"ecs batch docker process kubernetes"`
+
+	ECS        ECSConfig
+	Batch      BatchConfig
+	Docker     DockerConfig
+	Process    ProcessConfig
+	Kubernetes KubernetesConfig
+}
+
+// NewLauncher returns the launcher of the configured backend. The settings
+// needed to find the tasks are checked, ValidateLaunch checks the ones only
+// needed to start them.
+func NewLauncher(sess *session.Session, cfg LauncherConfig) (Launcher, error) {
+	switch cfg.Backend {
+	case LAUNCHER_ECS, "":
+		if cfg.ECS.Cluster == "" {
+			return nil, errors.New("ECS_CLUSTER is not set")
+		}
+
+		return &ECSLauncher{ECS: ecs.New(sess), Config: cfg.ECS}, nil
+
+	case LAUNCHER_BATCH:
+		if cfg.Batch.JobQueue == "" {
+			return nil, errors.New("BATCH_JOB_QUEUE is not set")
+		}
+
+		return &BatchLauncher{Batch: batch.New(sess), Config: cfg.Batch}, nil
+
+	case LAUNCHER_DOCKER:
+		return &DockerLauncher{Config: cfg.Docker}, nil
+
+	case LAUNCHER_PROCESS:
+		return &ProcessLauncher{Config: cfg.Process}, nil
+
+	case LAUNCHER_KUBERNETES:
+		return NewKubernetesLauncher(cfg.Kubernetes)
+	}
+
+	return nil, fmt.Errorf("unknown launcher %q", cfg.Backend)
+}
+
+// ValidateLaunch returns the settings the configured backend is missing to
+// start tasks.
+func (cfg LauncherConfig) ValidateLaunch() error {
+	var missing []string
+	check := func(name, value string) {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	switch cfg.Backend {
+	case LAUNCHER_ECS, "":
+		check("ECS_TASK_DEFINITION", cfg.ECS.TaskDefinition)
+		if len(cfg.ECS.Subnets) == 0 {
+			missing = append(missing, "ECS_SUBNETS")
+		}
+	case LAUNCHER_BATCH:
+		check("BATCH_JOB_DEFINITION", cfg.Batch.JobDefinition)
+	case LAUNCHER_PROCESS:
+		check("LAUNCHER_PROCESS_BINARY", cfg.Process.Binary)
+	case LAUNCHER_KUBERNETES:
+		check("KUBERNETES_IMAGE", cfg.Kubernetes.Image)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%s must be set to launch tasks on %s", strings.Join(missing, ", "), cfg.Backend)
+	}
+
+	return nil
+}
+
+// sortedEnvironment returns the names of the variables in a stable order.
+func sortedEnvironment(environment map[string]string) []string {
+	names := make([]string, 0, len(environment))
+	for name := range environment {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
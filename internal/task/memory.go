@@ -0,0 +1,106 @@
+package task
+
+import (
+	"strconv"
+	"sync"
+)
+
+// MemoryLauncher records the tasks it is asked to launch without running
+// anything. It is meant for tests of the code launching and stopping tasks.
+type MemoryLauncher struct {
+	// Returned by Launch when set, to test failures to start a task
+	Err error
+
+	tasks    map[string]*Status
+	launched []Spec
+	sync.Mutex
+}
+
+func NewMemoryLauncher() *MemoryLauncher {
+	return &MemoryLauncher{tasks: make(map[string]*Status)}
+}
+
+func (l *MemoryLauncher) Launch(spec Spec) (string, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.Err != nil {
+		return "", l.Err
+	}
+
+	l.launched = append(l.launched, spec)
+
+	id := "task-" + strconv.Itoa(len(l.launched))
+	l.tasks[id] = &Status{Launched: true}
+
+	return id, nil
+}
+
+func (l *MemoryLauncher) Running() (int, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	count := 0
+	for _, status := range l.tasks {
+		if status.Launched && !status.Stopped {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (l *MemoryLauncher) Describe(id string) (*Status, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	status, ok := l.tasks[id]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+
+	s := *status
+	return &s, nil
+}
+
+func (l *MemoryLauncher) Stop(id string, reason string) error {
+	return l.Exit(id, reason)
+}
+
+// Exit marks a task stopped, as if the transcoder exited.
+func (l *MemoryLauncher) Exit(id string, reason string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	status, ok := l.tasks[id]
+	if !ok {
+		return ErrTaskNotFound
+	}
+
+	if !status.Stopped {
+		status.Stopped = true
+		status.Reason = reason
+	}
+
+	return nil
+}
+
+// AddWorker adds a running task which the launcher didn't start, like the
+// tasks of the queue workers, and returns its ID.
+func (l *MemoryLauncher) AddWorker() string {
+	l.Lock()
+	defer l.Unlock()
+
+	id := "worker-" + strconv.Itoa(len(l.tasks)+1)
+	l.tasks[id] = &Status{}
+
+	return id
+}
+
+// Launched returns the specs of every task launched so far.
+func (l *MemoryLauncher) Launched() []Spec {
+	l.Lock()
+	defer l.Unlock()
+
+	return append([]Spec{}, l.launched...)
+}
@@ -0,0 +1,213 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+)
+
+type ProcessConfig struct {
+	// Transcoder binary, built from transcoding-image-for-ecs
+	Binary string `env:"LAUNCHER_PROCESS_BINARY"`
+
+	// Directory the state of the processes is kept in, which lets the
+	// Lambdas of the machine find the processes another one started
+	StateDir string `env:"LAUNCHER_PROCESS_STATE_DIR"`
+}
+
+// ProcessLauncher runs the transcoder as a process of the local machine, for
+// development, see local-harness. The processes inherit the environment of
+// the launcher and are only noticed to exit while it runs. Task IDs are of
+// the form <started at>-<pid>.
+type ProcessLauncher struct {
+	Config ProcessConfig
+}
+
+// State files of a process, <id>.pid is written when it is started,
+// <id>.exit when it exited and <id>.stop when it was asked to stop
+const (
+	PID_SUFFIX  = ".pid"
+	EXIT_SUFFIX = ".exit"
+	STOP_SUFFIX = ".stop"
+)
+
+func (l *ProcessLauncher) stateDir() string {
+	if l.Config.StateDir != "" {
+		return l.Config.StateDir
+	}
+
+	return filepath.Join(os.TempDir(), "video-transcoding-tasks")
+}
+
+func (l *ProcessLauncher) Launch(spec Spec) (string, error) {
+	if err := os.MkdirAll(l.stateDir(), 0755); err != nil {
+		return "", err
+	}
+
+	// The transcoder works in its current directory
+	dir, err := os.MkdirTemp("", "transcoder")
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(l.Config.Binary)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for _, name := range sortedEnvironment(spec.Environment) {
+		cmd.Env = append(cmd.Env, name+"="+spec.Environment[name])
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to start %s, %v", l.Config.Binary, err)
+	}
+
+	id := fmt.Sprintf("%d-%d", time.Now().UnixNano(), cmd.Process.Pid)
+	if err := l.write(id, PID_SUFFIX, strconv.Itoa(cmd.Process.Pid)); err != nil {
+		cmd.Process.Kill()
+		return "", err
+	}
+
+	go func() {
+		cmd.Wait()
+		os.RemoveAll(dir)
+
+		if err := l.write(id, EXIT_SUFFIX, strconv.Itoa(cmd.ProcessState.ExitCode())); err != nil {
+			slog.Error("failed to record exit of task", logging.TASK_ID, id, logging.ERROR, err)
+		}
+	}()
+
+	return id, nil
+}
+
+func (l *ProcessLauncher) Running() (int, error) {
+	entries, err := os.ReadDir(l.stateDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), PID_SUFFIX)
+		if !ok {
+			continue
+		}
+
+		status, err := l.Describe(id)
+		if err != nil {
+			return 0, err
+		}
+
+		if !status.Stopped {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (l *ProcessLauncher) Describe(id string) (*Status, error) {
+	pid, err := l.read(id, PID_SUFFIX)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Launched: true}
+
+	code, err := l.read(id, EXIT_SUFFIX)
+	switch {
+	case err == nil:
+		status.Stopped = true
+		if code != "0" {
+			status.Reason = "process exited with code " + code
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	case !isAlive(pid):
+		status.Stopped = true
+		status.Reason = "process exited while its launcher wasn't running"
+	}
+
+	if reason, err := l.read(id, STOP_SUFFIX); err == nil && status.Stopped {
+		status.Reason = reason
+	}
+
+	return status, nil
+}
+
+// Stop sends SIGTERM to the process.
+func (l *ProcessLauncher) Stop(id string, reason string) error {
+	status, err := l.Describe(id)
+	if err != nil {
+		return err
+	}
+
+	if status.Stopped {
+		return nil
+	}
+
+	if err := l.write(id, STOP_SUFFIX, reason); err != nil {
+		return err
+	}
+
+	pid, err := l.read(id, PID_SUFFIX)
+	if err != nil {
+		return err
+	}
+
+	n, err := strconv.Atoi(pid)
+	if err != nil {
+		return fmt.Errorf("invalid pid %q of task %s", pid, id)
+	}
+
+	p, err := os.FindProcess(n)
+	if err != nil {
+		return err
+	}
+
+	return p.Signal(syscall.SIGTERM)
+}
+
+func (l *ProcessLauncher) write(id, suffix, content string) error {
+	return os.WriteFile(filepath.Join(l.stateDir(), id+suffix), []byte(content), 0644)
+}
+
+func (l *ProcessLauncher) read(id, suffix string) (string, error) {
+	if strings.ContainsAny(id, `/\`) {
+		return "", os.ErrNotExist
+	}
+
+	b, err := os.ReadFile(filepath.Join(l.stateDir(), id+suffix))
+	return string(b), err
+}
+
+func isAlive(pid string) bool {
+	n, err := strconv.Atoi(pid)
+	if err != nil {
+		return false
+	}
+
+	p, err := os.FindProcess(n)
+	if err != nil {
+		return false
+	}
+
+	return p.Signal(syscall.Signal(0)) == nil
+}
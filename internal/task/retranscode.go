@@ -0,0 +1,74 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/profile"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/tracing"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// Retranscode queues a new job for a completed or failed video, producing
+// the renditions named by profiles, or every rendition when none are given.
+// The outputs are written under the next version, the video keeps pointing
+// to the current ones until the job completes. It returns that version, or
+// video.ErrInvalidTransition when the video is being worked on. The job
+// continues the trace of ctx.
+func Retranscode(ctx context.Context, videos video.VideoRepository, queues queue.Queues, v video.Video, profiles []string) (int, error) {
+	if _, err := profile.Select(profiles); err != nil {
+		return 0, err
+	}
+
+	if v.SourceBucket == "" {
+		return 0, ErrSourceMissing
+	}
+
+	version := v.OutputVersion + 1
+	if version < 2 {
+		// Version 1 are the outputs of the first transcode
+		version = 2
+	}
+
+	err := videos.Update(v.Key, video.Update{
+		Status:        video.STATUS_QUEUED,
+		OutputVersion: version,
+		Profiles:      profiles,
+		Reset:         true,
+		From:          []video.Status{video.STATUS_COMPLETED, video.STATUS_FAILED},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	job := queue.Job{
+		Key:      v.Key,
+		Bucket:   v.SourceBucket,
+		Tenant:   v.Tenant,
+		Class:    v.Class,
+		Priority: v.Priority,
+		Attempt:  1,
+		Profiles: profiles,
+		Version:  version,
+
+		TraceParent: tracing.Inject(ctx),
+	}
+	if err := queues.For(v.Priority).Enqueue(job, 0); err != nil {
+		// Nothing would pick the queued video up, fail it so it can be
+		// re-transcoded again
+		failErr := videos.Update(v.Key, video.Update{
+			Status:        video.STATUS_FAILED,
+			FailureReason: fmt.Sprintf("failed to queue the re-transcode, %v", err),
+		})
+		if failErr != nil {
+			slog.Error("failed to mark video as failed", logging.VIDEO_KEY, v.Key, logging.ERROR, failErr)
+		}
+
+		return 0, err
+	}
+
+	return version, nil
+}
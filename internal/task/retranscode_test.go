@@ -0,0 +1,64 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+func TestRetranscodeOnlyStartsFromFinishedJobs(t *testing.T) {
+	tests := []struct {
+		status video.Status
+		err    error
+	}{
+		{video.STATUS_COMPLETED, nil},
+		{video.STATUS_FAILED, nil},
+		{video.STATUS_UPLOADED, video.ErrInvalidTransition},
+		{video.STATUS_QUEUED, video.ErrInvalidTransition},
+		{video.STATUS_PROCESSING, video.ErrInvalidTransition},
+		{video.STATUS_UPLOADING, video.ErrInvalidTransition},
+		{video.STATUS_CANCELLED, video.ErrInvalidTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			videos := video.NewMemoryRepository()
+			q := queue.NewMemoryQueue("standard")
+
+			v := video.Video{Key: "id/source/video.mp4", Status: tt.status, SourceBucket: "temp", OutputVersion: 1}
+			if err := videos.Put(v); err != nil {
+				t.Fatal(err)
+			}
+
+			version, err := Retranscode(context.Background(), videos, queue.Queues{q}, v, nil)
+			if err != tt.err {
+				t.Fatalf("Retranscode() error = %v, want %v", err, tt.err)
+			}
+
+			depth, _ := q.Depth()
+			stored, _ := videos.Get(v.Key)
+
+			if tt.err != nil {
+				if depth != 0 {
+					t.Errorf("queued %d jobs for a refused re-transcode", depth)
+				}
+				if stored.Status != tt.status || stored.OutputVersion != 1 {
+					t.Errorf("refused re-transcode changed the video to %s, version %d", stored.Status, stored.OutputVersion)
+				}
+				return
+			}
+
+			if version != 2 || stored.OutputVersion != 2 || stored.Status != video.STATUS_QUEUED {
+				t.Errorf("got version %d, video %s with version %d, want version 2 queued", version, stored.Status, stored.OutputVersion)
+			}
+
+			messages, _ := q.Receive(10, time.Millisecond)
+			if len(messages) != 1 || messages[0].Job.Version != 2 {
+				t.Errorf("queued %+v, want one job for version 2", messages)
+			}
+		})
+	}
+}
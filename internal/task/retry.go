@@ -0,0 +1,39 @@
+package task
+
+import "time"
+
+const MAX_RETRY_DELAY = 15 * time.Minute
+
+// RetryPolicy decides whether, and when, a failed transcoding task is
+// started again.
+type RetryPolicy struct {
+	MaxAttempts int           `env:"MAX_ATTEMPTS" default:"3" min:"1"`
+	BaseDelay   time.Duration `env:"RETRY_BASE_DELAY_SECONDS" default:"30" unit:"seconds" min:"0"`
+}
+
+// ShouldRetry reports whether another attempt is allowed after attempts
+// tasks have been started.
+func (p RetryPolicy) ShouldRetry(attempts int) bool {
+	return attempts < p.MaxAttempts
+}
+
+// Delay returns how long to wait before starting the next task, doubling
+// with every attempt made so far.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < MAX_RETRY_DELAY; i++ {
+		delay *= 2
+	}
+
+	if delay > MAX_RETRY_DELAY {
+		delay = MAX_RETRY_DELAY
+	}
+
+	return delay
+}
+
+// NextRetryAt returns the time the next attempt is due, formatted the way it
+// is stored on the video.
+func (p RetryPolicy) NextRetryAt(attempts int, now time.Time) string {
+	return now.Add(p.Delay(attempts)).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,152 @@
+// Package task starts the transcoding container, on ECS or on one of the
+// other backends a Launcher runs it on.
+package task
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+const (
+	CONTAINER_NAME = "video-transcoding-image"
+
+	// Set on every task we start, to tell them apart from other tasks in
+	// the cluster
+	STARTED_BY = "video-transcoding-service"
+)
+
+// ErrSourceMissing is returned for videos whose source isn't known, which
+// predate sources being recorded on the video.
+var ErrSourceMissing = errors.New("the source of the video is not known")
+
+// Environment variables of the Lambda that are handed to the container as is.
+var passthroughEnvironment = []string{
+	"MAX_DURATION_SECONDS",
+	"MAX_WIDTH",
+	"MAX_HEIGHT",
+	"RETAINED_BUCKET_NAME",
+	"SOURCE_RETENTION",
+	"SOURCE_ARCHIVE_STORAGE_CLASS",
+	"OUTPUT_TTL_DAYS",
+
+	// The task sends its spans where the dispatcher does
+	"OTEL_TRACES_EXPORTER",
+	"OTEL_EXPORTER_OTLP_ENDPOINT",
+	"OTEL_TRACES_SAMPLER_ARG",
+
+	// The task publishes its events where the dispatcher does
+	"EVENTS",
+	"EVENTS_BUS_NAME",
+	"EVENTS_SOURCE",
+	"EVENTS_TOPIC_ARN",
+}
+
+type Config struct {
+	OutputBucketName string `env:"OUTPUT_BUCKET_NAME" required:"true"`
+
+	// Region of the buckets, the transcoder uses config.DEFAULT_REGION when
+	// it is empty
+	Region string `env:"BUCKET_REGION"`
+
+	// Extra environment variables set on the container
+	Environment map[string]string
+}
+
+// PassthroughEnvironment returns the settings of the transcoder found in the
+// environment of the Lambda starting the task, which are handed to the
+// container as they are.
+func PassthroughEnvironment() map[string]string {
+	environment := map[string]string{}
+	for _, name := range passthroughEnvironment {
+		if value := os.Getenv(name); value != "" {
+			environment[name] = value
+		}
+	}
+
+	return environment
+}
+
+// Job is the video a task transcodes.
+type Job struct {
+	// ID of the queued job, see queue.Job
+	ID     string
+	Bucket string
+	Key    string
+
+	// Name of the scheduling class, the default class is used when empty
+	Class string
+
+	// The renditions to produce, every profile when empty, and the version
+	// of the outputs. Both are only set when re-transcoding a video.
+	Profiles []string
+	Version  int
+
+	// Trace context the task continues, see queue.Job
+	TraceParent string
+}
+
+// Run starts a transcoding task for the job and returns its ID.
+func Run(l Launcher, cfg Config, job Job) (string, error) {
+	environment := map[string]string{
+		"TEMPORARY_BUCKET_NAME": job.Bucket,
+		"OUTPUT_BUCKET_NAME":    cfg.OutputBucketName,
+		"OBJECT_KEY":            job.Key,
+	}
+
+	if cfg.Region != "" {
+		environment["BUCKET_REGION"] = cfg.Region
+	}
+
+	if job.ID != "" {
+		environment["JOB_ID"] = job.ID
+	}
+
+	if job.TraceParent != "" {
+		environment["TRACEPARENT"] = job.TraceParent
+	}
+
+	if len(job.Profiles) > 0 {
+		environment["PROFILES"] = strings.Join(job.Profiles, ",")
+	}
+
+	if job.Version > 1 {
+		environment["OUTPUT_VERSION"] = strconv.Itoa(job.Version)
+	}
+
+	for name, value := range cfg.Environment {
+		environment[name] = value
+	}
+
+	return l.Launch(Spec{
+		Key:         job.Key,
+		Class:       ClassOrDefault(job.Class),
+		Environment: environment,
+	})
+}
+
+// ObjectKey returns the OBJECT_KEY the task was started with, read from the
+// container overrides.
+func ObjectKey(overrides *ecs.TaskOverride) string {
+	if overrides == nil {
+		return ""
+	}
+
+	for _, container := range overrides.ContainerOverrides {
+		if aws.StringValue(container.Name) != CONTAINER_NAME {
+			continue
+		}
+
+		for _, env := range container.Environment {
+			if aws.StringValue(env.Name) == "OBJECT_KEY" {
+				return aws.StringValue(env.Value)
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,153 @@
+// Package tracing follows a video through the pipeline with OpenTelemetry.
+// The trace of an upload starts in the upload Lambda and is carried along in
+// the W3C traceparent format: in the metadata of the uploaded object, in the
+// queued job, and in the environment of the transcoding task.
+//
+// Tracing is off unless OTEL_TRACES_EXPORTER is otlp, in which case the spans
+// are sent to OTEL_EXPORTER_OTLP_ENDPOINT, e.g. a local OpenTelemetry
+// Collector on http://localhost:4318.
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	EXPORTER_NONE = "none"
+	EXPORTER_OTLP = "otlp"
+
+	// Name of the tracer the spans of the binaries are started with
+	TRACER_NAME = "github.com/thegeorgenikhil/video-transcoding-service"
+
+	// Key of the trace context in the object metadata, canonicalized like
+	// the S3 SDK does
+	TRACEPARENT_METADATA_KEY = "Traceparent"
+
+	// How long the spans of a Lambda invocation may take to be sent
+	FLUSH_TIMEOUT = 2 * time.Second
+)
+
+// Attributes of the spans
+const (
+	VIDEO_KEY = attribute.Key("video.key")
+	JOB_ID    = attribute.Key("job.id")
+	RENDITION = attribute.Key("video.rendition")
+	BUCKET    = attribute.Key("storage.bucket")
+	BYTES     = attribute.Key("storage.bytes")
+)
+
+// Config uses the names of the OpenTelemetry SDK environment variables.
+type Config struct {
+	Exporter    string  `env:"OTEL_TRACES_EXPORTER" default:"none" oneof:"none otlp"`
+	Endpoint    string  `env:"OTEL_EXPORTER_OTLP_ENDPOINT" default:"http://localhost:4318"`
+	SampleRatio float64 `env:"OTEL_TRACES_SAMPLER_ARG" default:"1" min:"0"`
+}
+
+var provider *sdktrace.TracerProvider
+
+// Setup installs the tracer provider of the service. Spans are batched, call
+// Flush before a Lambda invocation returns and Shutdown before exiting.
+func Setup(service string, cfg Config) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	if cfg.Exporter != EXPORTER_OTLP {
+		return
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service))
+
+	// Traces started upstream are sampled by the decision made there
+	sampler := sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(NewOTLPExporter(cfg.Endpoint)),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	)
+	otel.SetTracerProvider(provider)
+}
+
+// Flush sends the spans ended so far. A Lambda is frozen once it returns, so
+// its spans would otherwise wait for the next invocation.
+func Flush() {
+	if provider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), FLUSH_TIMEOUT)
+	defer cancel()
+
+	if err := provider.ForceFlush(ctx); err != nil {
+		slog.Warn("failed to flush spans", "error", err)
+	}
+}
+
+// Shutdown sends the remaining spans and stops the provider.
+func Shutdown() {
+	if provider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), FLUSH_TIMEOUT)
+	defer cancel()
+
+	if err := provider.Shutdown(ctx); err != nil {
+		slog.Warn("failed to shut down tracing", "error", err)
+	}
+}
+
+// Start starts a span as a child of the span of ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TRACER_NAME).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartAt starts a span which started earlier, for steps whose parent is
+// only known once they are under way.
+func StartAt(ctx context.Context, name string, start time.Time, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TRACER_NAME).Start(ctx, name, trace.WithAttributes(attrs...), trace.WithTimestamp(start))
+}
+
+// Fail marks the span as failed with err.
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// End ends the span, marking it as failed when err isn't nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		Fail(span, err)
+	}
+
+	span.End()
+}
+
+// Inject returns the traceparent of the span of ctx, or an empty string
+// when ctx isn't traced.
+func Inject(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return carrier.Get("traceparent")
+}
+
+// Extract returns ctx with the remote span of the traceparent as its
+// parent. An empty or invalid traceparent leaves ctx as it is.
+func Extract(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
@@ -0,0 +1,140 @@
+package video
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+const AUDIT_TABLE_NAME = "VideoAudit"
+
+type AuditAction string
+
+const (
+	AUDIT_ACTION_DELETE  AuditAction = "delete"
+	AUDIT_ACTION_RESTORE AuditAction = "restore"
+	AUDIT_ACTION_PURGE   AuditAction = "purge"
+	AUDIT_ACTION_EXPIRE  AuditAction = "expire"
+)
+
+// AuditRecord records who deleted, restored or purged a video, and which
+// videos expired. Records are kept after the video itself is gone, keyed by
+// the video key and the time of the action.
+type AuditRecord struct {
+	Key    string      `json:"key" dynamodbav:"Key"`
+	At     string      `json:"at" dynamodbav:"At"`
+	Action AuditAction `json:"action" dynamodbav:"Action"`
+
+	// Actor is who made the change as the caller was authenticated, and
+	// RequestedBy who the caller says asked for it, which isn't verified
+	Actor       string `json:"actor" dynamodbav:"Actor"`
+	RequestedBy string `json:"requested_by,omitempty" dynamodbav:"RequestedBy,omitempty"`
+
+	SourceIP  string `json:"source_ip,omitempty" dynamodbav:"SourceIP,omitempty"`
+	RequestID string `json:"request_id,omitempty" dynamodbav:"RequestID,omitempty"`
+	Status    Status `json:"status,omitempty" dynamodbav:"Status,omitempty"`
+
+	// Objects lists the S3 objects removed by a purge, as bucket/key.
+	Objects []string `json:"objects,omitempty" dynamodbav:"Objects,omitempty"`
+}
+
+type AuditRepository interface {
+	Put(record AuditRecord) error
+	// List returns the records of the video stored under key, oldest first.
+	List(key string) ([]AuditRecord, error)
+}
+
+type DynamoAuditRepository struct {
+	cl        dynamodbiface.DynamoDBAPI
+	tableName string
+}
+
+func NewDynamoAuditRepository(cl dynamodbiface.DynamoDBAPI) *DynamoAuditRepository {
+	return &DynamoAuditRepository{cl: cl, tableName: AUDIT_TABLE_NAME}
+}
+
+func (r *DynamoAuditRepository) Put(record AuditRecord) error {
+	item, err := dynamodbattribute.MarshalMap(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.cl.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+
+	return err
+}
+
+func (r *DynamoAuditRepository) List(key string) ([]AuditRecord, error) {
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key("Key").Equal(expression.Value(key))).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []AuditRecord{}
+	var unmarshalErr error
+	err = r.cl.QueryPages(&dynamodb.QueryInput{
+		TableName:                 aws.String(r.tableName),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var items []AuditRecord
+		unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items)
+		if unmarshalErr != nil {
+			return false
+		}
+
+		records = append(records, items...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+
+	return records, nil
+}
+
+type MemoryAuditRepository struct {
+	Records []AuditRecord
+	sync.Mutex
+}
+
+func (r *MemoryAuditRepository) Put(record AuditRecord) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.Records = append(r.Records, record)
+	return nil
+}
+
+func (r *MemoryAuditRepository) List(key string) ([]AuditRecord, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	records := []AuditRecord{}
+	for _, record := range r.Records {
+		if record.Key == key {
+			records = append(records, record)
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].At < records[j].At
+	})
+
+	return records, nil
+}
@@ -0,0 +1,63 @@
+package video
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+const DEAD_LETTER_TABLE_NAME = "VideoDeadLetters"
+
+// DeadLetter records a video whose transcoding failed on every attempt, so it
+// can be looked into and re-driven by hand.
+type DeadLetter struct {
+	Key          string `json:"key" dynamodbav:"Key"`
+	FailedAt     string `json:"failed_at" dynamodbav:"FailedAt"`
+	Attempts     int    `json:"attempts" dynamodbav:"Attempts"`
+	LastError    string `json:"last_error" dynamodbav:"LastError"`
+	TaskArn      string `json:"task_arn,omitempty" dynamodbav:"TaskArn,omitempty"`
+	SourceBucket string `json:"source_bucket,omitempty" dynamodbav:"SourceBucket,omitempty"`
+}
+
+type DeadLetterRepository interface {
+	Put(deadLetter DeadLetter) error
+}
+
+type DynamoDeadLetterRepository struct {
+	cl        dynamodbiface.DynamoDBAPI
+	tableName string
+}
+
+func NewDynamoDeadLetterRepository(cl dynamodbiface.DynamoDBAPI) *DynamoDeadLetterRepository {
+	return &DynamoDeadLetterRepository{cl: cl, tableName: DEAD_LETTER_TABLE_NAME}
+}
+
+func (r *DynamoDeadLetterRepository) Put(d DeadLetter) error {
+	item, err := dynamodbattribute.MarshalMap(d)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.cl.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+
+	return err
+}
+
+type MemoryDeadLetterRepository struct {
+	DeadLetters []DeadLetter
+	sync.Mutex
+}
+
+func (r *MemoryDeadLetterRepository) Put(d DeadLetter) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.DeadLetters = append(r.DeadLetters, d)
+	return nil
+}
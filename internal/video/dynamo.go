@@ -0,0 +1,362 @@
+package video
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// DynamoRepository stores videos in DynamoDB, keyed by the "Key" attribute.
+type DynamoRepository struct {
+	cl        dynamodbiface.DynamoDBAPI
+	tableName string
+}
+
+func NewDynamoRepository(cl dynamodbiface.DynamoDBAPI) *DynamoRepository {
+	return &DynamoRepository{cl: cl, tableName: TABLE_NAME}
+}
+
+func (r *DynamoRepository) key(key string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"Key": {
+			S: aws.String(key),
+		},
+	}
+}
+
+func (r *DynamoRepository) Get(key string) (*Video, error) {
+	output, err := r.cl.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key:       r.key(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(output.Item) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var v Video
+	if err := dynamodbattribute.UnmarshalMap(output.Item, &v); err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+func (r *DynamoRepository) List() ([]Video, error) {
+	videos := []Video{}
+
+	var unmarshalErr error
+	err := r.cl.ScanPages(&dynamodb.ScanInput{
+		TableName: aws.String(r.tableName),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var v Video
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &v); unmarshalErr != nil {
+				return false
+			}
+
+			videos = append(videos, v)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+
+	return videos, nil
+}
+
+func (r *DynamoRepository) ListByStatus(status Status) ([]Video, error) {
+	keyCond := expression.Key("Status").Equal(expression.Value(status))
+
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	videos := []Video{}
+
+	var unmarshalErr error
+	err = r.cl.QueryPages(&dynamodb.QueryInput{
+		TableName:                 aws.String(r.tableName),
+		IndexName:                 aws.String(STATUS_INDEX_NAME),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var v Video
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &v); unmarshalErr != nil {
+				return false
+			}
+
+			videos = append(videos, v)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+
+	return videos, nil
+}
+
+func (r *DynamoRepository) Put(v Video) error {
+	item, err := dynamodbattribute.MarshalMap(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.cl.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+
+	return err
+}
+
+func (r *DynamoRepository) Create(v Video) error {
+	item, err := dynamodbattribute.MarshalMap(v)
+	if err != nil {
+		return err
+	}
+
+	// A video can only be replaced by a different upload once the job of
+	// the previous one is over
+	terminal := terminalStatuses()
+	statuses := make([]expression.OperandBuilder, len(terminal))
+	for i, s := range terminal {
+		statuses[i] = expression.Value(s)
+	}
+
+	sameObject := expression.Name("ETag").Equal(expression.Value(v.ETag)).
+		And(expression.Name("Sequencer").Equal(expression.Value(v.Sequencer)))
+
+	// Comparisons against missing attributes are never true, so items
+	// without an event ID need to be allowed explicitly
+	otherEvent := expression.AttributeNotExists(expression.Name("EventID")).
+		Or(expression.Name("EventID").NotEqual(expression.Value(v.EventID)))
+
+	replaceable := otherEvent.
+		And(expression.Not(sameObject)).
+		And(expression.Name("Status").In(statuses[0], statuses[1:]...))
+
+	cond := expression.AttributeNotExists(expression.Name("Key")).Or(replaceable)
+
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.cl.PutItem(&dynamodb.PutItemInput{
+		TableName:                 aws.String(r.tableName),
+		Item:                      item,
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if isConditionalCheckFailed(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+func (r *DynamoRepository) Update(key string, update Update) error {
+	set := expression.UpdateBuilder{}
+
+	attributes := map[string]string{
+		"Status":          string(update.Status),
+		"TranscodingTime": update.TranscodingTime,
+		"PreviewKey":      update.PreviewKey,
+		"RejectionReason": update.RejectionReason,
+		"FailureReason":   update.FailureReason,
+		"LastError":       update.LastError,
+		"NextRetryAt":     update.NextRetryAt,
+		"TaskArn":         update.TaskArn,
+		"JobID":           update.JobID,
+		"HeartbeatAt":     update.HeartbeatAt,
+		"Tenant":          update.Tenant,
+		"Class":           update.Class,
+		"SourceBucket":    update.SourceBucket,
+		"DeletedAt":       update.DeletedAt,
+		"PurgeAfter":      update.PurgeAfter,
+		"DeletedFrom":     string(update.DeletedFrom),
+		"CallbackURL":     update.CallbackURL,
+	}
+	for name, value := range attributes {
+		if value != "" {
+			set = set.Set(expression.Name(name), expression.Value(value))
+		}
+	}
+
+	if update.TranscodedFiles != nil {
+		set = set.Set(expression.Name("TranscodedFiles"), expression.Value(update.TranscodedFiles))
+	}
+
+	if update.Attempts != 0 {
+		set = set.Set(expression.Name("Attempts"), expression.Value(update.Attempts))
+	}
+
+	if update.Priority != 0 {
+		set = set.Set(expression.Name("Priority"), expression.Value(update.Priority))
+	}
+
+	if update.OutputVersion != 0 {
+		set = set.Set(expression.Name("OutputVersion"), expression.Value(update.OutputVersion))
+	}
+
+	if len(update.Profiles) > 0 {
+		set = set.Set(expression.Name("Profiles"), expression.Value(update.Profiles))
+	}
+
+	if update.ExpiresAt != 0 {
+		set = set.Set(expression.Name(TTL_ATTRIBUTE_NAME), expression.Value(update.ExpiresAt))
+	}
+
+	if len(update.AppendDeliveries) > 0 {
+		deliveries := expression.Name("Deliveries")
+		set = set.Set(deliveries, expression.ListAppend(
+			// An empty slice would be marshaled to NULL
+			expression.IfNotExists(deliveries, expression.Value(&dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}})),
+			expression.Value(update.AppendDeliveries),
+		))
+	}
+
+	if update.DropSource {
+		set = set.Remove(expression.Name("SourceBucket"))
+	}
+
+	if update.Reset {
+		for _, name := range []string{"Attempts", "LastError", "NextRetryAt", "FailureReason"} {
+			set = set.Remove(expression.Name(name))
+		}
+
+		if len(update.Profiles) == 0 {
+			set = set.Remove(expression.Name("Profiles"))
+		}
+	}
+
+	// Only update videos which exist, UpdateItem would create them otherwise
+	cond := expression.AttributeExists(expression.Name("Key"))
+
+	if update.Undelete {
+		for _, name := range []string{"DeletedAt", "PurgeAfter", "DeletedFrom"} {
+			set = set.Remove(expression.Name(name))
+		}
+		cond = cond.And(expression.Name("Status").Equal(expression.Value(STATUS_DELETED)))
+	} else if update.Status != "" {
+		sources := update.Status.Sources()
+		if len(sources) == 0 {
+			return ErrInvalidTransition
+		}
+
+		values := make([]expression.OperandBuilder, len(sources))
+		for i, from := range sources {
+			values[i] = expression.Value(from)
+		}
+
+		cond = cond.And(expression.Name("Status").In(values[0], values[1:]...))
+	}
+
+	if len(update.From) > 0 {
+		values := make([]expression.OperandBuilder, len(update.From))
+		for i, from := range update.From {
+			values[i] = expression.Value(from)
+		}
+
+		cond = cond.And(expression.Name("Status").In(values[0], values[1:]...))
+	}
+
+	if update.ClaimAttempt != 0 {
+		set = set.Set(expression.Name("Attempts"), expression.Value(update.ClaimAttempt))
+		set = set.Remove(expression.Name("NextRetryAt"))
+		cond = cond.And(
+			expression.Name("Status").Equal(expression.Value(STATUS_QUEUED)),
+			expression.Or(
+				expression.AttributeNotExists(expression.Name("Attempts")),
+				expression.Name("Attempts").LessThan(expression.Value(update.ClaimAttempt)),
+			),
+		)
+	}
+
+	if update.ReleaseAttempt != 0 {
+		if update.ReleaseAttempt > 1 {
+			set = set.Set(expression.Name("Attempts"), expression.Value(update.ReleaseAttempt-1))
+		} else {
+			set = set.Remove(expression.Name("Attempts"))
+		}
+		cond = cond.And(expression.Name("Attempts").Equal(expression.Value(update.ReleaseAttempt)))
+	}
+
+	if update.ForJob != "" {
+		cond = cond.And(expression.Name("JobID").Equal(expression.Value(update.ForJob)))
+	}
+
+	expr, err := expression.NewBuilder().WithUpdate(set).WithCondition(cond).Build()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.cl.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 aws.String(r.tableName),
+		Key:                       r.key(key),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+	})
+	if isConditionalCheckFailed(err) {
+		// The condition doesn't tell us which part of it failed
+		if _, err := r.Get(key); err != nil {
+			return err
+		}
+
+		return ErrInvalidTransition
+	}
+
+	return err
+}
+
+func (r *DynamoRepository) Delete(key string) error {
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name("Key"))).
+		Build()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.cl.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:                 aws.String(r.tableName),
+		Key:                       r.key(key),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if isConditionalCheckFailed(err) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func isConditionalCheckFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
@@ -0,0 +1,154 @@
+package video
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryRepository keeps videos in memory. It is meant for tests and local
+// runs, where there is no DynamoDB table to talk to.
+type MemoryRepository struct {
+	videos map[string]Video
+	sync.Mutex
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{videos: make(map[string]Video)}
+}
+
+func (r *MemoryRepository) Get(key string) (*Video, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	v, ok := r.videos[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	v = copyVideo(v)
+	return &v, nil
+}
+
+func (r *MemoryRepository) List() ([]Video, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	videos := make([]Video, 0, len(r.videos))
+	for _, v := range r.videos {
+		videos = append(videos, copyVideo(v))
+	}
+
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].Key < videos[j].Key
+	})
+
+	return videos, nil
+}
+
+func (r *MemoryRepository) ListByStatus(status Status) ([]Video, error) {
+	videos, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []Video{}
+	for _, v := range videos {
+		if v.Status == status {
+			filtered = append(filtered, v)
+		}
+	}
+
+	return filtered, nil
+}
+
+func (r *MemoryRepository) Put(v Video) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.videos[v.Key] = copyVideo(v)
+	return nil
+}
+
+func (r *MemoryRepository) Create(v Video) error {
+	r.Lock()
+	defer r.Unlock()
+
+	existing, ok := r.videos[v.Key]
+	if ok && (existing.IsSameUpload(v) || !existing.Status.IsTerminal()) {
+		return ErrDuplicate
+	}
+
+	r.videos[v.Key] = copyVideo(v)
+	return nil
+}
+
+func (r *MemoryRepository) Update(key string, update Update) error {
+	r.Lock()
+	defer r.Unlock()
+
+	v, ok := r.videos[key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if update.Undelete {
+		if v.Status != STATUS_DELETED {
+			return ErrInvalidTransition
+		}
+	} else if update.Status != "" && !v.Status.CanTransitionTo(update.Status) {
+		return ErrInvalidTransition
+	}
+
+	if len(update.From) > 0 && !v.Status.In(update.From) {
+		return ErrInvalidTransition
+	}
+
+	if update.ClaimAttempt != 0 && (v.Status != STATUS_QUEUED || v.Attempts >= update.ClaimAttempt) {
+		return ErrInvalidTransition
+	}
+
+	if update.ReleaseAttempt != 0 && v.Attempts != update.ReleaseAttempt {
+		return ErrInvalidTransition
+	}
+
+	if update.ForJob != "" && v.JobID != update.ForJob {
+		return ErrInvalidTransition
+	}
+
+	update.Apply(&v)
+	r.videos[key] = copyVideo(v)
+	return nil
+}
+
+func (r *MemoryRepository) Delete(key string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.videos[key]; !ok {
+		return ErrNotFound
+	}
+
+	delete(r.videos, key)
+	return nil
+}
+
+// copyVideo returns a copy of v which shares no maps with it.
+func copyVideo(v Video) Video {
+	if v.Profiles != nil {
+		v.Profiles = append([]string(nil), v.Profiles...)
+	}
+
+	if v.TranscodedFiles != nil {
+		files := make(map[string]string, len(v.TranscodedFiles))
+		for k, f := range v.TranscodedFiles {
+			files[k] = f
+		}
+		v.TranscodedFiles = files
+	}
+
+	if v.Deliveries != nil {
+		v.Deliveries = append([]Delivery(nil), v.Deliveries...)
+	}
+
+	return v
+}
@@ -0,0 +1,103 @@
+package video
+
+import "testing"
+
+func TestUpdateFollowsTheTransitions(t *testing.T) {
+	for from := range transitions {
+		for to := range transitions {
+			r := NewMemoryRepository()
+			r.Put(Video{Key: "key", Status: from})
+
+			err := r.Update("key", Update{Status: to})
+			if want := from.CanTransitionTo(to); (err == nil) != want {
+				t.Errorf("%s -> %s: Update() error = %v, transition allowed: %v", from, to, err, want)
+			}
+			if err != nil && err != ErrInvalidTransition {
+				t.Errorf("%s -> %s: Update() error = %v, want ErrInvalidTransition", from, to, err)
+			}
+
+			v, _ := r.Get("key")
+			if err == nil && v.Status != to || err != nil && v.Status != from {
+				t.Errorf("%s -> %s: video is %s after the update", from, to, v.Status)
+			}
+		}
+	}
+}
+
+func TestCreateOnlyReplacesFinishedJobsOfOtherUploads(t *testing.T) {
+	upload := Video{Key: "key", Status: STATUS_UPLOADED, EventID: "event-1", ETag: "etag-1", Sequencer: "1"}
+	reupload := Video{Key: "key", Status: STATUS_UPLOADED, EventID: "event-2", ETag: "etag-2", Sequencer: "2"}
+
+	tests := []struct {
+		name     string
+		existing Status
+		video    Video
+		err      error
+	}{
+		{"same event", STATUS_COMPLETED, Video{Key: "key", EventID: "event-1", ETag: "etag-2", Sequencer: "2"}, ErrDuplicate},
+		{"same object", STATUS_COMPLETED, Video{Key: "key", EventID: "event-2", ETag: "etag-1", Sequencer: "1"}, ErrDuplicate},
+		{"job running", STATUS_PROCESSING, reupload, ErrDuplicate},
+		{"job completed", STATUS_COMPLETED, reupload, nil},
+		{"job failed", STATUS_FAILED, reupload, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewMemoryRepository()
+			existing := upload
+			existing.Status = tt.existing
+			r.Put(existing)
+
+			if err := r.Create(tt.video); err != tt.err {
+				t.Errorf("Create() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	if err := NewMemoryRepository().Create(upload); err != nil {
+		t.Errorf("Create() of a new video error = %v", err)
+	}
+}
+
+func TestClaimAttemptStartsEachAttemptOnce(t *testing.T) {
+	r := NewMemoryRepository()
+	r.Put(Video{Key: "key", Status: STATUS_QUEUED, Attempts: 1, NextRetryAt: "2024-01-01T00:00:00Z"})
+
+	// The retry of the first attempt, delivered twice by the queue
+	if err := r.Update("key", Update{ClaimAttempt: 2}); err != nil {
+		t.Fatalf("first claim error = %v", err)
+	}
+	if err := r.Update("key", Update{ClaimAttempt: 2}); err != ErrInvalidTransition {
+		t.Errorf("second claim error = %v, want ErrInvalidTransition", err)
+	}
+
+	v, _ := r.Get("key")
+	if v.Attempts != 2 || v.NextRetryAt != "" {
+		t.Errorf("claimed video has attempts %d and next retry %q", v.Attempts, v.NextRetryAt)
+	}
+
+	// Handing the attempt back makes it claimable again
+	if err := r.Update("key", Update{ReleaseAttempt: 2}); err != nil {
+		t.Fatalf("release error = %v", err)
+	}
+	if err := r.Update("key", Update{ClaimAttempt: 2}); err != nil {
+		t.Errorf("claim after release error = %v", err)
+	}
+
+	r.Update("key", Update{Status: STATUS_CANCELLED})
+	if err := r.Update("key", Update{ClaimAttempt: 3}); err != ErrInvalidTransition {
+		t.Errorf("claim of a cancelled video error = %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestForJobOnlyUpdatesTheVideoOfTheJob(t *testing.T) {
+	r := NewMemoryRepository()
+	r.Put(Video{Key: "key", Status: STATUS_PROCESSING, JobID: "job-2"})
+
+	if err := r.Update("key", Update{Status: STATUS_UPLOADING, ForJob: "job-1"}); err != ErrInvalidTransition {
+		t.Errorf("update for another job error = %v, want ErrInvalidTransition", err)
+	}
+	if err := r.Update("key", Update{Status: STATUS_UPLOADING, ForJob: "job-2"}); err != nil {
+		t.Errorf("update for the job error = %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package video
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// UnmarshalStreamImage converts an image of the stream of the Videos table,
+// which uses the attribute values of the Lambda events, to a video.
+func UnmarshalStreamImage(image map[string]events.DynamoDBAttributeValue) (Video, error) {
+	var v Video
+
+	body, err := json.Marshal(image)
+	if err != nil {
+		return v, err
+	}
+
+	var item map[string]*dynamodb.AttributeValue
+	if err := json.Unmarshal(body, &item); err != nil {
+		return v, err
+	}
+
+	err = dynamodbattribute.UnmarshalMap(item, &v)
+	return v, err
+}
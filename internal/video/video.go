@@ -0,0 +1,448 @@
+// Package video holds the canonical model of a video stored in the Videos
+// table, and the repositories used to read and write it.
+package video
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	TABLE_NAME = "Videos"
+
+	// Global secondary index on the Status attribute, used to find the
+	// videos in a given status without scanning the whole table
+	STATUS_INDEX_NAME = "StatusIndex"
+
+	// Tenant of the videos uploaded without one
+	DEFAULT_TENANT = "default"
+
+	// Attribute DynamoDB's TTL removes expired videos by
+	TTL_ATTRIBUTE_NAME = "ExpiresAt"
+)
+
+var (
+	ErrNotFound          = errors.New("video not found")
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrDuplicate         = errors.New("video already exists for this upload")
+)
+
+type Status string
+
+// The lifecycle of a transcoding job:
+//
+//	uploaded -> queued -> processing -> uploading -> completed
+//
+// Any non-terminal status can also move to failed or cancelled, and uploads
+// which turn out not to be usable videos are rejected before or while being
+// processed. A job whose task died is queued again while it has attempts
+// left, and completed or failed videos are queued again to re-transcode them.
+// Videos whose job is over can be deleted, they stay in the deleted status for
+// a grace period in which Update.Undelete restores them to where they were.
+const (
+	STATUS_UPLOADED   Status = "uploaded"
+	STATUS_QUEUED     Status = "queued"
+	STATUS_PROCESSING Status = "processing"
+	STATUS_UPLOADING  Status = "uploading"
+	STATUS_COMPLETED  Status = "completed"
+	STATUS_FAILED     Status = "failed"
+	STATUS_CANCELLED  Status = "cancelled"
+	STATUS_REJECTED   Status = "rejected"
+	STATUS_DELETED    Status = "deleted"
+)
+
+// transitions lists the statuses a video can move to from each status.
+var transitions = map[Status][]Status{
+	STATUS_UPLOADED:   {STATUS_QUEUED, STATUS_REJECTED, STATUS_FAILED, STATUS_CANCELLED},
+	STATUS_QUEUED:     {STATUS_QUEUED, STATUS_PROCESSING, STATUS_FAILED, STATUS_CANCELLED},
+	STATUS_PROCESSING: {STATUS_QUEUED, STATUS_UPLOADING, STATUS_REJECTED, STATUS_FAILED, STATUS_CANCELLED},
+	STATUS_UPLOADING:  {STATUS_QUEUED, STATUS_COMPLETED, STATUS_FAILED, STATUS_CANCELLED},
+	STATUS_COMPLETED:  {STATUS_QUEUED, STATUS_DELETED},
+	STATUS_FAILED:     {STATUS_QUEUED, STATUS_DELETED},
+	STATUS_CANCELLED:  {STATUS_DELETED},
+	STATUS_REJECTED:   {STATUS_DELETED},
+	STATUS_DELETED:    {},
+}
+
+// CanTransitionTo reports whether a video in status s may move to next.
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsTerminal reports whether the video's job is over. Only a re-transcode, or
+// restoring a deleted video, moves a video out of a terminal status.
+func (s Status) IsTerminal() bool {
+	switch s {
+	case STATUS_COMPLETED, STATUS_FAILED, STATUS_CANCELLED, STATUS_REJECTED, STATUS_DELETED:
+		return true
+	default:
+		return false
+	}
+}
+
+// In reports whether s is one of statuses.
+func (s Status) In(statuses []Status) bool {
+	for _, status := range statuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sources returns the statuses from which a video may move to s.
+func (s Status) Sources() []Status {
+	var sources []Status
+	for from, allowed := range transitions {
+		for _, to := range allowed {
+			if to == s {
+				sources = append(sources, from)
+			}
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i] < sources[j]
+	})
+
+	return sources
+}
+
+func (s Status) Validate() error {
+	if _, ok := transitions[s]; !ok {
+		return fmt.Errorf("unknown status %q", s)
+	}
+
+	return nil
+}
+
+type Video struct {
+	Key             string            `json:"key" dynamodbav:"Key"`
+	Status          Status            `json:"status" dynamodbav:"Status"`
+	UploadedAt      string            `json:"uploaded_at" dynamodbav:"UploadedAt"`
+	TranscodingTime string            `json:"transcoding_time" dynamodbav:"TranscodingTime,omitempty"`
+	TranscodedFiles map[string]string `json:"transcoding_files" dynamodbav:"TranscodedFiles,omitempty"`
+	PreviewKey      string            `json:"preview_key,omitempty" dynamodbav:"PreviewKey,omitempty"`
+	RejectionReason string            `json:"rejection_reason,omitempty" dynamodbav:"RejectionReason,omitempty"`
+	FailureReason   string            `json:"failure_reason,omitempty" dynamodbav:"FailureReason,omitempty"`
+
+	// Retry tracking. Attempts counts the attempts claimed for the video,
+	// and NextRetryAt is set while a retry, or an attempt handed back, is
+	// waiting in the job queue.
+	Attempts    int    `json:"attempts,omitempty" dynamodbav:"Attempts,omitempty"`
+	LastError   string `json:"last_error,omitempty" dynamodbav:"LastError,omitempty"`
+	NextRetryAt string `json:"next_retry_at,omitempty" dynamodbav:"NextRetryAt,omitempty"`
+
+	// ID of the task working on the video, an ECS task ARN or the ID given
+	// by the launcher the task was started with, see task.Launcher, and of
+	// the job it works on, see queue.Job
+	TaskArn      string `json:"-" dynamodbav:"TaskArn,omitempty"`
+	JobID        string `json:"-" dynamodbav:"JobID,omitempty"`
+	SourceBucket string `json:"-" dynamodbav:"SourceBucket,omitempty"`
+
+	// Used by the dispatcher to order the jobs waiting in the queue. Videos
+	// uploaded without a tenant belong to DEFAULT_TENANT. Class is the
+	// scheduling class, which decides the priority and the task the video
+	// is transcoded by.
+	Tenant   string `json:"tenant,omitempty" dynamodbav:"Tenant,omitempty"`
+	Class    string `json:"class,omitempty" dynamodbav:"Class,omitempty"`
+	Priority int    `json:"priority,omitempty" dynamodbav:"Priority,omitempty"`
+
+	// HeartbeatAt is set when a task is started and refreshed by the
+	// transcoder while it works on the video.
+	HeartbeatAt string `json:"-" dynamodbav:"HeartbeatAt,omitempty"`
+
+	// OutputVersion is the version of the outputs the last job was started
+	// for, see keys.VersionedRenditionKey. Profiles lists the renditions a
+	// re-transcode produces, every profile when empty.
+	OutputVersion int      `json:"output_version,omitempty" dynamodbav:"OutputVersion,omitempty"`
+	Profiles      []string `json:"profiles,omitempty" dynamodbav:"Profiles,omitempty"`
+
+	// Set while the video is deleted. It is purged after PurgeAfter, and
+	// restoring it moves it back to DeletedFrom.
+	DeletedAt   string `json:"deleted_at,omitempty" dynamodbav:"DeletedAt,omitempty"`
+	PurgeAfter  string `json:"purge_after,omitempty" dynamodbav:"PurgeAfter,omitempty"`
+	DeletedFrom Status `json:"deleted_from,omitempty" dynamodbav:"DeletedFrom,omitempty"`
+
+	// ExpiresAt is the Unix time the outputs of the video expire at, set
+	// when a job completes from the retention policy of its tenant. DynamoDB
+	// removes the video once it is reached, and its objects are purged then.
+	ExpiresAt int64 `json:"expires_at,omitempty" dynamodbav:"ExpiresAt,omitempty"`
+
+	// Identify the S3 event and object version the video was created from,
+	// so repeated deliveries of the same event can be told apart from a new
+	// upload to the same key.
+	EventID   string `json:"-" dynamodbav:"EventID,omitempty"`
+	ETag      string `json:"-" dynamodbav:"ETag,omitempty"`
+	Sequencer string `json:"-" dynamodbav:"Sequencer,omitempty"`
+
+	// CallbackURL is given with the upload, the status changes of the video
+	// are POSTed to it by the webhook-lambda. Deliveries logs every one of
+	// them, oldest first. Neither is returned by the API, they are only
+	// meant for the uploader.
+	CallbackURL string     `json:"-" dynamodbav:"CallbackURL,omitempty"`
+	Deliveries  []Delivery `json:"-" dynamodbav:"Deliveries,omitempty"`
+}
+
+// Delivery records the webhook sent for a status change of a video.
+type Delivery struct {
+	EventID string `json:"event_id" dynamodbav:"EventID"`
+	Status  Status `json:"status" dynamodbav:"Status"`
+	At      string `json:"at" dynamodbav:"At"`
+
+	// Attempts made, the status code of the last response, if any, and the
+	// error of the last attempt when none succeeded
+	Attempts   int    `json:"attempts" dynamodbav:"Attempts"`
+	StatusCode int    `json:"status_code,omitempty" dynamodbav:"StatusCode,omitempty"`
+	Error      string `json:"error,omitempty" dynamodbav:"Error,omitempty"`
+	Delivered  bool   `json:"delivered" dynamodbav:"Delivered"`
+}
+
+// IsSameUpload reports whether other was created from the same event, or
+// the same version of the uploaded object, as v.
+func (v Video) IsSameUpload(other Video) bool {
+	if v.EventID != "" && v.EventID == other.EventID {
+		return true
+	}
+
+	return v.ETag == other.ETag && v.Sequencer == other.Sequencer
+}
+
+// terminalStatuses returns every terminal status.
+func terminalStatuses() []Status {
+	var statuses []Status
+	for s := range transitions {
+		if s.IsTerminal() {
+			statuses = append(statuses, s)
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i] < statuses[j]
+	})
+
+	return statuses
+}
+
+// Update lists the attributes to change on a video, only the fields which
+// are set are written.
+type Update struct {
+	Status          Status
+	TranscodingTime string
+	TranscodedFiles map[string]string
+	PreviewKey      string
+	RejectionReason string
+	FailureReason   string
+	Attempts        int
+	LastError       string
+	NextRetryAt     string
+	TaskArn         string
+	JobID           string
+	HeartbeatAt     string
+	Tenant          string
+	Class           string
+	Priority        int
+	SourceBucket    string
+	OutputVersion   int
+	Profiles        []string
+
+	ExpiresAt int64
+
+	CallbackURL string
+
+	// AppendDeliveries adds to the delivery log of the video.
+	AppendDeliveries []Delivery
+
+	// DropSource removes SourceBucket, for a video whose source was deleted.
+	DropSource bool
+
+	// Reset removes the attempts, errors and profiles of the previous job,
+	// for a video which is transcoded again.
+	Reset bool
+
+	DeletedAt   string
+	PurgeAfter  string
+	DeletedFrom Status
+
+	// Undelete moves a deleted video back to Status and removes DeletedAt,
+	// PurgeAfter and DeletedFrom. It only succeeds while the video is
+	// deleted, the transitions have no way out of it otherwise.
+	Undelete bool
+
+	// ClaimAttempt sets Attempts and removes NextRetryAt. It only succeeds
+	// while the video is queued and Attempts is lower, so that a job
+	// delivered more than once by the queue starts a single task.
+	ClaimAttempt int
+
+	// From only applies the update while the video is in one of these
+	// statuses, on top of the transitions allowed to Status. A
+	// re-transcode, for instance, may only start from a finished job.
+	From []Status
+
+	// ReleaseAttempt undoes the claim of the attempt, setting Attempts back
+	// to the one before it. It only succeeds while Attempts is
+	// ReleaseAttempt, and is used to hand a job back to the queue without
+	// using up one of its attempts.
+	ReleaseAttempt int
+
+	// ForJob only applies the update while JobID is this job, so a task
+	// whose job was given up on, and handed to another attempt, can't touch
+	// the video any more.
+	ForJob string
+}
+
+// Apply sets the fields of the update on v.
+func (u Update) Apply(v *Video) {
+	if u.Status != "" {
+		v.Status = u.Status
+	}
+
+	if u.TranscodingTime != "" {
+		v.TranscodingTime = u.TranscodingTime
+	}
+
+	if u.TranscodedFiles != nil {
+		v.TranscodedFiles = u.TranscodedFiles
+	}
+
+	if u.PreviewKey != "" {
+		v.PreviewKey = u.PreviewKey
+	}
+
+	if u.RejectionReason != "" {
+		v.RejectionReason = u.RejectionReason
+	}
+
+	if u.FailureReason != "" {
+		v.FailureReason = u.FailureReason
+	}
+
+	if u.Attempts != 0 {
+		v.Attempts = u.Attempts
+	}
+
+	if u.LastError != "" {
+		v.LastError = u.LastError
+	}
+
+	if u.NextRetryAt != "" {
+		v.NextRetryAt = u.NextRetryAt
+	}
+
+	if u.TaskArn != "" {
+		v.TaskArn = u.TaskArn
+	}
+
+	if u.JobID != "" {
+		v.JobID = u.JobID
+	}
+
+	if u.HeartbeatAt != "" {
+		v.HeartbeatAt = u.HeartbeatAt
+	}
+
+	if u.Tenant != "" {
+		v.Tenant = u.Tenant
+	}
+
+	if u.Class != "" {
+		v.Class = u.Class
+	}
+
+	if u.Priority != 0 {
+		v.Priority = u.Priority
+	}
+
+	if u.SourceBucket != "" {
+		v.SourceBucket = u.SourceBucket
+	}
+
+	if u.OutputVersion != 0 {
+		v.OutputVersion = u.OutputVersion
+	}
+
+	if u.ExpiresAt != 0 {
+		v.ExpiresAt = u.ExpiresAt
+	}
+
+	if u.CallbackURL != "" {
+		v.CallbackURL = u.CallbackURL
+	}
+
+	if len(u.AppendDeliveries) > 0 {
+		v.Deliveries = append(v.Deliveries, u.AppendDeliveries...)
+	}
+
+	if u.DropSource {
+		v.SourceBucket = ""
+	}
+
+	if u.Reset {
+		v.Attempts = 0
+		v.LastError = ""
+		v.NextRetryAt = ""
+		v.FailureReason = ""
+		v.Profiles = nil
+	}
+
+	if len(u.Profiles) > 0 {
+		v.Profiles = u.Profiles
+	}
+
+	if u.DeletedAt != "" {
+		v.DeletedAt = u.DeletedAt
+	}
+
+	if u.PurgeAfter != "" {
+		v.PurgeAfter = u.PurgeAfter
+	}
+
+	if u.DeletedFrom != "" {
+		v.DeletedFrom = u.DeletedFrom
+	}
+
+	if u.Undelete {
+		v.DeletedAt = ""
+		v.PurgeAfter = ""
+		v.DeletedFrom = ""
+	}
+
+	if u.ClaimAttempt != 0 {
+		v.Attempts = u.ClaimAttempt
+		v.NextRetryAt = ""
+	}
+
+	if u.ReleaseAttempt != 0 {
+		v.Attempts = u.ReleaseAttempt - 1
+	}
+}
+
+type VideoRepository interface {
+	// Get returns the video stored under key, or ErrNotFound.
+	Get(key string) (*Video, error)
+	// List returns every video.
+	List() ([]Video, error)
+	// ListByStatus returns the videos currently in status.
+	ListByStatus(status Status) ([]Video, error)
+	// Put creates the video, replacing any video stored under the same key.
+	Put(video Video) error
+	// Create stores a new video. It returns ErrDuplicate when a video was
+	// already created for the same upload, or when another upload to the
+	// same key is still being worked on.
+	Create(video Video) error
+	// Update changes the attributes of an existing video, returning
+	// ErrNotFound if there is none. When the update sets a status, it is
+	// only applied if the video can move to it from its current status,
+	// ErrInvalidTransition is returned otherwise.
+	Update(key string, update Update) error
+	// Delete removes the video stored under key, or returns ErrNotFound.
+	Delete(key string) error
+}
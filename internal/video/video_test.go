@@ -0,0 +1,28 @@
+package video
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestVideoJSONLeavesOutTheInternalAttributes(t *testing.T) {
+	v := Video{
+		Key:          "key",
+		Status:       STATUS_COMPLETED,
+		SourceBucket: "temporary",
+		CallbackURL:  "https://example.com/hook?token=secret",
+		Deliveries:   []Delivery{{EventID: "event-1", Status: STATUS_COMPLETED, StatusCode: 500, Error: "internal error"}},
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, leaked := range []string{"temporary", "example.com", "event-1", "internal error"} {
+		if strings.Contains(string(raw), leaked) {
+			t.Errorf("JSON of the video %s contains %q", raw, leaked)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// Config of the Sender. The secret is shared with the receivers.
+type Config struct {
+	Secret  string        `env:"WEBHOOK_SECRET" required:"true"`
+	Timeout time.Duration `env:"WEBHOOK_TIMEOUT_SECONDS" default:"10" unit:"seconds" min:"1"`
+	Retry   RetryPolicy
+}
+
+// RetryPolicy decides how often, and after how long, a webhook which
+// couldn't be delivered is sent again.
+type RetryPolicy struct {
+	MaxAttempts int           `env:"WEBHOOK_MAX_ATTEMPTS" default:"5" min:"1"`
+	BaseDelay   time.Duration `env:"WEBHOOK_RETRY_BASE_DELAY_SECONDS" default:"1" unit:"seconds" min:"0"`
+	MaxDelay    time.Duration `env:"WEBHOOK_RETRY_MAX_DELAY_SECONDS" default:"30" unit:"seconds" min:"0"`
+}
+
+// Delay returns how long to wait after the given number of failed attempts,
+// doubling with every attempt.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return delay
+}
+
+// Sender POSTs signed events to callback URLs.
+type Sender struct {
+	client *http.Client
+	secret []byte
+	policy RetryPolicy
+}
+
+func NewSender(cfg Config) *Sender {
+	return &Sender{
+		client: &http.Client{Timeout: cfg.Timeout},
+		secret: []byte(cfg.Secret),
+		policy: cfg.Retry,
+	}
+}
+
+// Send delivers the event to url, retrying with backoff until it is
+// accepted, the receiver refuses it for good, the attempts run out or ctx is
+// done. It returns the delivery to log on the video.
+func (s *Sender) Send(ctx context.Context, url string, event Event) video.Delivery {
+	delivery := video.Delivery{
+		EventID: event.ID,
+		Status:  event.Video.Status,
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		delivery.Error = err.Error()
+		delivery.At = time.Now().UTC().Format(time.RFC3339)
+		return delivery
+	}
+
+	for {
+		delivery.Attempts++
+		delivery.Error = ""
+
+		code, retryAfter, err := s.post(ctx, url, event.ID, body)
+		delivery.StatusCode = code
+		delivery.At = time.Now().UTC().Format(time.RFC3339)
+
+		if err == nil {
+			delivery.Delivered = true
+			return delivery
+		}
+		delivery.Error = err.Error()
+
+		if !retryable(code) || delivery.Attempts >= s.policy.MaxAttempts {
+			return delivery
+		}
+
+		delay := s.policy.Delay(delivery.Attempts)
+		if retryAfter > delay && retryAfter <= s.policy.MaxDelay {
+			delay = retryAfter
+		}
+
+		select {
+		case <-ctx.Done():
+			return delivery
+		case <-time.After(delay):
+		}
+	}
+}
+
+// post makes a single attempt, returning the status code of the response and
+// how long the receiver asked us to wait before the next one.
+func (s *Sender) post(ctx context.Context, url, id string, body []byte) (int, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Signed again for every attempt, the timestamp is part of the signature
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ID_HEADER, id)
+	req.Header.Set(TIMESTAMP_HEADER, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SIGNATURE_HEADER, Sign(s.secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	// Read the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode/100 == 2 {
+		return resp.StatusCode, 0, nil
+	}
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return resp.StatusCode, retryAfter, fmt.Errorf("callback responded with %s", resp.Status)
+}
+
+// retryable reports whether an attempt which failed with the status code
+// might succeed later. Code is 0 when no response was received.
+func retryable(code int) bool {
+	switch {
+	case code == 0, code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return true
+	default:
+		return code >= 500
+	}
+}
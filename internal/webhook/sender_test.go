@@ -0,0 +1,232 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if delay := p.Delay(tt.attempts); delay != tt.delay {
+			t.Errorf("Delay(%d) = %s, want %s", tt.attempts, delay, tt.delay)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		code      int
+		retryable bool
+	}{
+		{0, true},
+		{http.StatusRequestTimeout, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusNotFound, false},
+		{http.StatusGone, false},
+	}
+
+	for _, tt := range tests {
+		if got := retryable(tt.code); got != tt.retryable {
+			t.Errorf("retryable(%d) = %v, want %v", tt.code, got, tt.retryable)
+		}
+	}
+}
+
+// receiver answers the attempts with the given status codes, the last one
+// once they run out, and records the requests it received.
+type receiver struct {
+	codes      []int
+	retryAfter string
+
+	requests []*http.Request
+	bodies   [][]byte
+	sync.Mutex
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	body, _ := io.ReadAll(req.Body)
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+
+	code := r.codes[len(r.codes)-1]
+	if len(r.requests) <= len(r.codes) {
+		code = r.codes[len(r.requests)-1]
+	}
+
+	if r.retryAfter != "" {
+		w.Header().Set("Retry-After", r.retryAfter)
+	}
+	w.WriteHeader(code)
+}
+
+func (r *receiver) attempts() int {
+	r.Lock()
+	defer r.Unlock()
+
+	return len(r.requests)
+}
+
+func newTestSender(maxAttempts int, maxDelay time.Duration) *Sender {
+	return NewSender(Config{
+		Secret:  "secret",
+		Timeout: time.Second,
+		Retry:   RetryPolicy{MaxAttempts: maxAttempts, BaseDelay: time.Millisecond, MaxDelay: maxDelay},
+	})
+}
+
+var testEvent = Event{ID: "event-1", Type: "video.completed", Video: EventVideo{Key: "key", Status: video.STATUS_COMPLETED}}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name      string
+		codes     []int
+		attempts  int
+		code      int
+		delivered bool
+	}{
+		{"accepted", []int{http.StatusOK}, 1, http.StatusOK, true},
+		{"accepted after retries", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent}, 3, http.StatusNoContent, true},
+		{"refused", []int{http.StatusBadRequest}, 1, http.StatusBadRequest, false},
+		{"attempts run out", []int{http.StatusInternalServerError}, 4, http.StatusInternalServerError, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &receiver{codes: tt.codes}
+			server := httptest.NewServer(r)
+			defer server.Close()
+
+			delivery := newTestSender(4, 10*time.Millisecond).Send(context.Background(), server.URL, testEvent)
+
+			if delivery.Attempts != tt.attempts || r.attempts() != tt.attempts {
+				t.Errorf("made %d attempts, the receiver got %d, want %d", delivery.Attempts, r.attempts(), tt.attempts)
+			}
+			if delivery.StatusCode != tt.code || delivery.Delivered != tt.delivered {
+				t.Errorf("delivery = %+v, want status code %d and delivered %v", delivery, tt.code, tt.delivered)
+			}
+			if tt.delivered != (delivery.Error == "") {
+				t.Errorf("delivery error = %q", delivery.Error)
+			}
+			if delivery.EventID != testEvent.ID || delivery.Status != video.STATUS_COMPLETED || delivery.At == "" {
+				t.Errorf("delivery = %+v, want the event and when it was made", delivery)
+			}
+		})
+	}
+}
+
+func TestSendSignsEveryAttempt(t *testing.T) {
+	r := &receiver{codes: []int{http.StatusBadGateway, http.StatusOK}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	newTestSender(2, time.Millisecond).Send(context.Background(), server.URL, testEvent)
+
+	if len(r.requests) != 2 {
+		t.Fatalf("receiver got %d requests, want 2", len(r.requests))
+	}
+
+	for i, req := range r.requests {
+		if req.Header.Get(ID_HEADER) != testEvent.ID {
+			t.Errorf("attempt %d: id header = %q", i+1, req.Header.Get(ID_HEADER))
+		}
+
+		err := Verify([]byte("secret"), req.Header.Get(TIMESTAMP_HEADER), req.Header.Get(SIGNATURE_HEADER), r.bodies[i], time.Minute)
+		if err != nil {
+			t.Errorf("attempt %d: Verify() error = %v", i+1, err)
+		}
+	}
+}
+
+func TestSendWaitsForRetryAfter(t *testing.T) {
+	r := &receiver{codes: []int{http.StatusTooManyRequests, http.StatusOK}, retryAfter: "1"}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	start := time.Now()
+	delivery := newTestSender(2, 2*time.Second).Send(context.Background(), server.URL, testEvent)
+
+	if !delivery.Delivered {
+		t.Fatalf("delivery = %+v, want it delivered", delivery)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want the second asked for by Retry-After", elapsed)
+	}
+}
+
+func TestSendIgnoresRetryAfterBeyondTheMaxDelay(t *testing.T) {
+	r := &receiver{codes: []int{http.StatusServiceUnavailable, http.StatusOK}, retryAfter: "3600"}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	start := time.Now()
+	delivery := newTestSender(2, 10*time.Millisecond).Send(context.Background(), server.URL, testEvent)
+
+	if !delivery.Delivered || time.Since(start) > 5*time.Second {
+		t.Errorf("delivery = %+v after %s, want it retried after the max delay", delivery, time.Since(start))
+	}
+}
+
+func TestSendStopsWhenTheContextIsDone(t *testing.T) {
+	r := &receiver{codes: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	sender := NewSender(Config{
+		Secret:  "secret",
+		Timeout: time.Second,
+		Retry:   RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour},
+	})
+
+	start := time.Now()
+	delivery := sender.Send(ctx, server.URL, testEvent)
+
+	if delivery.Attempts != 1 || delivery.Delivered {
+		t.Errorf("delivery = %+v, want the single attempt made before ctx was done", delivery)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Send() returned after %s, want it to stop with ctx", elapsed)
+	}
+}
+
+func TestSendWithoutAReceiver(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	delivery := newTestSender(2, time.Millisecond).Send(context.Background(), url, testEvent)
+
+	if delivery.Attempts != 2 || delivery.StatusCode != 0 || delivery.Error == "" || delivery.Delivered {
+		t.Errorf("delivery = %+v, want both attempts failed without a response", delivery)
+	}
+}
@@ -0,0 +1,131 @@
+// Package webhook notifies the backend of the uploader about the status
+// changes of its videos. Every change is POSTed as a JSON Event to the
+// callback URL given with the upload, signed with HMAC-SHA256 so the receiver
+// can check it was sent by us:
+//
+//	X-Webhook-Id: <event ID>
+//	X-Webhook-Timestamp: <Unix time of the attempt>
+//	X-Webhook-Signature: sha256=<hex HMAC of "<timestamp>.<body>" with WEBHOOK_SECRET>
+//
+// An event may be delivered more than once, receivers should ignore the IDs
+// they have already seen.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+const (
+	// Version of the payload, changed when fields are removed or change
+	// meaning. Fields may be added without changing it.
+	EVENT_VERSION = "1"
+
+	// Prefix of the event types, followed by the status the video moved to,
+	// e.g. video.completed
+	EVENT_TYPE_PREFIX = "video."
+
+	ID_HEADER        = "X-Webhook-Id"
+	TIMESTAMP_HEADER = "X-Webhook-Timestamp"
+	SIGNATURE_HEADER = "X-Webhook-Signature"
+	SIGNATURE_PREFIX = "sha256="
+
+	MAX_CALLBACK_URL_LENGTH = 1024
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Event is the payload of a webhook.
+type Event struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Version    string     `json:"version"`
+	OccurredAt string     `json:"occurred_at"`
+	Video      EventVideo `json:"video"`
+}
+
+type EventVideo struct {
+	Key            string       `json:"key"`
+	Status         video.Status `json:"status"`
+	PreviousStatus video.Status `json:"previous_status"`
+
+	RejectionReason string            `json:"rejection_reason,omitempty"`
+	FailureReason   string            `json:"failure_reason,omitempty"`
+	TranscodedFiles map[string]string `json:"transcoded_files,omitempty"`
+	PreviewKey      string            `json:"preview_key,omitempty"`
+	OutputVersion   int               `json:"output_version,omitempty"`
+}
+
+// NewEvent returns the event of the video moving from the status of old to
+// the one of v. The ID identifies the change, so it must be the same every
+// time the change is delivered.
+func NewEvent(id string, at time.Time, old, v video.Video) Event {
+	return Event{
+		ID:         id,
+		Type:       EVENT_TYPE_PREFIX + string(v.Status),
+		Version:    EVENT_VERSION,
+		OccurredAt: at.UTC().Format(time.RFC3339),
+		Video: EventVideo{
+			Key:             v.Key,
+			Status:          v.Status,
+			PreviousStatus:  old.Status,
+			RejectionReason: v.RejectionReason,
+			FailureReason:   v.FailureReason,
+			TranscodedFiles: v.TranscodedFiles,
+			PreviewKey:      v.PreviewKey,
+			OutputVersion:   v.OutputVersion,
+		},
+	}
+}
+
+// ValidateCallbackURL checks a callback URL given with an upload.
+func ValidateCallbackURL(raw string) error {
+	if len(raw) > MAX_CALLBACK_URL_LENGTH {
+		return fmt.Errorf("callback URL must be at most %d characters", MAX_CALLBACK_URL_LENGTH)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("callback URL must be an absolute http or https URL")
+	}
+
+	return nil
+}
+
+// Sign returns the signature header of the body sent at timestamp.
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return SIGNATURE_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a webhook received
+// with body, for receivers written in Go. Webhooks sent more than tolerance
+// ago are refused, so a captured request can't be replayed later.
+func Verify(secret []byte, timestamp, signature string, body []byte, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if age := time.Since(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
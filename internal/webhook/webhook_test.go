@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"id":"event-1"}`)
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		timestamp string
+		signature string
+		body      []byte
+		valid     bool
+	}{
+		{"valid", secret, strconv.FormatInt(now, 10), Sign(secret, now, body), body, true},
+		{"within tolerance", secret, strconv.FormatInt(now-240, 10), Sign(secret, now-240, body), body, true},
+		{"too old", secret, strconv.FormatInt(now-600, 10), Sign(secret, now-600, body), body, false},
+		{"in the future", secret, strconv.FormatInt(now+600, 10), Sign(secret, now+600, body), body, false},
+		{"invalid timestamp", secret, "now", Sign(secret, now, body), body, false},
+		{"timestamp not signed", secret, strconv.FormatInt(now-1, 10), Sign(secret, now, body), body, false},
+		{"tampered body", secret, strconv.FormatInt(now, 10), Sign(secret, now, body), []byte(`{"id":"event-2"}`), false},
+		{"other secret", []byte("other"), strconv.FormatInt(now, 10), Sign(secret, now, body), body, false},
+		{"without prefix", secret, strconv.FormatInt(now, 10), strings.TrimPrefix(Sign(secret, now, body), SIGNATURE_PREFIX), body, false},
+		{"empty", secret, strconv.FormatInt(now, 10), "", body, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.timestamp, tt.signature, tt.body, 5*time.Minute)
+			if tt.valid && err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+			if !tt.valid && err != ErrInvalidSignature {
+				t.Errorf("Verify() error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestSignHasThePublishedFormat(t *testing.T) {
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+
+	if got := Sign([]byte("secret"), 1700000000, []byte("{}")); got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://example.com/hook", true},
+		{"http://localhost:8080/hook", true},
+		{"ftp://example.com/hook", false},
+		{"/hook", false},
+		{"https://", false},
+		{"https://example.com/" + strings.Repeat("a", MAX_CALLBACK_URL_LENGTH), false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateCallbackURL(tt.url); (err == nil) != tt.valid {
+			t.Errorf("ValidateCallbackURL(%q) error = %v, want valid %v", tt.url, err, tt.valid)
+		}
+	}
+}
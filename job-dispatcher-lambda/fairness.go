@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+)
+
+// fairOrder puts the more urgent jobs first, for classes sharing a queue, and
+// interleaves the jobs of different tenants, so a tenant with a bulk upload
+// doesn't hold up everyone else. Every tenant's jobs keep the order they were
+// queued in, and tenants take turns starting with the one whose job has been
+// waiting the longest.
+func fairOrder(messages []queue.Message) []queue.Message {
+	byTenant := map[string][]queue.Message{}
+	var tenants []string
+	for _, m := range messages {
+		if _, ok := byTenant[m.Job.Tenant]; !ok {
+			tenants = append(tenants, m.Job.Tenant)
+		}
+		byTenant[m.Job.Tenant] = append(byTenant[m.Job.Tenant], m)
+	}
+
+	// RFC 3339 timestamps in UTC sort the same as the times they stand for
+	for _, t := range tenants {
+		jobs := byTenant[t]
+		sort.SliceStable(jobs, func(i, j int) bool {
+			return jobs[i].Job.EnqueuedAt < jobs[j].Job.EnqueuedAt
+		})
+	}
+
+	sort.SliceStable(tenants, func(i, j int) bool {
+		return byTenant[tenants[i]][0].Job.EnqueuedAt < byTenant[tenants[j]][0].Job.EnqueuedAt
+	})
+
+	ordered := make([]queue.Message, 0, len(messages))
+	for round := 0; len(ordered) < len(messages); round++ {
+		for _, t := range tenants {
+			if round < len(byTenant[t]) {
+				ordered = append(ordered, byTenant[t][round])
+			}
+		}
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Job.Priority > ordered[j].Job.Priority
+	})
+
+	return ordered
+}
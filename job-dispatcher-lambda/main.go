@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/eventbus"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/tracing"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// Jobs received from a queue before picking the ones to start. The bigger
+// the window, the fairer the turns between tenants.
+const RECEIVE_WINDOW = 100
+
+type Config struct {
+	config.AWS
+	Metrics       metrics.LambdaConfig
+	Events        eventbus.Config
+	Tracing       tracing.Config
+	QueueURLs     []string `env:"JOB_QUEUE_URLS" required:"true"`
+	MaxConcurrent int      `env:"MAX_CONCURRENT_TASKS" default:"10" min:"1"`
+	Task          task.Config
+	Launcher      task.LauncherConfig
+	Retry         task.RetryPolicy
+}
+
+type App struct {
+	launcher      task.Launcher
+	videos        video.VideoRepository
+	queues        queue.Queues
+	failures      *task.FailureRecorder
+	taskConfig    task.Config
+	maxConcurrent int
+}
+
+func main() {
+	logging.Setup("job-dispatcher-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("job-dispatcher-lambda", cfg.Metrics.Config())
+	tracing.Setup("job-dispatcher-lambda", cfg.Tracing)
+	cfg.Task.Environment = task.PassthroughEnvironment()
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	launcher, err := task.NewLauncher(sess, cfg.Launcher)
+	if err == nil {
+		err = cfg.Launcher.ValidateLaunch()
+	}
+	if err != nil {
+		logging.Fatal("invalid launcher configuration", err)
+	}
+
+	publisher, err := eventbus.New(sess, "job-dispatcher-lambda", cfg.Events)
+	if err != nil {
+		logging.Fatal("invalid events configuration", err)
+	}
+
+	dynamoClient := dynamodb.New(sess)
+	videos := video.NewDynamoRepository(dynamoClient)
+	queues := queue.NewSQSQueues(sqs.New(sess), cfg.QueueURLs)
+
+	app := App{
+		launcher: launcher,
+		videos:   videos,
+		queues:   queues,
+		failures: &task.FailureRecorder{
+			Videos:      videos,
+			DeadLetters: video.NewDynamoDeadLetterRepository(dynamoClient),
+			Queues:      queues,
+			Policy:      cfg.Retry,
+			Events:      publisher,
+		},
+		taskConfig:    cfg.Task,
+		maxConcurrent: cfg.MaxConcurrent,
+	}
+
+	lambda.Start(metrics.CountInvocations(app.HandleRequest))
+}
+
+// HandleRequest is invoked on a schedule. It records the queue depth and
+// starts tasks for the queued jobs until MAX_CONCURRENT_TASKS are running,
+// taking the queues in order of priority.
+func (app *App) HandleRequest(ctx context.Context, event events.EventBridgeEvent) error {
+	logger := logging.FromLambda(ctx)
+	defer tracing.Flush()
+
+	running, err := app.launcher.Running()
+	if err != nil {
+		logger.Error("failed to count running tasks", logging.ERROR, err)
+		return err
+	}
+
+	if err := app.recordMetrics(logger, running); err != nil {
+		// Not being able to monitor the queue shouldn't stop it
+		logger.Error("failed to record metrics", logging.ERROR, err)
+	}
+
+	capacity := app.maxConcurrent - running
+	for _, q := range app.queues {
+		if capacity <= 0 {
+			break
+		}
+
+		started, err := app.dispatch(ctx, logger, q, capacity)
+		if err != nil {
+			return err
+		}
+
+		capacity -= started
+	}
+
+	return nil
+}
+
+// dispatch starts tasks for up to capacity jobs of the queue, and returns
+// how many were started.
+func (app *App) dispatch(ctx context.Context, logger *slog.Logger, q queue.Queue, capacity int) (int, error) {
+	logger = logger.With("queue", q.Name())
+
+	var messages []queue.Message
+	for len(messages) < RECEIVE_WINDOW {
+		received, err := q.Receive(RECEIVE_WINDOW-len(messages), time.Second)
+		if err != nil {
+			logger.Error("failed to receive jobs", logging.ERROR, err)
+			return 0, err
+		}
+
+		if len(received) == 0 {
+			break
+		}
+
+		messages = append(messages, received...)
+	}
+
+	messages = fairOrder(messages)
+
+	started := 0
+	for i, msg := range messages {
+		if started == capacity {
+			// Make the jobs we didn't get to available for the next run
+			// right away, instead of after the visibility timeout
+			for _, m := range messages[i:] {
+				if err := q.Release(m); err != nil {
+					logger.Error("failed to release job", logging.VIDEO_KEY, m.Job.Key, logging.JOB_ID, m.Job.ID, logging.ERROR, err)
+				}
+			}
+			break
+		}
+
+		logger := logger.With(logging.VIDEO_KEY, msg.Job.Key, logging.JOB_ID, msg.Job.ID, logging.ATTEMPT, msg.Job.Attempt)
+
+		ok, err := app.start(ctx, logger, msg.Job)
+		if err != nil {
+			// Left in the queue, it is received again after the
+			// visibility timeout
+			logger.Error("failed to start job", logging.ERROR, err)
+			continue
+		}
+
+		if err := q.Delete(msg); err != nil {
+			logger.Error("failed to delete job", logging.ERROR, err)
+		}
+
+		if ok {
+			started++
+		}
+	}
+
+	return started, nil
+}
+
+// start claims the job's attempt and starts a task for it. It returns false
+// for jobs which no longer need a task, which are dropped from the queue.
+// The task continues the trace of the job.
+func (app *App) start(ctx context.Context, logger *slog.Logger, job queue.Job) (started bool, err error) {
+	ctx, span := tracing.Start(tracing.Extract(ctx, job.TraceParent), "dispatch", tracing.VIDEO_KEY.String(job.Key), tracing.JOB_ID.String(job.ID))
+	defer func() { tracing.End(span, err) }()
+	logger = logging.WithTrace(logger, ctx)
+
+	v, err := app.videos.Get(job.Key)
+	if err == video.ErrNotFound {
+		logger.Info("video not found, dropping its job")
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Claim the attempt, which makes sure the video wasn't cancelled or
+	// failed while the job was waiting and that a job delivered twice
+	// starts a single task. The task only updates the video while it is
+	// worked on by its job, and the heartbeat lets the stuck job reaper
+	// find the claim if this run dies before the task is started.
+	err = app.videos.Update(job.Key, video.Update{
+		ClaimAttempt: job.Attempt,
+		JobID:        job.ID,
+		HeartbeatAt:  time.Now().UTC().Format(time.RFC3339),
+	})
+	if err == video.ErrInvalidTransition {
+		logger.Info("video is not queued, dropping its job", "status", v.Status)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	v.JobID = job.ID
+
+	taskArn, err := task.Run(app.launcher, app.taskConfig, task.Job{
+		ID:       job.ID,
+		Bucket:   job.Bucket,
+		Key:      job.Key,
+		Class:    job.Class,
+		Profiles: job.Profiles,
+		Version:  job.Version,
+
+		TraceParent: tracing.Inject(ctx),
+	})
+	if err != nil {
+		logger.Error("failed to start task", logging.ERROR, err)
+		metrics.CountFailure("launch")
+		tracing.Fail(span, err)
+
+		if err := app.failures.Record(*v, job.Attempt, err.Error()); err != nil {
+			app.release(logger, job)
+			return false, err
+		}
+		return false, nil
+	}
+
+	err = app.videos.Update(job.Key, video.Update{
+		TaskArn:     taskArn,
+		HeartbeatAt: time.Now().UTC().Format(time.RFC3339),
+		ForJob:      job.ID,
+	})
+	if err != nil {
+		logger.Error("failed to record task", logging.TASK_ID, taskArn, logging.ERROR, err)
+	}
+
+	logger.Info("started task", logging.TASK_ID, taskArn)
+	if availableAt, ok := availableSince(job); ok {
+		logging.StageSince(logger, "queue", availableAt)()
+	}
+	return true, nil
+}
+
+// release undoes the claim of the job's attempt, so the job left in the queue
+// can claim it again once it is received after the visibility timeout.
+func (app *App) release(logger *slog.Logger, job queue.Job) {
+	err := app.videos.Update(job.Key, video.Update{
+		ReleaseAttempt: job.Attempt,
+		NextRetryAt:    time.Now().UTC().Format(time.RFC3339),
+		From:           []video.Status{video.STATUS_QUEUED},
+		ForJob:         job.ID,
+	})
+	if err == video.ErrInvalidTransition {
+		logger.Warn("video moved on, not releasing its attempt")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to release attempt", logging.ERROR, err)
+	}
+}
+
+// availableSince returns when the job became available after its last
+// enqueue, so the backoff of a retry doesn't count as time spent waiting
+// for a task. Jobs enqueued before AvailableAt was added fall back to
+// EnqueuedAt.
+func availableSince(job queue.Job) (time.Time, bool) {
+	at := job.AvailableAt
+	if at == "" {
+		at = job.EnqueuedAt
+	}
+
+	availableAt, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return availableAt, true
+}
+
+// recordMetrics records the depth of every queue and the number of running
+// tasks, which is what the queue is drained against.
+func (app *App) recordMetrics(logger *slog.Logger, running int) error {
+	metrics.Put(metrics.RUNNING_TASKS, float64(running), metrics.UNIT_COUNT, nil)
+
+	for _, q := range app.queues {
+		depth, err := q.Depth()
+		if err != nil {
+			return err
+		}
+
+		logger.Info("queue depth", "queue", q.Name(), "depth", depth, "running", running)
+		metrics.Put(metrics.QUEUE_DEPTH, float64(depth), metrics.UNIT_COUNT, metrics.Dimensions{metrics.QUEUE: q.Name()})
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+type testApp struct {
+	*App
+	launcher    *task.MemoryLauncher
+	videos      *video.MemoryRepository
+	deadLetters *video.MemoryDeadLetterRepository
+	queue       *queue.MemoryQueue
+	metrics     *metrics.MemoryRecorder
+}
+
+func newTestApp(t *testing.T, maxConcurrent int) *testApp {
+	t.Helper()
+
+	recorder := metrics.NewMemoryRecorder()
+	previous := metrics.Default()
+	metrics.SetDefault(recorder)
+	t.Cleanup(func() { metrics.SetDefault(previous) })
+
+	a := &testApp{
+		launcher:    task.NewMemoryLauncher(),
+		videos:      video.NewMemoryRepository(),
+		deadLetters: &video.MemoryDeadLetterRepository{},
+		queue:       queue.NewMemoryQueue("standard"),
+		metrics:     recorder,
+	}
+
+	queues := queue.Queues{a.queue}
+	a.App = &App{
+		launcher: a.launcher,
+		videos:   a.videos,
+		queues:   queues,
+		failures: &task.FailureRecorder{
+			Videos:      a.videos,
+			DeadLetters: a.deadLetters,
+			Queues:      queues,
+			Policy:      task.RetryPolicy{MaxAttempts: 2},
+		},
+		taskConfig:    task.Config{OutputBucketName: "output"},
+		maxConcurrent: maxConcurrent,
+	}
+
+	return a
+}
+
+// enqueue adds a queued video along with its job.
+func (a *testApp) enqueue(t *testing.T, key string) {
+	t.Helper()
+
+	if err := a.videos.Put(video.Video{Key: key, Status: video.STATUS_QUEUED, SourceBucket: "temp"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.queue.Enqueue(queue.Job{Key: key, Bucket: "temp", Attempt: 1}, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleRequestStartsJobsUpToCapacity(t *testing.T) {
+	a := newTestApp(t, 2)
+
+	// A task left running from an earlier run takes one of the slots
+	if _, err := a.launcher.Launch(task.Spec{Key: "running"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a/source/a.mp4", "b/source/b.mp4", "c/source/c.mp4"} {
+		a.enqueue(t, key)
+	}
+
+	if err := a.HandleRequest(context.Background(), events.EventBridgeEvent{}); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+
+	launched := a.launcher.Launched()
+	if len(launched) != 2 || launched[1].Key != "a/source/a.mp4" {
+		t.Fatalf("launched %+v, want the task of a/source/a.mp4 next to the running one", launched)
+	}
+	if env := launched[1].Environment; env["OBJECT_KEY"] != "a/source/a.mp4" || env["OUTPUT_BUCKET_NAME"] != "output" {
+		t.Errorf("task environment = %v", env)
+	}
+
+	v, _ := a.videos.Get("a/source/a.mp4")
+	if v.Attempts != 1 || v.TaskArn != "task-2" || v.JobID == "" {
+		t.Errorf("started video has attempts %d, task %q and job %q", v.Attempts, v.TaskArn, v.JobID)
+	}
+
+	// The jobs without a slot are released for the next run
+	if depth, _ := a.queue.Depth(); depth != 2 {
+		t.Errorf("queue depth = %d, want 2", depth)
+	}
+	if messages, _ := a.queue.Receive(10, time.Millisecond); len(messages) != 2 {
+		t.Errorf("received %d jobs after the run, want the 2 released ones", len(messages))
+	}
+
+	running := a.metrics.Values(metrics.RUNNING_TASKS)
+	if len(running) != 1 || running[0].Value != 1 {
+		t.Errorf("RunningTasks = %+v, want 1", running)
+	}
+
+	depth := a.metrics.Values(metrics.QUEUE_DEPTH)
+	if len(depth) != 1 || depth[0].Value != 3 || depth[0].Dimensions[metrics.QUEUE] != "standard" {
+		t.Errorf("QueueDepth = %+v, want 3 for the standard queue", depth)
+	}
+
+	stages := a.metrics.Values(metrics.STAGE_DURATION)
+	if len(stages) != 1 || stages[0].Dimensions[metrics.STAGE] != "queue" {
+		t.Errorf("StageDuration = %+v, want the queue stage of the started job", stages)
+	}
+}
+
+func TestHandleRequestDropsJobsOfVideosNoLongerQueued(t *testing.T) {
+	a := newTestApp(t, 10)
+
+	a.enqueue(t, "a/source/a.mp4")
+	if err := a.videos.Update("a/source/a.mp4", video.Update{Status: video.STATUS_CANCELLED}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The job of a deleted video
+	if err := a.queue.Enqueue(queue.Job{Key: "b/source/b.mp4", Attempt: 1}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.HandleRequest(context.Background(), events.EventBridgeEvent{}); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+
+	if launched := a.launcher.Launched(); len(launched) != 0 {
+		t.Errorf("launched %+v, want no task", launched)
+	}
+
+	if depth, _ := a.queue.Depth(); depth != 0 {
+		t.Errorf("queue depth = %d, want the jobs dropped", depth)
+	}
+}
+
+func TestHandleRequestRetriesJobsWhoseTaskFailedToStart(t *testing.T) {
+	a := newTestApp(t, 10)
+	a.launcher.Err = errors.New("no capacity")
+
+	a.enqueue(t, "a/source/a.mp4")
+
+	if err := a.HandleRequest(context.Background(), events.EventBridgeEvent{}); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+
+	v, _ := a.videos.Get("a/source/a.mp4")
+	if v.Status != video.STATUS_QUEUED || v.Attempts != 1 || v.LastError != "no capacity" {
+		t.Errorf("video is %s after %d attempts with %q, want queued for a retry", v.Status, v.Attempts, v.LastError)
+	}
+
+	// The failed job was deleted and its retry queued in its place
+	if depth, _ := a.queue.Depth(); depth != 1 {
+		t.Fatalf("queue depth = %d, want the retry", depth)
+	}
+
+	failures := a.metrics.Values(metrics.FAILURES)
+	if len(failures) != 1 || failures[0].Dimensions[metrics.REASON] != "launch" {
+		t.Errorf("Failures = %+v, want a launch failure", failures)
+	}
+
+	if len(a.deadLetters.DeadLetters) != 0 {
+		t.Errorf("wrote dead letters %+v with attempts left", a.deadLetters.DeadLetters)
+	}
+}
+
+// failingQueue fails to enqueue, the retries of a failed launch among others.
+type failingQueue struct {
+	*queue.MemoryQueue
+}
+
+func (q failingQueue) Enqueue(job queue.Job, delay time.Duration) error {
+	return errors.New("queue unavailable")
+}
+
+func TestHandleRequestReleasesTheAttemptWhenTheFailureIsntRecorded(t *testing.T) {
+	a := newTestApp(t, 10)
+	a.launcher.Err = errors.New("no capacity")
+	a.failures.Queues = queue.Queues{failingQueue{a.queue}}
+
+	a.enqueue(t, "a/source/a.mp4")
+
+	if err := a.HandleRequest(context.Background(), events.EventBridgeEvent{}); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+
+	// The job is left in the queue, and can claim the attempt again once
+	// it is received after the visibility timeout
+	if depth, _ := a.queue.Depth(); depth != 1 {
+		t.Errorf("queue depth = %d, want the job left in the queue", depth)
+	}
+
+	v, _ := a.videos.Get("a/source/a.mp4")
+	if v.Status != video.STATUS_QUEUED || v.Attempts != 0 {
+		t.Errorf("video is %s after %d attempts, want queued with the attempt released", v.Status, v.Attempts)
+	}
+	if err := a.videos.Update("a/source/a.mp4", video.Update{ClaimAttempt: 1}); err != nil {
+		t.Errorf("claiming the attempt again error = %v", err)
+	}
+}
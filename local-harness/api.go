@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+// Routes of the API, in place of the API Gateway in front of the Lambdas
+var routes = map[string]string{
+	"/upload":      "upload-lambda",
+	"/videos":      "get-videos-lambda",
+	"/video":       "get-video-info-lambda",
+	"/cancel":      "cancel-video-lambda",
+	"/delete":      "delete-video-lambda",
+	"/retranscode": "retranscode-video-lambda",
+}
+
+// API serves the routes and lets any Lambda be invoked with an event of its
+// own at /invoke/<name>.
+type API struct {
+	Functions map[string]*Function
+}
+
+func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The frontend is opened from another origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if name, ok := strings.CutPrefix(r.URL.Path, "/invoke/"); ok {
+		api.invoke(w, name, body)
+		return
+	}
+
+	name, ok := routes[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	sourceIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+
+	request := events.APIGatewayProxyRequest{
+		Resource:   r.URL.Path,
+		Path:       r.URL.Path,
+		HTTPMethod: r.Method,
+		Headers:    map[string]string{},
+		Body:       string(body),
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:        uuid.NewString(),
+			Stage:            "local",
+			RequestTimeEpoch: time.Now().UnixMilli(),
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  sourceIP,
+				UserAgent: r.UserAgent(),
+			},
+		},
+	}
+	for header := range r.Header {
+		request.Headers[header] = r.Header.Get(header)
+	}
+
+	payload, err := api.Functions[name].Invoke(request)
+	if err != nil {
+		// What API Gateway answers when the handler returns an error
+		log.Printf("%s %s, %v\n", r.Method, r.URL.Path, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, `{"message": "Internal server error"}`)
+		return
+	}
+
+	var response events.APIGatewayProxyResponse
+	if err := json.Unmarshal(payload, &response); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	for header, value := range response.Headers {
+		w.Header().Set(header, value)
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	w.WriteHeader(response.StatusCode)
+	io.WriteString(w, response.Body)
+}
+
+// invoke hands the body as the event to the Lambda and writes back what it
+// returned.
+func (api *API) invoke(w http.ResponseWriter, name string, event []byte) {
+	f, ok := api.Functions[name]
+	if !ok {
+		http.Error(w, "unknown function "+name, http.StatusNotFound)
+		return
+	}
+
+	if len(event) == 0 {
+		event = []byte("{}")
+	}
+
+	payload, err := f.Invoke(json.RawMessage(event))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
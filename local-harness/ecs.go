@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/google/uuid"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+)
+
+const ECS_TARGET_PREFIX = "AmazonEC2ContainerServiceV20141113."
+
+type KeyValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type ContainerOverride struct {
+	Name        string     `json:"name"`
+	Environment []KeyValue `json:"environment"`
+}
+
+type TaskOverride struct {
+	ContainerOverrides []ContainerOverride `json:"containerOverrides"`
+}
+
+type Container struct {
+	Name     string `json:"name"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Task is the part of an ECS task the Lambdas read, in the shape of both the
+// ECS API and the task state change events.
+type Task struct {
+	TaskArn       string       `json:"taskArn"`
+	ClusterArn    string       `json:"clusterArn"`
+	LastStatus    string       `json:"lastStatus"`
+	DesiredStatus string       `json:"desiredStatus"`
+	StartedBy     string       `json:"startedBy,omitempty"`
+	StopCode      string       `json:"stopCode,omitempty"`
+	StoppedReason string       `json:"stoppedReason,omitempty"`
+	Containers    []Container  `json:"containers"`
+	Overrides     TaskOverride `json:"overrides"`
+}
+
+// FakeECS serves the ECS calls of the Lambdas, running the transcoder as a
+// local process for every task instead of a container on Fargate, and
+// accepts the CloudWatch metrics of the dispatcher.
+type FakeECS struct {
+	// Transcoder binary and the environment every task gets, to which the
+	// container overrides are added
+	Binary string
+	Env    []string
+
+	// Called once a task stopped, like the task state change events
+	OnStop func(t Task)
+
+	mu        sync.Mutex
+	tasks     map[string]*Task
+	processes map[string]*exec.Cmd
+}
+
+func (e *FakeECS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.Header.Get("X-Amz-Target")
+	if !strings.HasPrefix(target, ECS_TARGET_PREFIX) {
+		e.serveCloudWatch(w, r)
+		return
+	}
+
+	var input struct {
+		Cluster       string       `json:"cluster"`
+		StartedBy     string       `json:"startedBy"`
+		DesiredStatus string       `json:"desiredStatus"`
+		Task          string       `json:"task"`
+		Tasks         []string     `json:"tasks"`
+		Reason        string       `json:"reason"`
+		Overrides     TaskOverride `json:"overrides"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeECSError(w, "ClientException", err.Error())
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch op := strings.TrimPrefix(target, ECS_TARGET_PREFIX); op {
+	case "RunTask":
+		t, err := e.run(input.Cluster, input.StartedBy, input.Overrides)
+		if err != nil {
+			writeECSError(w, "ServerException", err.Error())
+			return
+		}
+
+		writeJSON(w, map[string]interface{}{"tasks": []Task{*t}, "failures": []interface{}{}})
+
+	case "DescribeTasks":
+		tasks, failures := []Task{}, []map[string]string{}
+		for _, arn := range input.Tasks {
+			if t, ok := e.tasks[arn]; ok {
+				tasks = append(tasks, *t)
+			} else {
+				failures = append(failures, map[string]string{"arn": arn, "reason": "MISSING"})
+			}
+		}
+
+		writeJSON(w, map[string]interface{}{"tasks": tasks, "failures": failures})
+
+	case "ListTasks":
+		arns := []string{}
+		for arn, t := range e.tasks {
+			if input.StartedBy != "" && t.StartedBy != input.StartedBy {
+				continue
+			}
+			if input.DesiredStatus != "" && t.DesiredStatus != input.DesiredStatus {
+				continue
+			}
+
+			arns = append(arns, arn)
+		}
+
+		writeJSON(w, map[string]interface{}{"taskArns": arns})
+
+	case "StopTask":
+		t, ok := e.tasks[input.Task]
+		if !ok {
+			writeECSError(w, "InvalidParameterException", "The referenced task was not found.")
+			return
+		}
+
+		if t.DesiredStatus != "STOPPED" {
+			t.DesiredStatus = "STOPPED"
+			t.StopCode = "UserInitiated"
+			t.StoppedReason = input.Reason
+			e.processes[t.TaskArn].Process.Signal(syscall.SIGTERM)
+		}
+
+		writeJSON(w, map[string]interface{}{"task": *t})
+
+	default:
+		writeECSError(w, "UnsupportedOperation", fmt.Sprintf("%s is not supported by the local harness", op))
+	}
+}
+
+// run starts the transcoder for a task. The caller holds mu.
+func (e *FakeECS) run(cluster, startedBy string, overrides TaskOverride) (*Task, error) {
+	env := append([]string{}, e.Env...)
+	for _, c := range overrides.ContainerOverrides {
+		if c.Name != task.CONTAINER_NAME {
+			continue
+		}
+
+		for _, kv := range c.Environment {
+			env = append(env, kv.Name+"="+kv.Value)
+		}
+	}
+
+	id := uuid.NewString()
+
+	// The transcoder works in its current directory
+	dir, err := os.MkdirTemp("", "transcoder-"+id)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(e.Binary)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = prefixWriter("transcoder " + id[:8])
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to start transcoder, %v", err)
+	}
+
+	t := &Task{
+		TaskArn:       "arn:aws:ecs:local:000000000000:task/" + cluster + "/" + id,
+		ClusterArn:    "arn:aws:ecs:local:000000000000:cluster/" + cluster,
+		LastStatus:    "RUNNING",
+		DesiredStatus: "RUNNING",
+		StartedBy:     startedBy,
+		Containers:    []Container{{Name: task.CONTAINER_NAME}},
+		Overrides:     overrides,
+	}
+
+	if e.tasks == nil {
+		e.tasks = map[string]*Task{}
+		e.processes = map[string]*exec.Cmd{}
+	}
+	e.tasks[t.TaskArn] = t
+	e.processes[t.TaskArn] = cmd
+
+	log.Printf("started task %s\n", t.TaskArn)
+
+	go e.wait(t, cmd, dir)
+
+	return t, nil
+}
+
+// wait marks the task stopped once its process exits.
+func (e *FakeECS) wait(t *Task, cmd *exec.Cmd, dir string) {
+	cmd.Wait()
+	os.RemoveAll(dir)
+
+	e.mu.Lock()
+	code := cmd.ProcessState.ExitCode()
+	t.LastStatus = "STOPPED"
+	t.DesiredStatus = "STOPPED"
+	t.Containers[0].ExitCode = &code
+	if t.StopCode == "" {
+		t.StopCode = "EssentialContainerExited"
+		t.StoppedReason = "Essential container in task exited"
+	}
+	stopped := *t
+	e.mu.Unlock()
+
+	log.Printf("task %s stopped with exit code %d\n", t.TaskArn, code)
+
+	if e.OnStop != nil {
+		e.OnStop(stopped)
+	}
+}
+
+// StopAll stops the running transcoders, when the harness exits.
+func (e *FakeECS) StopAll() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for arn, cmd := range e.processes {
+		if e.tasks[arn].LastStatus != "STOPPED" {
+			cmd.Process.Signal(syscall.SIGTERM)
+		}
+	}
+}
+
+// serveCloudWatch accepts the PutMetricData calls of the dispatcher, which
+// logs the metrics it records anyway.
+func (e *FakeECS) serveCloudWatch(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("Action") != "PutMetricData" {
+		http.Error(w, "unsupported request", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<PutMetricDataResponse xmlns="http://monitoring.amazonaws.com/doc/2010-08-01/"><ResponseMetadata><RequestId>%s</RequestId></ResponseMetadata></PutMetricDataResponse>`, uuid.NewString())
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeECSError(w http.ResponseWriter, code, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": message})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/google/uuid"
+)
+
+// newEvent returns an EventBridge event of the given source and type.
+func newEvent(source, detailType string, detail interface{}) (events.EventBridgeEvent, error) {
+	b, err := json.Marshal(detail)
+	if err != nil {
+		return events.EventBridgeEvent{}, err
+	}
+
+	return events.EventBridgeEvent{
+		Version:    "0",
+		ID:         uuid.NewString(),
+		DetailType: detailType,
+		Source:     source,
+		AccountID:  "000000000000",
+		Time:       time.Now().UTC(),
+		Region:     "local",
+		Detail:     b,
+	}, nil
+}
+
+// UploadWatcher stands in for the S3 notifications to EventBridge. It lists
+// the bucket and sends an "Object Created" event for every object it hadn't
+// seen yet, or which was overwritten.
+type UploadWatcher struct {
+	S3       s3iface.S3API
+	Bucket   string
+	Interval time.Duration
+	Handler  *Function
+
+	seen map[string]string
+}
+
+// Run watches the bucket until ctx is done. The objects found on the first
+// listing are taken as already handled.
+func (u *UploadWatcher) Run(ctx context.Context) {
+	u.seen = map[string]string{}
+	if err := u.poll(false); err != nil {
+		log.Printf("failed to list %s, %v\n", u.Bucket, err)
+	}
+
+	ticker := time.NewTicker(u.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.poll(true); err != nil {
+				log.Printf("failed to list %s, %v\n", u.Bucket, err)
+			}
+		}
+	}
+}
+
+// poll lists the bucket, sending the events of the new objects when notify
+// is set.
+func (u *UploadWatcher) poll(notify bool) error {
+	var created []*s3.Object
+	current := map[string]string{}
+
+	err := u.S3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(u.Bucket),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			key, etag := aws.StringValue(object.Key), aws.StringValue(object.ETag)
+			current[key] = etag
+
+			if u.seen[key] != etag {
+				created = append(created, object)
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	// Deleted objects are forgotten, so uploading them again is noticed
+	u.seen = current
+
+	if !notify {
+		return nil
+	}
+
+	for _, object := range created {
+		event, err := newEvent("aws.s3", "Object Created", map[string]interface{}{
+			"version": "0",
+			"bucket":  map[string]string{"name": u.Bucket},
+			"object": map[string]interface{}{
+				"key":       aws.StringValue(object.Key),
+				"size":      aws.Int64Value(object.Size),
+				"etag":      trimQuotes(aws.StringValue(object.ETag)),
+				"sequencer": fmt.Sprintf("%016X", aws.TimeValue(object.LastModified).UnixNano()),
+			},
+			"request-id":        uuid.NewString(),
+			"requester":         "000000000000",
+			"source-ip-address": "127.0.0.1",
+			"reason":            "PutObject",
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Printf("object created, %s/%s\n", u.Bucket, aws.StringValue(object.Key))
+
+		if _, err := u.Handler.Invoke(event); err != nil {
+			log.Printf("failed to handle upload of %s, %v\n", aws.StringValue(object.Key), err)
+		}
+	}
+
+	return nil
+}
+
+func trimQuotes(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
+
+// Schedule invokes the Lambda every interval until ctx is done, like an
+// EventBridge schedule rule.
+func Schedule(ctx context.Context, f *Function, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			event, err := newEvent("aws.events", "Scheduled Event", struct{}{})
+			if err != nil {
+				log.Printf("failed to create scheduled event, %v\n", err)
+				continue
+			}
+
+			if _, err := f.Invoke(event); err != nil {
+				log.Printf("scheduled run failed, %v\n", err)
+			}
+		}
+	}
+}
+
+// TaskStopped sends the state change of a stopped task to the Lambda, like
+// the EventBridge rule on the ECS events.
+func TaskStopped(f *Function, t Task) {
+	event, err := newEvent("aws.ecs", "ECS Task State Change", t)
+	if err != nil {
+		log.Printf("failed to create task state change event, %v\n", err)
+		return
+	}
+
+	if _, err := f.Invoke(event); err != nil {
+		log.Printf("failed to handle stop of task %s, %v\n", t.TaskArn, err)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/google/uuid"
+)
+
+// How long an invocation may run, the maximum of a real Lambda
+const INVOKE_TIMEOUT = 15 * time.Minute
+
+// Function is a Lambda run as a local process. Binaries built without the
+// lambda.norpc tag serve their handler over net/rpc when _LAMBDA_SERVER_PORT
+// is set, which is how the harness invokes the unmodified HandleRequest.
+type Function struct {
+	Name string
+	Dir  string
+
+	binary string
+	env    []string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	client *rpc.Client
+}
+
+// Build compiles the Lambda into binDir.
+func (f *Function) Build(binDir string, env []string) error {
+	f.binary = filepath.Join(binDir, f.Name)
+	f.env = env
+
+	cmd := exec.Command("go", "build", "-o", f.binary, ".")
+	cmd.Dir = f.Dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to build %s, %v", f.Name, err)
+	}
+
+	return nil
+}
+
+// start runs the process and connects to it. The caller holds mu.
+func (f *Function) start() error {
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(f.binary)
+	cmd.Env = append(append([]string{}, f.env...),
+		"_LAMBDA_SERVER_PORT="+strconv.Itoa(port),
+		"AWS_LAMBDA_FUNCTION_NAME="+f.Name,
+	)
+	cmd.Stdout = prefixWriter(f.Name)
+	cmd.Stderr = prefixWriter(f.Name)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s, %v", f.Name, err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	// The configuration is loaded before the handler is served, a process
+	// exiting right away has an invalid one
+	addr := net.JoinHostPort("localhost", strconv.Itoa(port))
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		client, err := rpc.Dial("tcp", addr)
+		if err == nil {
+			f.cmd, f.client = cmd, client
+			return nil
+		}
+
+		select {
+		case <-exited:
+			return fmt.Errorf("%s exited, see its output above", f.Name)
+		default:
+		}
+	}
+
+	cmd.Process.Kill()
+	return fmt.Errorf("%s did not start, see its output above", f.Name)
+}
+
+// Invoke calls the handler with the event and returns its response. The
+// process is started on the first invocation, and again after it died, as
+// Lambda does after a handler calls log.Fatal.
+func (f *Function) Invoke(event interface{}) ([]byte, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.client == nil {
+		if err := f.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	deadline := time.Now().Add(INVOKE_TIMEOUT)
+	req := &messages.InvokeRequest{
+		Payload:            payload,
+		RequestId:          uuid.NewString(),
+		InvokedFunctionArn: "arn:aws:lambda:local:000000000000:function:" + f.Name,
+		Deadline: messages.InvokeRequest_Timestamp{
+			Seconds: deadline.Unix(),
+			Nanos:   int64(deadline.Nanosecond()),
+		},
+	}
+
+	var resp messages.InvokeResponse
+	if err := f.client.Call("Function.Invoke", req, &resp); err != nil {
+		f.stop()
+		return nil, fmt.Errorf("%s died, %v", f.Name, err)
+	}
+
+	if resp.Error != nil {
+		return nil, fmt.Errorf("%s failed, %s", f.Name, resp.Error.Message)
+	}
+
+	return resp.Payload, nil
+}
+
+// Stop kills the process, if it is running.
+func (f *Function) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stop()
+}
+
+func (f *Function) stop() {
+	if f.client != nil {
+		f.client.Close()
+		f.client = nil
+	}
+
+	if f.cmd != nil {
+		f.cmd.Process.Kill()
+		f.cmd = nil
+	}
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port, %v", err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// prefixWriter writes the output of a process to the log of the harness,
+// each line prefixed with name.
+func prefixWriter(name string) *logWriter {
+	return &logWriter{logger: log.New(os.Stderr, fmt.Sprintf("%-28s ", name), 0)}
+}
+
+type logWriter struct {
+	logger *log.Logger
+	buf    []byte
+	mu     sync.Mutex
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.logger.Print(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
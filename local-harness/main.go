@@ -0,0 +1,291 @@
+// Command local-harness runs the whole pipeline on a single machine, against
+// MinIO, DynamoDB Local and ElasticMQ in place of S3, DynamoDB and SQS (see
+// docker-compose.yml).
+//
+// Every Lambda is built and run as a local process serving its handler, the
+// API Lambdas behind a local HTTP server. New objects of the temporary bucket
+// are sent to upload-event-handle-lambda like the S3 events, the scheduled
+// Lambdas are invoked on their own timers, and the transcoding tasks are run
+// as local processes by a stand-in for the ECS API. ffmpeg and ffprobe must
+// be installed.
+//
+//	docker compose -f local-harness/docker-compose.yml up -d
+//	cd local-harness && go run .
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+)
+
+const (
+	TEMPORARY_BUCKET_NAME = "video-transcoding-temp"
+	OUTPUT_BUCKET_NAME    = "video-transcoding-output"
+
+	CLUSTER_NAME = "local"
+)
+
+// Queues of the scheduling classes, the most urgent first
+var queueNames = []string{"video-transcoding-express", "video-transcoding-standard", "video-transcoding-bulk"}
+
+// The Lambdas run by the harness, expired-videos-lambda is left out since
+// DynamoDB Local never expires items
+var functionNames = []string{
+	"upload-lambda",
+	"upload-event-handle-lambda",
+	"job-dispatcher-lambda",
+	"task-state-change-lambda",
+	"stuck-job-reaper-lambda",
+	"get-videos-lambda",
+	"get-video-info-lambda",
+	"cancel-video-lambda",
+	"delete-video-lambda",
+	"purge-deleted-videos-lambda",
+	"retranscode-video-lambda",
+}
+
+// Variables holding the access tokens of the API Lambdas
+var accessTokenVariables = []string{
+	"UPLOAD_LAMBDA_ACCESS_TOKEN",
+	"GET_VIDEOS_ACCESS_TOKEN",
+	"GET_VIDEO_INFO_ACCESS_TOKEN",
+	"CANCEL_VIDEO_ACCESS_TOKEN",
+	"DELETE_VIDEO_ACCESS_TOKEN",
+	"RETRANSCODE_VIDEO_ACCESS_TOKEN",
+}
+
+func main() {
+	root := flag.String("root", "..", "root of the repository")
+	addr := flag.String("addr", "localhost:8080", "address the API is served on")
+	awsAddr := flag.String("aws-addr", "localhost:4566", "address the ECS and CloudWatch stand-in is served on")
+	s3URL := flag.String("s3", "http://localhost:9000", "endpoint of the S3 compatible store")
+	dynamoURL := flag.String("dynamodb", "http://localhost:8000", "endpoint of DynamoDB Local")
+	sqsURL := flag.String("sqs", "http://localhost:9324", "endpoint of the SQS compatible queue")
+	accessKey := flag.String("access-key", "localaccesskey", "access key of the stand-ins")
+	secretKey := flag.String("secret-key", "localsecretkey", "secret key of the stand-ins")
+	token := flag.String("token", "local", "access token of every API Lambda")
+	watchInterval := flag.Duration("watch-interval", 2*time.Second, "how often the temporary bucket is listed for uploads")
+	dispatchInterval := flag.Duration("dispatch-interval", 5*time.Second, "how often the job dispatcher runs")
+	reapInterval := flag.Duration("reap-interval", time.Minute, "how often the stuck job reaper runs")
+	purgeInterval := flag.Duration("purge-interval", time.Minute, "how often deleted videos are purged")
+	flag.Parse()
+
+	rootDir, err := filepath.Abs(*root)
+	if err != nil {
+		log.Fatalf("invalid root, %v", err)
+	}
+
+	for _, tool := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			log.Printf("%s is not installed, the transcoding tasks will fail\n", tool)
+		}
+	}
+
+	local := config.AWS{
+		Region: config.DEFAULT_REGION,
+		Endpoints: config.Endpoints{
+			Default:  "http://" + *awsAddr,
+			S3:       *s3URL,
+			DynamoDB: *dynamoURL,
+			SQS:      *sqsURL,
+		},
+	}
+
+	sess, err := local.Session()
+	if err != nil {
+		log.Fatalf("failed to create AWS session, %v", err)
+	}
+	sess = sess.Copy(&aws.Config{Credentials: credentials.NewStaticCredentials(*accessKey, *secretKey, "")})
+
+	retainedBucketName := os.Getenv("RETAINED_BUCKET_NAME")
+
+	s3Cl := s3.New(sess)
+	for _, bucket := range []string{TEMPORARY_BUCKET_NAME, OUTPUT_BUCKET_NAME, retainedBucketName} {
+		if bucket == "" {
+			continue
+		}
+
+		if err := createBucket(s3Cl, bucket); err != nil {
+			log.Fatalf("failed to create bucket %s, is the S3 stand-in running? %v", bucket, err)
+		}
+	}
+
+	// The players fetch the renditions straight from the bucket
+	if err := allowPublicRead(s3Cl, OUTPUT_BUCKET_NAME); err != nil {
+		log.Fatalf("failed to make %s public, %v", OUTPUT_BUCKET_NAME, err)
+	}
+
+	queueURLs, err := createQueues(sqs.New(sess))
+	if err != nil {
+		log.Fatalf("failed to create queues, is the SQS stand-in running? %v", err)
+	}
+
+	binDir, err := os.MkdirTemp("", "local-harness")
+	if err != nil {
+		log.Fatalf("failed to create directory for the binaries, %v", err)
+	}
+	defer os.RemoveAll(binDir)
+
+	// Variables set by the harness win over the ones of its environment,
+	// which can tune the rest, e.g. MAX_CONCURRENT_TASKS or SOURCE_RETENTION
+	env := append(os.Environ(),
+		"AWS_REGION="+local.Region,
+		"AWS_ACCESS_KEY_ID="+*accessKey,
+		"AWS_SECRET_ACCESS_KEY="+*secretKey,
+		"AWS_SESSION_TOKEN=",
+		"AWS_ENDPOINT_URL="+local.Default,
+		"AWS_ENDPOINT_URL_S3="+local.S3,
+		"AWS_ENDPOINT_URL_DYNAMODB="+local.DynamoDB,
+		"AWS_ENDPOINT_URL_SQS="+local.SQS,
+		"TEMPORARY_BUCKET_NAME="+TEMPORARY_BUCKET_NAME,
+		"OUTPUT_BUCKET_NAME="+OUTPUT_BUCKET_NAME,
+		"BUCKET_REGION="+local.Region,
+		"JOB_QUEUE_URLS="+strings.Join(queueURLs, ","),
+		"ECS_CLUSTER="+CLUSTER_NAME,
+		"ECS_TASK_DEFINITION=video-transcoding",
+		"ECS_SUBNETS=local",
+		// Used when started with LAUNCHER=process
+		"LAUNCHER_PROCESS_BINARY="+filepath.Join(binDir, "transcoder"),
+	)
+	for _, name := range accessTokenVariables {
+		env = append(env, name+"="+*token)
+	}
+
+	log.Printf("building the Lambdas and the transcoder into %s\n", binDir)
+
+	functions := map[string]*Function{}
+	for _, name := range functionNames {
+		f := &Function{Name: name, Dir: filepath.Join(rootDir, name)}
+		if err := f.Build(binDir, env); err != nil {
+			log.Fatal(err)
+		}
+
+		functions[name] = f
+	}
+
+	transcoder := &Function{Name: "transcoder", Dir: filepath.Join(rootDir, "transcoding-image-for-ecs")}
+	if err := transcoder.Build(binDir, env); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createTables(rootDir, env); err != nil {
+		log.Fatalf("failed to create tables, is DynamoDB Local running? %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	ecs := &FakeECS{
+		Binary: transcoder.binary,
+		Env:    env,
+		OnStop: func(t Task) {
+			TaskStopped(functions["task-state-change-lambda"], t)
+		},
+	}
+	defer ecs.StopAll()
+
+	go serve(*awsAddr, ecs)
+	go serve(*addr, &API{Functions: functions})
+
+	watcher := &UploadWatcher{
+		S3:       s3Cl,
+		Bucket:   TEMPORARY_BUCKET_NAME,
+		Interval: *watchInterval,
+		Handler:  functions["upload-event-handle-lambda"],
+	}
+	go watcher.Run(ctx)
+
+	go Schedule(ctx, functions["job-dispatcher-lambda"], *dispatchInterval)
+	go Schedule(ctx, functions["stuck-job-reaper-lambda"], *reapInterval)
+	go Schedule(ctx, functions["purge-deleted-videos-lambda"], *purgeInterval)
+
+	log.Printf("API on http://%s with access token %q, routes:\n", *addr, *token)
+	for path, name := range routes {
+		log.Printf("  POST %-13s %s\n", path, name)
+	}
+	log.Printf("  POST /invoke/<lambda> with the event of your own\n")
+	log.Printf("outputs on %s/%s\n", local.S3, OUTPUT_BUCKET_NAME)
+
+	<-ctx.Done()
+
+	log.Printf("stopping\n")
+	for _, f := range functions {
+		f.Stop()
+	}
+}
+
+func serve(addr string, handler http.Handler) {
+	if err := http.ListenAndServe(addr, handler); err != nil {
+		log.Fatalf("failed to serve on %s, %v", addr, err)
+	}
+}
+
+func createBucket(cl *s3.S3, bucket string) error {
+	_, err := cl.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou || aerr.Code() == s3.ErrCodeBucketAlreadyExists) {
+		return nil
+	}
+
+	return err
+}
+
+func allowPublicRead(cl *s3.S3, bucket string) error {
+	policy := fmt.Sprintf(`{
+	"Version": "2012-10-17",
+	"Statement": [{
+		"Effect": "Allow",
+		"Principal": {"AWS": ["*"]},
+		"Action": ["s3:GetObject"],
+		"Resource": ["arn:aws:s3:::%s/*"]
+	}]
+}`, bucket)
+
+	_, err := cl.PutBucketPolicy(&s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucket),
+		Policy: aws.String(policy),
+	})
+
+	return err
+}
+
+func createQueues(cl *sqs.SQS) ([]string, error) {
+	var urls []string
+	for _, name := range queueNames {
+		output, err := cl.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String(name)})
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, aws.StringValue(output.QueueUrl))
+	}
+
+	return urls, nil
+}
+
+// createTables runs create-video-table against DynamoDB Local.
+func createTables(rootDir string, env []string) error {
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = filepath.Join(rootDir, "create-video-table")
+	cmd.Env = env
+	cmd.Stdout = prefixWriter("create-video-table")
+	cmd.Stderr = prefixWriter("create-video-table")
+
+	return cmd.Run()
+}
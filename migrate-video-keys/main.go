@@ -0,0 +1,185 @@
+// Command migrate-video-keys moves videos uploaded before the
+// "<videoID>/<rendition>/<file>" key layout over to it. Objects are copied to
+// their new keys and the item is re-created under the new key, the old
+// objects are only removed when -delete-old is passed.
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/keys"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+type Config struct {
+	config.AWS
+	TemporaryBucketName string `env:"TEMPORARY_BUCKET_NAME" required:"true"`
+	OutputBucketName    string `env:"OUTPUT_BUCKET_NAME" required:"true"`
+}
+
+type App struct {
+	dynamoCl *dynamodb.DynamoDB
+	s3Cl     *s3.S3
+
+	temporaryBucketName string
+	outputBucketName    string
+	dryRun              bool
+	deleteOld           bool
+}
+
+func main() {
+	logging.Setup("migrate-video-keys")
+
+	dryRun := flag.Bool("dry-run", false, "only print what would be migrated")
+	deleteOld := flag.Bool("delete-old", false, "delete the objects stored under the old keys")
+	flag.Parse()
+
+	var cfg Config
+	config.MustLoad(&cfg)
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	app := App{
+		dynamoCl:            dynamodb.New(sess),
+		s3Cl:                s3.New(sess),
+		temporaryBucketName: cfg.TemporaryBucketName,
+		outputBucketName:    cfg.OutputBucketName,
+		dryRun:              *dryRun,
+		deleteOld:           *deleteOld,
+	}
+
+	migrated := 0
+	err = app.dynamoCl.ScanPages(&dynamodb.ScanInput{
+		TableName: aws.String(video.TABLE_NAME),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			key := aws.StringValue(item["Key"].S)
+			if !keys.IsLegacy(key) {
+				continue
+			}
+
+			if err := app.migrateItem(item); err != nil {
+				slog.Error("failed to migrate video", logging.VIDEO_KEY, key, logging.ERROR, err)
+				os.Exit(1)
+			}
+			migrated++
+		}
+
+		return true
+	})
+	if err != nil {
+		logging.Fatal("failed to scan videos", err)
+	}
+
+	slog.Info("migrated videos", "count", migrated)
+}
+
+func (app *App) migrateItem(item map[string]*dynamodb.AttributeValue) error {
+	oldKey := aws.StringValue(item["Key"].S)
+	newKey := keys.SourceKey(keys.Parse(oldKey).VideoID, oldKey)
+
+	slog.Info("migrating video", logging.VIDEO_KEY, oldKey, "new_key", newKey)
+
+	var moves [][3]string
+	moves = append(moves, [3]string{app.temporaryBucketName, oldKey, newKey})
+
+	if files, ok := item["TranscodedFiles"]; ok && files.M != nil {
+		for rendition, v := range files.M {
+			oldFile := aws.StringValue(v.S)
+			newFile := keys.RenditionKey(newKey, rendition, strings.TrimPrefix(path.Ext(oldFile), "."))
+
+			moves = append(moves, [3]string{app.outputBucketName, oldFile, newFile})
+			files.M[rendition] = &dynamodb.AttributeValue{S: aws.String(newFile)}
+		}
+	}
+
+	if preview, ok := item["PreviewKey"]; ok && preview.S != nil {
+		oldFile := aws.StringValue(preview.S)
+		newFile := keys.RenditionKey(newKey, keys.PREVIEW_RENDITION, strings.TrimPrefix(path.Ext(oldFile), "."))
+
+		moves = append(moves, [3]string{app.outputBucketName, oldFile, newFile})
+		item["PreviewKey"] = &dynamodb.AttributeValue{S: aws.String(newFile)}
+	}
+
+	for _, move := range moves {
+		slog.Info("moving object", "bucket", move[0], "key", move[1], "new_key", move[2])
+	}
+
+	if app.dryRun {
+		return nil
+	}
+
+	for _, move := range moves {
+		if err := app.copyObject(move[0], move[1], move[2]); err != nil {
+			return err
+		}
+	}
+
+	item["Key"] = &dynamodb.AttributeValue{S: aws.String(newKey)}
+
+	_, err := app.dynamoCl.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(video.TABLE_NAME),
+		Item:      item,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = app.dynamoCl.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(video.TABLE_NAME),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Key": {
+				S: aws.String(oldKey),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if !app.deleteOld {
+		return nil
+	}
+
+	for _, move := range moves {
+		_, err := app.s3Cl.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(move[0]),
+			Key:    aws.String(move[1]),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyObject copies the object within the bucket. Objects that no longer
+// exist, like sources cleaned up after transcoding, are skipped.
+func (app *App) copyObject(bucket string, from string, to string) error {
+	_, err := app.s3Cl.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		CopySource: aws.String(bucket + "/" + strings.ReplaceAll(url.PathEscape(from), "%2F", "/")),
+		Key:        aws.String(to),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		slog.Warn("skipping missing object", "bucket", bucket, "key", from)
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/cleanup"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// Recorded as the actor of the purges in the audit records
+const ACTOR = "purge-deleted-videos-lambda"
+
+type Config struct {
+	config.AWS
+	Metrics metrics.LambdaConfig
+	Buckets cleanup.Buckets
+}
+
+type App struct {
+	videos video.VideoRepository
+	audit  video.AuditRepository
+	purger *cleanup.Purger
+}
+
+func main() {
+	logging.Setup("purge-deleted-videos-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("purge-deleted-videos-lambda", cfg.Metrics.Config())
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	dynamoClient := dynamodb.New(sess)
+	videos := video.NewDynamoRepository(dynamoClient)
+
+	app := App{
+		videos: videos,
+		audit:  video.NewDynamoAuditRepository(dynamoClient),
+		purger: &cleanup.Purger{
+			S3:      s3.New(sess),
+			Videos:  videos,
+			Buckets: cfg.Buckets,
+		},
+	}
+
+	lambda.Start(metrics.CountInvocations(app.HandleRequest))
+}
+
+// HandleRequest is invoked on a schedule and purges every deleted video
+// whose grace period is over.
+func (app *App) HandleRequest(ctx context.Context, event events.EventBridgeEvent) error {
+	logger := logging.FromLambda(ctx)
+
+	videos, err := app.videos.ListByStatus(video.STATUS_DELETED)
+	if err != nil {
+		logger.Error("failed to list deleted videos", logging.ERROR, err)
+		return err
+	}
+
+	now := time.Now()
+	for _, v := range videos {
+		logger := logger.With(logging.VIDEO_KEY, v.Key)
+
+		purgeAfter, err := time.Parse(time.RFC3339, v.PurgeAfter)
+		if err != nil {
+			logger.Warn("video has an invalid purge time", "purge_after", v.PurgeAfter)
+			continue
+		}
+
+		if now.Before(purgeAfter) {
+			continue
+		}
+
+		purged, err := app.purger.Purge(v)
+		if err != nil {
+			// Left deleted, the next run tries again
+			logger.Error("failed to purge video", logging.ERROR, err)
+			continue
+		}
+
+		err = app.audit.Put(video.AuditRecord{
+			Key:     v.Key,
+			At:      time.Now().Format(time.RFC3339Nano),
+			Action:  video.AUDIT_ACTION_PURGE,
+			Actor:   ACTOR,
+			Status:  v.Status,
+			Objects: purged,
+		})
+		if err != nil {
+			logger.Error("failed to write audit record", logging.ERROR, err)
+			return err
+		}
+
+		logger.Info("purged video", "objects", len(purged))
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/profile"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/tracing"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+type Config struct {
+	config.AWS
+	Metrics     metrics.LambdaConfig
+	Tracing     tracing.Config
+	AccessToken string   `env:"RETRANSCODE_VIDEO_ACCESS_TOKEN" required:"true"`
+	QueueURLs   []string `env:"JOB_QUEUE_URLS" required:"true"`
+}
+
+type RequestBody struct {
+	VideoKey    string `json:"video_key"`
+	AccessToken string `json:"access_token"`
+
+	// Renditions to produce, every profile when empty
+	Profiles []string `json:"profiles,omitempty"`
+}
+
+type Response struct {
+	VideoKey string `json:"video_key"`
+	Version  int    `json:"output_version"`
+}
+
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+type App struct {
+	token  string
+	videos video.VideoRepository
+	queues queue.Queues
+}
+
+func main() {
+	logging.Setup("retranscode-video-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("retranscode-video-lambda", cfg.Metrics.Config())
+	tracing.Setup("retranscode-video-lambda", cfg.Tracing)
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	app := App{
+		token:  cfg.AccessToken,
+		videos: video.NewDynamoRepository(dynamodb.New(sess)),
+		queues: queue.NewSQSQueues(sqs.New(sess), cfg.QueueURLs),
+	}
+
+	lambda.Start(metrics.CountRequests(app.HandleRequest))
+}
+
+func (app *App) HandleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	logger := logging.FromLambda(ctx)
+
+	defer tracing.Flush()
+	ctx, span := tracing.Start(ctx, "retranscode")
+	defer span.End()
+
+	var reqBody RequestBody
+	err := json.Unmarshal([]byte(request.Body), &reqBody)
+	if err != nil {
+		logger.Error("failed to unmarshal request body", logging.ERROR, err)
+		return nil, err
+	}
+
+	if reqBody.AccessToken == "" {
+		errResp, err := generateErrorResponse("access token is missing", 400)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	if reqBody.AccessToken != app.token {
+		errResp, err := generateErrorResponse("invalid access token", 401)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	if reqBody.VideoKey == "" {
+		errResp, err := generateErrorResponse("video key is missing", 400)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	if _, err := profile.Select(reqBody.Profiles); err != nil {
+		errResp, err := generateErrorResponse(err.Error(), 400)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+
+	logger = logging.WithTrace(logger.With(logging.VIDEO_KEY, reqBody.VideoKey), ctx)
+	span.SetAttributes(tracing.VIDEO_KEY.String(reqBody.VideoKey))
+
+	v, err := app.videos.Get(reqBody.VideoKey)
+	if err == video.ErrNotFound {
+		errResp, err := generateErrorResponse("video not found", 404)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+	if err != nil {
+		logger.Error("failed to get video from dynamodb", logging.ERROR, err)
+		return nil, err
+	}
+
+	version, err := task.Retranscode(ctx, app.videos, app.queues, *v, reqBody.Profiles)
+	if err == video.ErrInvalidTransition || err == task.ErrSourceMissing {
+		msg := fmt.Sprintf("video is %s, only completed or failed videos can be re-transcoded", v.Status)
+		if err == task.ErrSourceMissing {
+			msg = err.Error()
+		}
+
+		errResp, err := generateErrorResponse(msg, 409)
+		if err != nil {
+			logger.Error("failed to generate error response", logging.ERROR, err)
+			return nil, err
+		}
+
+		return errResp, nil
+	}
+	if err != nil {
+		logger.Error("failed to re-transcode video", logging.ERROR, err)
+		return nil, err
+	}
+
+	logger.Info("queued re-transcode", "version", version, "profiles", reqBody.Profiles)
+
+	resp, err := json.Marshal(Response{VideoKey: reqBody.VideoKey, Version: version})
+	if err != nil {
+		logger.Error("failed to marshal response", logging.ERROR, err)
+		return nil, err
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: 202,
+		Body:       string(resp),
+	}, nil
+}
+
+func generateErrorResponse(msg string, status int) (*events.APIGatewayProxyResponse, error) {
+	errMsg := ErrorResponse{Message: msg}
+	body, err := json.Marshal(errMsg)
+	if err != nil {
+		slog.Error("failed to marshal error response", logging.ERROR, err)
+		return nil, err
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Body:       string(body),
+	}, nil
+}
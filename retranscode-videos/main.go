@@ -0,0 +1,174 @@
+// Command retranscode-videos queues a re-transcode for a single video, or for
+// every video matching the filters, to pick up a new or changed profile. The
+// new outputs are written under a new version, players keep using the current
+// ones until a video's job completes.
+//
+//	retranscode-videos -profiles 2160p -missing
+//	retranscode-videos -key <videoID>/source/<file> -profiles 720p,1080p
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/profile"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+type Config struct {
+	config.AWS
+	QueueURLs []string `env:"JOB_QUEUE_URLS" required:"true"`
+}
+
+// Filter selects the videos to re-transcode.
+type Filter struct {
+	Status         video.Status
+	UploadedBefore time.Time
+	Tenant         string
+
+	// Only the videos missing one of the profiles
+	Missing  bool
+	Profiles []string
+}
+
+func (f Filter) Match(v video.Video) bool {
+	if !f.UploadedBefore.IsZero() {
+		uploadedAt, err := time.Parse(time.RFC3339, v.UploadedAt)
+		if err != nil || !uploadedAt.Before(f.UploadedBefore) {
+			return false
+		}
+	}
+
+	if f.Tenant != "" && v.Tenant != f.Tenant {
+		return false
+	}
+
+	if f.Missing {
+		names := f.Profiles
+		if len(names) == 0 {
+			names = profile.Names()
+		}
+
+		for _, name := range names {
+			if _, ok := v.TranscodedFiles[name]; !ok {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func main() {
+	logging.Setup("retranscode-videos")
+
+	key := flag.String("key", "", "re-transcode only the video with this key")
+	profiles := flag.String("profiles", "", "comma separated renditions to produce, every profile when empty")
+	status := flag.String("status", string(video.STATUS_COMPLETED), "re-transcode the videos in this status, completed or failed")
+	uploadedBefore := flag.String("uploaded-before", "", "re-transcode the videos uploaded before this RFC 3339 time")
+	tenant := flag.String("tenant", "", "re-transcode the videos of this tenant")
+	missing := flag.Bool("missing", false, "re-transcode the videos missing one of the profiles")
+	limit := flag.Int("limit", 0, "re-transcode at most this many videos, no limit when 0")
+	dryRun := flag.Bool("dry-run", false, "only print what would be re-transcoded")
+	flag.Parse()
+
+	filter := Filter{
+		Status:  video.Status(*status),
+		Tenant:  *tenant,
+		Missing: *missing,
+	}
+
+	if *profiles != "" {
+		filter.Profiles = strings.Split(*profiles, ",")
+	}
+
+	if _, err := profile.Select(filter.Profiles); err != nil {
+		logging.Fatal("invalid -profiles", err)
+	}
+
+	if filter.Status != video.STATUS_COMPLETED && filter.Status != video.STATUS_FAILED {
+		logging.Fatal("invalid -status", fmt.Errorf("only completed or failed videos can be re-transcoded, not %q", *status))
+	}
+
+	if *uploadedBefore != "" {
+		t, err := time.Parse(time.RFC3339, *uploadedBefore)
+		if err != nil {
+			logging.Fatal("invalid -uploaded-before", err)
+		}
+		filter.UploadedBefore = t
+	}
+
+	var cfg Config
+	config.MustLoad(&cfg)
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	videos := video.NewDynamoRepository(dynamodb.New(sess))
+	queues := queue.NewSQSQueues(sqs.New(sess), cfg.QueueURLs)
+
+	var candidates []video.Video
+	if *key != "" {
+		v, err := videos.Get(*key)
+		if err != nil {
+			slog.Error("failed to get video", logging.VIDEO_KEY, *key, logging.ERROR, err)
+			os.Exit(1)
+		}
+		candidates = append(candidates, *v)
+	} else {
+		candidates, err = videos.ListByStatus(filter.Status)
+		if err != nil {
+			slog.Error("failed to list videos", "status", filter.Status, logging.ERROR, err)
+			os.Exit(1)
+		}
+	}
+
+	queued := 0
+	for _, v := range candidates {
+		if *limit > 0 && queued == *limit {
+			break
+		}
+
+		if *key == "" && !filter.Match(v) {
+			continue
+		}
+
+		logger := slog.With(logging.VIDEO_KEY, v.Key)
+
+		if *dryRun {
+			logger.Info("would re-transcode video")
+			queued++
+			continue
+		}
+
+		version, err := task.Retranscode(context.Background(), videos, queues, v, filter.Profiles)
+		if err == video.ErrInvalidTransition || err == task.ErrSourceMissing {
+			logger.Warn("skipping video", logging.ERROR, err)
+			continue
+		}
+		if err != nil {
+			logger.Error("failed to re-transcode video", logging.ERROR, err)
+			os.Exit(1)
+		}
+
+		logger.Info("queued re-transcode", "version", version)
+		queued++
+	}
+
+	slog.Info("queued videos", "count", queued)
+}
@@ -0,0 +1,201 @@
+// Command storage-report prints the storage consumed by every video, its
+// source and its outputs, with the totals of each tenant. Objects whose video
+// is gone are reported under the video ID they are stored under.
+//
+//	storage-report
+//	storage-report -tenant acme -json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/cleanup"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/keys"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// Tenant and status the objects without a video are reported under
+const ORPHANED = "-"
+
+type Config struct {
+	config.AWS
+	Buckets cleanup.Buckets
+}
+
+// Usage is the storage consumed by a single video.
+type Usage struct {
+	VideoID     string       `json:"video_id"`
+	Key         string       `json:"key,omitempty"`
+	Tenant      string       `json:"tenant"`
+	Status      video.Status `json:"status"`
+	SourceBytes int64        `json:"source_bytes"`
+	OutputBytes int64        `json:"output_bytes"`
+	Objects     int          `json:"objects"`
+	ExpiresAt   int64        `json:"expires_at,omitempty"`
+}
+
+func (u Usage) TotalBytes() int64 {
+	return u.SourceBytes + u.OutputBytes
+}
+
+type Report struct {
+	Videos  []Usage          `json:"videos"`
+	Tenants map[string]int64 `json:"tenants"`
+	Total   int64            `json:"total"`
+}
+
+func main() {
+	logging.Setup("storage-report")
+
+	tenant := flag.String("tenant", "", "only report the videos of this tenant")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	buckets := cfg.Buckets
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	videos, err := video.NewDynamoRepository(dynamodb.New(sess)).List()
+	if err != nil {
+		logging.Fatal("failed to list videos", err)
+	}
+
+	usages := map[string]*Usage{}
+	for _, v := range videos {
+		id := keys.Parse(v.Key).VideoID
+
+		t := v.Tenant
+		if t == "" {
+			t = video.DEFAULT_TENANT
+		}
+
+		usages[id] = &Usage{VideoID: id, Key: v.Key, Tenant: t, Status: v.Status, ExpiresAt: v.ExpiresAt}
+	}
+
+	usage := func(key string) *Usage {
+		id := keys.Parse(key).VideoID
+		if usages[id] == nil {
+			usages[id] = &Usage{VideoID: id, Tenant: ORPHANED, Status: ORPHANED}
+		}
+
+		return usages[id]
+	}
+
+	s3Cl := s3.New(sess)
+	for _, bucket := range []string{buckets.Temporary, buckets.Retained, buckets.Output} {
+		if bucket == "" {
+			continue
+		}
+
+		err := s3Cl.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, object := range page.Contents {
+				u := usage(aws.StringValue(object.Key))
+				u.Objects++
+
+				if bucket == buckets.Output {
+					u.OutputBytes += aws.Int64Value(object.Size)
+				} else {
+					u.SourceBytes += aws.Int64Value(object.Size)
+				}
+			}
+
+			return true
+		})
+		if err != nil {
+			slog.Error("failed to list objects", "bucket", bucket, logging.ERROR, err)
+			os.Exit(1)
+		}
+	}
+
+	report := Report{Videos: []Usage{}, Tenants: map[string]int64{}}
+	for _, u := range usages {
+		if *tenant != "" && u.Tenant != *tenant {
+			continue
+		}
+
+		report.Videos = append(report.Videos, *u)
+		report.Tenants[u.Tenant] += u.TotalBytes()
+		report.Total += u.TotalBytes()
+	}
+
+	// Biggest videos first
+	sort.Slice(report.Videos, func(i, j int) bool {
+		if report.Videos[i].TotalBytes() != report.Videos[j].TotalBytes() {
+			return report.Videos[i].TotalBytes() > report.Videos[j].TotalBytes()
+		}
+
+		return report.Videos[i].VideoID < report.Videos[j].VideoID
+	})
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			logging.Fatal("failed to encode report", err)
+		}
+		return
+	}
+
+	printReport(report)
+}
+
+func printReport(report Report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "VIDEO\tTENANT\tSTATUS\tOBJECTS\tSOURCE\tOUTPUTS\tTOTAL")
+	for _, u := range report.Videos {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			u.VideoID, u.Tenant, u.Status, u.Objects,
+			formatBytes(u.SourceBytes), formatBytes(u.OutputBytes), formatBytes(u.TotalBytes()))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "TENANT\tTOTAL")
+
+	tenants := make([]string, 0, len(report.Tenants))
+	for t := range report.Tenants {
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+
+	for _, t := range tenants {
+		fmt.Fprintf(w, "%s\t%s\n", t, formatBytes(report.Tenants[t]))
+	}
+	fmt.Fprintf(w, "all\t%s\n", formatBytes(report.Total))
+
+	w.Flush()
+}
+
+// formatBytes formats n in the largest binary unit it has a whole one of.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
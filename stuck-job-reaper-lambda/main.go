@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/eventbus"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// Statuses a video can get stuck in when the task working on it, or the
+// Lambda that was about to queue or start its job, dies. Queued videos wait
+// in the job queue for as long as it takes the dispatcher to get to them, so
+// only the ones whose attempt was claimed are reaped, see isClaimed.
+var reapedStatuses = []video.Status{
+	video.STATUS_UPLOADED,
+	video.STATUS_QUEUED,
+	video.STATUS_PROCESSING,
+	video.STATUS_UPLOADING,
+}
+
+type Config struct {
+	config.AWS
+	Metrics   metrics.LambdaConfig
+	Events    eventbus.Config
+	QueueURLs []string `env:"JOB_QUEUE_URLS" required:"true"`
+	Launcher  task.LauncherConfig
+
+	// How long a job may go without a heartbeat before it is reaped
+	HeartbeatTimeout time.Duration `env:"HEARTBEAT_TIMEOUT_SECONDS" default:"300" unit:"seconds" min:"1"`
+
+	Retry task.RetryPolicy
+}
+
+type App struct {
+	launcher         task.Launcher
+	videos           video.VideoRepository
+	failures         *task.FailureRecorder
+	heartbeatTimeout time.Duration
+}
+
+func main() {
+	logging.Setup("stuck-job-reaper-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("stuck-job-reaper-lambda", cfg.Metrics.Config())
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	launcher, err := task.NewLauncher(sess, cfg.Launcher)
+	if err != nil {
+		logging.Fatal("invalid launcher configuration", err)
+	}
+
+	publisher, err := eventbus.New(sess, "stuck-job-reaper-lambda", cfg.Events)
+	if err != nil {
+		logging.Fatal("invalid events configuration", err)
+	}
+
+	dynamoClient := dynamodb.New(sess)
+	videos := video.NewDynamoRepository(dynamoClient)
+
+	app := App{
+		launcher: launcher,
+		videos:   videos,
+		failures: &task.FailureRecorder{
+			Videos:      videos,
+			DeadLetters: video.NewDynamoDeadLetterRepository(dynamoClient),
+			Queues:      queue.NewSQSQueues(sqs.New(sess), cfg.QueueURLs),
+			Policy:      cfg.Retry,
+			Events:      publisher,
+		},
+		heartbeatTimeout: cfg.HeartbeatTimeout,
+	}
+
+	lambda.Start(metrics.CountInvocations(app.HandleRequest))
+}
+
+// HandleRequest is invoked on a schedule and reaps every video whose job
+// stopped making progress. A video which can't be reaped is left for the
+// next run, the others are reaped regardless.
+func (app *App) HandleRequest(ctx context.Context, event events.EventBridgeEvent) error {
+	logger := logging.FromLambda(ctx)
+	now := time.Now()
+	failed := 0
+
+	for _, status := range reapedStatuses {
+		videos, err := app.videos.ListByStatus(status)
+		if err != nil {
+			logger.Error("failed to list videos", "status", status, logging.ERROR, err)
+			return err
+		}
+
+		for _, v := range videos {
+			logger := logger.With(logging.VIDEO_KEY, v.Key, logging.JOB_ID, v.JobID, logging.TASK_ID, v.TaskArn)
+
+			if v.Status == video.STATUS_QUEUED && !isClaimed(v) {
+				continue
+			}
+
+			if !app.isStale(logger, v, now) {
+				continue
+			}
+
+			if err := app.reap(logger, v); err != nil {
+				logger.Error("failed to reap video", logging.ERROR, err)
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to reap %d videos", failed)
+	}
+
+	return nil
+}
+
+// isStale reports whether nothing was heard of the video's job for longer
+// than the heartbeat timeout.
+func (app *App) isStale(logger *slog.Logger, v video.Video, now time.Time) bool {
+	last := v.HeartbeatAt
+	if last == "" {
+		last = v.UploadedAt
+	}
+
+	t, err := time.Parse(time.RFC3339, last)
+	if err != nil {
+		logger.Warn("video has an invalid heartbeat", "heartbeat_at", last)
+		return false
+	}
+
+	return now.Sub(t) > app.heartbeatTimeout
+}
+
+// isClaimed reports whether the attempt of a queued video was claimed by the
+// dispatcher or a queue worker, which deletes its job from the queue. Once
+// the task is started the video moves on to processing, so a claim left
+// without a heartbeat since means the job was lost.
+func isClaimed(v video.Video) bool {
+	return v.Attempts > 0 && v.NextRetryAt == ""
+}
+
+// reap looks at the task of the stale video, stopping it if it is still
+// running, and hands the video over to be retried or failed. The tasks of the
+// queue workers are shared by the jobs of other videos and left running, a
+// worker still on the job drops it once its updates are refused for the job
+// of the new attempt.
+func (app *App) reap(logger *slog.Logger, v video.Video) error {
+	if v.TaskArn == "" {
+		logger.Warn("video has no task", "status", v.Status)
+		metrics.CountFailure("no_task")
+		return app.failures.Record(v, v.Attempts, fmt.Sprintf("no job was queued while %s", v.Status))
+	}
+
+	status, err := app.launcher.Describe(v.TaskArn)
+	if err == task.ErrTaskNotFound {
+		logger.Warn("task no longer exists")
+		metrics.CountFailure("task_missing")
+		return app.failures.Record(v, v.Attempts, "task no longer exists")
+	}
+	if err != nil {
+		logger.Error("failed to describe task", logging.ERROR, err)
+		return err
+	}
+
+	if status.Stopped {
+		reason := status.Reason
+		if reason == "" {
+			reason = "task stopped before finishing the job"
+		}
+
+		logger.Warn("task stopped", "reason", reason)
+		metrics.CountFailure("task_stopped")
+		return app.failures.Record(v, v.Attempts, reason)
+	}
+
+	// The task is alive but has stopped reporting progress, most likely a
+	// hung ffmpeg. Stop it so it doesn't run up the bill.
+	reason := fmt.Sprintf("no heartbeat for more than %s", app.heartbeatTimeout)
+
+	if !status.Launched {
+		logger.Warn("worker stopped reporting progress, leaving it running", "reason", reason)
+		metrics.CountFailure("heartbeat_timeout")
+		return app.failures.Record(v, v.Attempts, reason)
+	}
+
+	if err := app.launcher.Stop(v.TaskArn, reason); err != nil {
+		logger.Error("failed to stop task", logging.ERROR, err)
+		return err
+	}
+
+	logger.Warn("stopped stuck task", "reason", reason)
+	metrics.CountFailure("heartbeat_timeout")
+	return app.failures.Record(v, v.Attempts, reason)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+func TestReapStopsOnlyTheTasksOfTheLauncher(t *testing.T) {
+	launcher := task.NewMemoryLauncher()
+	videos := video.NewMemoryRepository()
+
+	app := &App{
+		launcher: launcher,
+		videos:   videos,
+		failures: &task.FailureRecorder{
+			Videos:      videos,
+			DeadLetters: &video.MemoryDeadLetterRepository{},
+			Queues:      queue.Queues{queue.NewMemoryQueue("standard")},
+			Policy:      task.RetryPolicy{MaxAttempts: 3},
+		},
+		heartbeatTimeout: time.Minute,
+	}
+
+	launched, err := launcher.Launch(task.Spec{Key: "launched"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker := launcher.AddWorker()
+
+	stale := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	videos.Put(video.Video{Key: "launched", Status: video.STATUS_PROCESSING, TaskArn: launched, HeartbeatAt: stale, Attempts: 1})
+	videos.Put(video.Video{Key: "worker", Status: video.STATUS_PROCESSING, TaskArn: worker, HeartbeatAt: stale, Attempts: 1})
+
+	if err := app.HandleRequest(context.Background(), events.EventBridgeEvent{}); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+
+	if status, _ := launcher.Describe(launched); !status.Stopped {
+		t.Errorf("launched task wasn't stopped")
+	}
+	if status, _ := launcher.Describe(worker); status.Stopped {
+		t.Errorf("worker was stopped, it is shared by the jobs of other videos")
+	}
+
+	// Both videos are retried either way
+	for _, key := range []string{"launched", "worker"} {
+		if v, _ := videos.Get(key); v.Status != video.STATUS_QUEUED || v.LastError == "" {
+			t.Errorf("%s: video is %s with error %q, want it queued for a retry", key, v.Status, v.LastError)
+		}
+	}
+}
+
+func TestReapRequeuesClaimedAttemptsWithoutATask(t *testing.T) {
+	videos := video.NewMemoryRepository()
+	q := queue.NewMemoryQueue("standard")
+
+	app := &App{
+		launcher: task.NewMemoryLauncher(),
+		videos:   videos,
+		failures: &task.FailureRecorder{
+			Videos:      videos,
+			DeadLetters: &video.MemoryDeadLetterRepository{},
+			Queues:      queue.Queues{q},
+			Policy:      task.RetryPolicy{MaxAttempts: 3},
+		},
+		heartbeatTimeout: time.Minute,
+	}
+
+	stale := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	videos.Put(video.Video{Key: "claimed", Status: video.STATUS_QUEUED, UploadedAt: stale, HeartbeatAt: stale, Attempts: 1})
+	// Waiting in the queue for their first attempt or a retry
+	videos.Put(video.Video{Key: "waiting", Status: video.STATUS_QUEUED, UploadedAt: stale})
+	videos.Put(video.Video{Key: "retry", Status: video.STATUS_QUEUED, UploadedAt: stale, HeartbeatAt: stale, Attempts: 1, NextRetryAt: stale})
+
+	if err := app.HandleRequest(context.Background(), events.EventBridgeEvent{}); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+
+	messages, _ := q.Receive(10, 0)
+	if len(messages) != 1 || messages[0].Job.Key != "claimed" || messages[0].Job.Attempt != 2 {
+		t.Fatalf("queued %+v, want the next attempt of the claimed video", messages)
+	}
+
+	for _, key := range []string{"waiting", "retry"} {
+		if v, _ := videos.Get(key); v.LastError != "" {
+			t.Errorf("%s: video was reaped with %q while waiting in the queue", key, v.LastError)
+		}
+	}
+}
+
+// failingLauncher can't describe the task with the given ID.
+type failingLauncher struct {
+	*task.MemoryLauncher
+	id string
+}
+
+func (l failingLauncher) Describe(id string) (*task.Status, error) {
+	if id == l.id {
+		return nil, errors.New("throttled")
+	}
+
+	return l.MemoryLauncher.Describe(id)
+}
+
+func TestReapCarriesOnPastAVideoItCantReap(t *testing.T) {
+	launcher := task.NewMemoryLauncher()
+	videos := video.NewMemoryRepository()
+
+	app := &App{
+		launcher: failingLauncher{launcher, "task-1"},
+		videos:   videos,
+		failures: &task.FailureRecorder{
+			Videos:      videos,
+			DeadLetters: &video.MemoryDeadLetterRepository{},
+			Queues:      queue.Queues{queue.NewMemoryQueue("standard")},
+			Policy:      task.RetryPolicy{MaxAttempts: 3},
+		},
+		heartbeatTimeout: time.Minute,
+	}
+
+	stale := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	videos.Put(video.Video{Key: "a", Status: video.STATUS_PROCESSING, TaskArn: "task-1", HeartbeatAt: stale, Attempts: 1})
+	videos.Put(video.Video{Key: "b", Status: video.STATUS_PROCESSING, TaskArn: "task-2", HeartbeatAt: stale, Attempts: 1})
+
+	if err := app.HandleRequest(context.Background(), events.EventBridgeEvent{}); err == nil {
+		t.Errorf("HandleRequest() error = nil, want the video which couldn't be reaped reported")
+	}
+
+	if v, _ := videos.Get("a"); v.Status != video.STATUS_PROCESSING {
+		t.Errorf("a: video is %s, want it left for the next run", v.Status)
+	}
+	if v, _ := videos.Get("b"); v.Status != video.STATUS_QUEUED {
+		t.Errorf("b: video is %s, want it queued for a retry", v.Status)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/eventbus"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+const (
+	TASK_STATE_CHANGE_DETAIL_TYPE      = "ECS Task State Change"
+	BATCH_JOB_STATE_CHANGE_DETAIL_TYPE = "Batch Job State Change"
+)
+
+// TaskStateChangeDetail is the part of the ECS task state change event we
+// need to tell which video the task was transcoding and why it stopped.
+type TaskStateChangeDetail struct {
+	TaskArn       string           `json:"taskArn"`
+	LastStatus    string           `json:"lastStatus"`
+	StopCode      string           `json:"stopCode"`
+	StoppedReason string           `json:"stoppedReason"`
+	Containers    []Container      `json:"containers"`
+	Overrides     ecs.TaskOverride `json:"overrides"`
+}
+
+type Container struct {
+	Name     string `json:"name"`
+	ExitCode *int   `json:"exitCode"`
+	Reason   string `json:"reason"`
+}
+
+// BatchJobStateChangeDetail is the same for the jobs of the Batch launcher.
+type BatchJobStateChangeDetail struct {
+	JobID        string `json:"jobId"`
+	Status       string `json:"status"`
+	StatusReason string `json:"statusReason"`
+	Container    struct {
+		ExitCode    *int   `json:"exitCode"`
+		Reason      string `json:"reason"`
+		Environment []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"environment"`
+	} `json:"container"`
+}
+
+type Config struct {
+	config.AWS
+	Metrics   metrics.LambdaConfig
+	Events    eventbus.Config
+	QueueURLs []string `env:"JOB_QUEUE_URLS" required:"true"`
+	Retry     task.RetryPolicy
+}
+
+type App struct {
+	videos   video.VideoRepository
+	failures *task.FailureRecorder
+}
+
+func main() {
+	logging.Setup("task-state-change-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("task-state-change-lambda", cfg.Metrics.Config())
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	publisher, err := eventbus.New(sess, "task-state-change-lambda", cfg.Events)
+	if err != nil {
+		logging.Fatal("invalid events configuration", err)
+	}
+
+	dynamoClient := dynamodb.New(sess)
+	videos := video.NewDynamoRepository(dynamoClient)
+
+	app := App{
+		videos: videos,
+		failures: &task.FailureRecorder{
+			Videos:      videos,
+			DeadLetters: video.NewDynamoDeadLetterRepository(dynamoClient),
+			Queues:      queue.NewSQSQueues(sqs.New(sess), cfg.QueueURLs),
+			Policy:      cfg.Retry,
+			Events:      publisher,
+		},
+	}
+
+	lambda.Start(metrics.CountInvocations(app.HandleRequest))
+}
+
+// HandleRequest is invoked by an EventBridge rule forwarding the state
+// changes of the transcoding tasks, ECS tasks or Batch jobs.
+func (app *App) HandleRequest(ctx context.Context, event events.EventBridgeEvent) error {
+	logger := logging.FromLambda(ctx)
+
+	switch event.DetailType {
+	case TASK_STATE_CHANGE_DETAIL_TYPE:
+		var detail TaskStateChangeDetail
+		if err := json.Unmarshal(event.Detail, &detail); err != nil {
+			logger.Error("failed to unmarshal event detail", logging.ERROR, err)
+			return err
+		}
+
+		return app.HandleTaskStateChange(logger, detail)
+	case BATCH_JOB_STATE_CHANGE_DETAIL_TYPE:
+		var detail BatchJobStateChangeDetail
+		if err := json.Unmarshal(event.Detail, &detail); err != nil {
+			logger.Error("failed to unmarshal event detail", logging.ERROR, err)
+			return err
+		}
+
+		return app.HandleBatchJobStateChange(logger, detail)
+	default:
+		logger.Warn("ignoring event", "detail_type", event.DetailType)
+		return nil
+	}
+}
+
+func (app *App) HandleTaskStateChange(logger *slog.Logger, detail TaskStateChangeDetail) error {
+	if detail.LastStatus != "STOPPED" {
+		return nil
+	}
+
+	return app.handleStopped(logger, detail.TaskArn, task.ObjectKey(&detail.Overrides), getStopReason(detail))
+}
+
+func (app *App) HandleBatchJobStateChange(logger *slog.Logger, detail BatchJobStateChangeDetail) error {
+	if detail.Status != "SUCCEEDED" && detail.Status != "FAILED" {
+		return nil
+	}
+
+	key := ""
+	for _, env := range detail.Container.Environment {
+		if env.Name == "OBJECT_KEY" {
+			key = env.Value
+		}
+	}
+
+	reason := detail.StatusReason
+	if c := detail.Container; c.ExitCode != nil && *c.ExitCode != 0 {
+		reason = fmt.Sprintf("container exited with code %d", *c.ExitCode)
+	} else if c.Reason != "" {
+		reason = c.Reason
+	}
+	if reason == "" {
+		reason = "task stopped before finishing the job"
+	}
+
+	return app.handleStopped(logger, detail.JobID, key, reason)
+}
+
+// handleStopped hands the video of a task which stopped over to be retried
+// or failed, unless the task was done with it.
+func (app *App) handleStopped(logger *slog.Logger, taskArn string, key string, reason string) error {
+	logger = logger.With(logging.TASK_ID, taskArn)
+	if key == "" {
+		logger.Warn("task has no object key, ignoring")
+		return nil
+	}
+
+	logger = logger.With(logging.VIDEO_KEY, key)
+
+	v, err := app.videos.Get(key)
+	if err == video.ErrNotFound {
+		logger.Warn("video not found, ignoring task")
+		return nil
+	}
+	if err != nil {
+		logger.Error("failed to get video", logging.ERROR, err)
+		return err
+	}
+
+	// A task of an earlier attempt, the video has moved on since
+	if v.TaskArn != taskArn {
+		return nil
+	}
+
+	// The failure was already noticed, by the reaper stopping the task
+	if v.NextRetryAt != "" {
+		return nil
+	}
+
+	// The transcoder finished the job, or gave up on it, by itself
+	if v.Status.IsTerminal() {
+		return nil
+	}
+
+	logger.Warn("task stopped before finishing the job", logging.JOB_ID, v.JobID, logging.ATTEMPT, v.Attempts, "reason", reason)
+	metrics.CountFailure("task_stopped")
+	return app.failures.Record(*v, v.Attempts, reason)
+}
+
+// getStopReason describes why the task stopped, preferring the exit code of
+// the transcoding container over the reason given by ECS.
+func getStopReason(detail TaskStateChangeDetail) string {
+	for _, c := range detail.Containers {
+		if c.Name != task.CONTAINER_NAME {
+			continue
+		}
+
+		if c.ExitCode != nil && *c.ExitCode != 0 {
+			return fmt.Sprintf("container exited with code %d", *c.ExitCode)
+		}
+
+		if c.Reason != "" {
+			return c.Reason
+		}
+	}
+
+	if detail.StoppedReason != "" {
+		return detail.StoppedReason
+	}
+
+	if detail.StopCode != "" {
+		return detail.StopCode
+	}
+
+	return "task stopped before finishing the job"
+}
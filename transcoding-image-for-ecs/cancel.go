@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// Returned by Transcode when the stuck job reaper gave up on the job and
+// queued another attempt, which the video belongs to from then on
+var errSuperseded = errors.New("job was handed to another attempt")
+
+// cancellationWatch notices the video being cancelled while it is
+// transcoded, or its job being handed to another attempt, and cancels the
+// context of the job when it is.
+type cancellationWatch struct {
+	logger     *slog.Logger
+	videos     video.VideoRepository
+	key        string
+	jobID      string
+	cancel     context.CancelFunc
+	cancelled  atomic.Bool
+	superseded atomic.Bool
+	done       chan struct{}
+}
+
+// watchCancellation checks the video every interval until Stop is called.
+// The returned context is cancelled when ctx is, once the video is
+// cancelled, or once it is worked on by another job than jobID.
+func watchCancellation(ctx context.Context, logger *slog.Logger, videos video.VideoRepository, key string, jobID string, interval time.Duration) (context.Context, *cancellationWatch) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	w := &cancellationWatch{
+		logger: logger,
+		videos: videos,
+		key:    key,
+		jobID:  jobID,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.Check()
+			case <-w.done:
+				return
+			}
+		}
+	}()
+
+	return ctx, w
+}
+
+// Check reads the video and reports whether the job has to stop, because
+// the video was cancelled or handed to another job.
+func (w *cancellationWatch) Check() bool {
+	if w.cancelled.Load() || w.superseded.Load() {
+		return true
+	}
+
+	v, err := w.videos.Get(w.key)
+	if err != nil {
+		w.logger.Error("failed to check whether the video was cancelled", logging.ERROR, err)
+		return false
+	}
+
+	switch {
+	case v.Status == video.STATUS_CANCELLED:
+		w.logger.Info("video was cancelled")
+		w.cancelled.Store(true)
+	case w.jobID != "" && v.JobID != w.jobID:
+		w.logger.Warn("job was handed to another attempt", "other_job_id", v.JobID)
+		w.superseded.Store(true)
+	default:
+		return false
+	}
+
+	w.cancel()
+	return true
+}
+
+// Superseded reports whether a check found the job handed to another one.
+func (w *cancellationWatch) Superseded() bool {
+	return w.superseded.Load()
+}
+
+func (w *cancellationWatch) Stop() {
+	close(w.done)
+	w.cancel()
+}
+
+// removeOutputs deletes the objects already uploaded for a video which was
+// cancelled while uploading.
+func (t *Transcoder) removeOutputs(logger *slog.Logger, keys []string) {
+	for _, key := range keys {
+		err := t.storage.Delete(context.Background(), t.outputBucket, key)
+		if err != nil {
+			logger.Error("failed to delete output of cancelled video", "output", key, logging.ERROR, err)
+		}
+	}
+}
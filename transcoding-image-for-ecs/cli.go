@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/eventbus"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/keys"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/profile"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/retention"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/storage"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+const (
+	CLI_COMMAND = "transcode"
+
+	// Directories of the output directory standing in for the buckets
+	CLI_SOURCE_BUCKET = "input"
+	CLI_OUTPUT_BUCKET = "output"
+
+	// Nobody reads the heartbeats of a local run, they only need an interval
+	CLI_HEARTBEAT_INTERVAL = time.Minute
+)
+
+// CLIResult is what the CLI prints once done, the outcome of the job like the
+// transcoder would record it on the video.
+type CLIResult struct {
+	Input           string            `json:"input"`
+	Status          video.Status      `json:"status"`
+	Error           string            `json:"error,omitempty"`
+	RejectionReason string            `json:"rejection_reason,omitempty"`
+	TranscodedFiles map[string]string `json:"transcoded_files,omitempty"`
+	Preview         string            `json:"preview,omitempty"`
+	TranscodingTime float64           `json:"transcoding_time,omitempty"`
+}
+
+// runCLI probes, validates and transcodes a local file into a directory,
+// without S3 or DynamoDB, and prints the result as JSON on stdout. The logs
+// and the output of ffmpeg go to stderr. It returns the exit code, 1 when the
+// video was rejected or failed.
+//
+//	main transcode --input video.mp4 --profile 720p,480p --out out
+func runCLI(args []string) int {
+	flags := flag.NewFlagSet(CLI_COMMAND, flag.ContinueOnError)
+	input := flags.String("input", "", "video file to transcode")
+	out := flags.String("out", "out", "directory the renditions are written to")
+	profiles := flags.String("profile", "", "comma separated renditions to transcode to, all of them when empty: "+strings.Join(profile.Names(), ", "))
+	previewFormat := flags.String("preview-format", "webp", "format of the preview clip, webp, gif or mp4, "+PREVIEW_FORMAT_NONE+" to skip it")
+	previewStart := flags.Float64("preview-start", -1, "start of the preview clip in seconds, picked when negative")
+	previewDuration := flags.Float64("preview-duration", DEFAULT_PREVIEW_DURATION, "duration of the preview clip in seconds")
+	maxDuration := flags.Float64("max-duration", 0, "longest video accepted in seconds, no limit when 0")
+	maxWidth := flags.Int("max-width", 0, "widest video accepted, no limit when 0")
+	maxHeight := flags.Int("max-height", 0, "tallest video accepted, no limit when 0")
+	verbose := flags.Bool("verbose", false, "log the output of ffmpeg")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *input == "" {
+		fmt.Fprintln(os.Stderr, "--input is required")
+		flags.Usage()
+		return 2
+	}
+
+	// Stdout is kept for the result
+	level := slog.LevelInfo
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(logging.New(os.Stderr, "transcoder", level))
+
+	result := transcodeFile(*input, *out, *profiles, ValidationLimits{
+		MaxDuration: *maxDuration,
+		MaxWidth:    *maxWidth,
+		MaxHeight:   *maxHeight,
+	}, PreviewOptions{
+		Format:   *previewFormat,
+		Start:    *previewStart,
+		Duration: *previewDuration,
+	})
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+
+	if result.Status != video.STATUS_COMPLETED {
+		return 1
+	}
+
+	return 0
+}
+
+// transcodeFile runs Transcode on a local file, with the directories of out
+// standing in for the buckets and the video kept in memory. The file is
+// linked into the CLI_SOURCE_BUCKET directory as the upload, and the outputs
+// are written to the CLI_OUTPUT_BUCKET one, laid out like the buckets:
+// <videoID>/<rendition>/<file>, the name of the file being the video ID.
+func transcodeFile(input, out, profileNames string, limits ValidationLimits, previewOpts PreviewOptions) *CLIResult {
+	result := &CLIResult{Input: input, Status: video.STATUS_FAILED}
+	fail := func(err error) *CLIResult {
+		result.Error = err.Error()
+		return result
+	}
+
+	var names []string
+	if profileNames != "" {
+		names = strings.Split(profileNames, ",")
+	}
+
+	switch previewOpts.Format {
+	case "webp", "gif", "mp4", PREVIEW_FORMAT_NONE:
+	default:
+		return fail(fmt.Errorf("unknown preview format %q", previewOpts.Format))
+	}
+
+	if previewOpts.Duration <= 0 {
+		previewOpts.Duration = DEFAULT_PREVIEW_DURATION
+	}
+
+	source, err := filepath.Abs(input)
+	if err == nil {
+		_, err = os.Stat(source)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	root, err := filepath.Abs(out)
+	if err != nil {
+		return fail(err)
+	}
+
+	fileName := filepath.Base(source)
+	videoID := strings.TrimSuffix(keys.SanitizeFileName(fileName), filepath.Ext(fileName))
+	if videoID == "" {
+		videoID = keys.DEFAULT_FILE_NAME
+	}
+	key := keys.SourceKey(videoID, fileName)
+
+	if err := linkSource(source, filepath.Join(root, CLI_SOURCE_BUCKET, filepath.FromSlash(key))); err != nil {
+		return fail(err)
+	}
+
+	// The downloaded upload and the outputs are kept apart from the
+	// directories of the user until they are stored
+	workDir, err := os.MkdirTemp("", "transcoder-")
+	if err != nil {
+		return fail(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	videos := video.NewMemoryRepository()
+	err = videos.Put(video.Video{
+		Key:          key,
+		Status:       video.STATUS_QUEUED,
+		Tenant:       video.DEFAULT_TENANT,
+		UploadedAt:   time.Now().Format(time.RFC3339),
+		SourceBucket: CLI_SOURCE_BUCKET,
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	events, err := eventbus.New(nil, "transcoder", eventbus.Config{})
+	if err != nil {
+		return fail(err)
+	}
+
+	t := &Transcoder{
+		videos:    videos,
+		storage:   &storage.FileStorage{Root: root},
+		retention: retention.Policy{Source: retention.SOURCE_KEEP},
+		events:    events,
+
+		outputBucket:      CLI_OUTPUT_BUCKET,
+		preview:           previewOpts,
+		limits:            limits,
+		heartbeatInterval: CLI_HEARTBEAT_INTERVAL,
+		workDir:           workDir,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	err = t.Transcode(ctx, task.Job{Bucket: CLI_SOURCE_BUCKET, Key: key, Profiles: names})
+	if err != nil {
+		return fail(err)
+	}
+
+	v, err := videos.Get(key)
+	if err != nil {
+		return fail(err)
+	}
+
+	outputPath := func(key string) string {
+		return filepath.Join(out, CLI_OUTPUT_BUCKET, filepath.FromSlash(key))
+	}
+
+	switch v.Status {
+	case video.STATUS_REJECTED:
+		result.Status = v.Status
+		result.RejectionReason = v.RejectionReason
+	case video.STATUS_COMPLETED:
+		result.Status = v.Status
+		result.TranscodedFiles = map[string]string{}
+		for r, key := range v.TranscodedFiles {
+			result.TranscodedFiles[r] = outputPath(key)
+		}
+		if v.PreviewKey != "" {
+			result.Preview = outputPath(v.PreviewKey)
+		}
+		result.TranscodingTime, _ = strconv.ParseFloat(v.TranscodingTime, 64)
+	default:
+		return fail(fmt.Errorf("transcoding stopped with the video %s", v.Status))
+	}
+
+	return result
+}
+
+// linkSource links the file to transcode in as the upload, instead of
+// copying a video which may be large.
+func linkSource(source, upload string) error {
+	if err := os.MkdirAll(filepath.Dir(upload), 0755); err != nil {
+		return err
+	}
+
+	// Left by an earlier run of a file of the same name
+	if err := os.Remove(upload); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Symlink(source, upload)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// Stand-ins of ffprobe and ffmpeg, which write a file to the last argument
+const (
+	fakeFFprobe = `#!/bin/sh
+echo '{"streams":[{"codec_type":"video","codec_name":"h264","width":640,"height":360}],"format":{"duration":"3.0"}}'
+`
+	fakeFFmpeg = `#!/bin/sh
+for a in "$@"; do f="$a"; done
+echo fake > "$f"
+`
+)
+
+func TestTranscodeFileRunsInParallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stand-ins of ffmpeg are shell scripts")
+	}
+
+	bin := t.TempDir()
+	for name, script := range map[string]string{"ffprobe": fakeFFprobe, "ffmpeg": fakeFFmpeg} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cwd, _ := os.Getwd()
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+
+	var wg sync.WaitGroup
+	results := make([]*CLIResult, 4)
+	for i := range results {
+		input := filepath.Join(dir, string(rune('a'+i))+".mp4")
+		if err := os.WriteFile(input, []byte("video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = transcodeFile(input, out, "720p", ValidationLimits{}, PreviewOptions{Format: "webp", Start: -1})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Status != video.STATUS_COMPLETED || result.Error != "" {
+			t.Errorf("%s: transcoding is %s with error %q", result.Input, result.Status, result.Error)
+			continue
+		}
+
+		for _, file := range []string{result.TranscodedFiles["720p"], result.Preview} {
+			if _, err := os.Stat(file); err != nil {
+				t.Errorf("%s: output missing, %v", result.Input, err)
+			}
+		}
+	}
+
+	if now, _ := os.Getwd(); now != cwd {
+		t.Errorf("working directory moved to %s", now)
+	}
+}
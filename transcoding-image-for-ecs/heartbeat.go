@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// startHeartbeat refreshes the heartbeat of the video every interval until
+// the returned function is called, which lets the stuck job reaper tell a
+// busy task apart from one that died. The heartbeat is only refreshed while
+// the video is worked on by jobID, refused is called when it is worked on by
+// another job.
+func startHeartbeat(logger *slog.Logger, videos video.VideoRepository, key string, jobID string, interval time.Duration, refused func()) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	beat := func() {
+		err := videos.Update(key, video.Update{HeartbeatAt: time.Now().UTC().Format(time.RFC3339), ForJob: jobID})
+		if err == video.ErrInvalidTransition {
+			refused()
+			return
+		}
+		if err != nil {
+			logger.Error("failed to record heartbeat", logging.ERROR, err)
+		}
+	}
+
+	beat()
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				beat()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -2,46 +2,87 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/eventbus"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/keys"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/profile"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/retention"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/storage"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/tracing"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+	"github.com/thegeorgenikhil/video-transcoding-service/videoevents"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-var (
-	__temporaryBucketName = os.Getenv("TEMPORARY_BUCKET_NAME")
-	__outputBucketName    = os.Getenv("OUTPUT_BUCKET_NAME")
-	__bucketRegion        = os.Getenv("BUCKET_REGION")
-	__objectKey           = os.Getenv("OBJECT_KEY")
+type Config struct {
+	Region              string `env:"BUCKET_REGION"`
+	TemporaryBucketName string `env:"TEMPORARY_BUCKET_NAME"`
+	OutputBucketName    string `env:"OUTPUT_BUCKET_NAME" required:"true"`
+	ObjectKey           string `env:"OBJECT_KEY"`
+	JobID               string `env:"JOB_ID"`
+	TraceParent         string `env:"TRACEPARENT"`
 
-	transcodingFormats = TranscodingFormatMap{
-		"144p":  "256:144",
-		"240p":  "426:240",
-		"360p":  "640:360",
-		"480p":  "854:480",
-		"720p":  "1280:720",
-		"1080p": "1920:1080",
-	}
+	// Local stand-ins of the AWS services, see local-harness
+	config.Endpoints
 
-	wg sync.WaitGroup
+	// Worker mode, used when OBJECT_KEY is empty
+	QueueURLs []string `env:"JOB_QUEUE_URLS"`
 
-	transcodedVideoInfoMap = TranscodedVideoInfo{
-		infoMap: make(map[string]string),
-	}
-)
+	PreviewFormat   string  `env:"PREVIEW_FORMAT" default:"webp" oneof:"webp gif mp4 none"`
+	PreviewDuration float64 `env:"PREVIEW_DURATION" default:"3" min:"0"`
+
+	MaxDurationSeconds float64 `env:"MAX_DURATION_SECONDS" min:"0"`
+	MaxWidth           int     `env:"MAX_WIDTH" min:"0"`
+	MaxHeight          int     `env:"MAX_HEIGHT" min:"0"`
+
+	HeartbeatInterval time.Duration `env:"HEARTBEAT_INTERVAL_SECONDS" default:"30" unit:"seconds" min:"1"`
+
+	// Set when re-transcoding a video, see task.Job
+	Profiles      []string `env:"PROFILES"`
+	OutputVersion int      `env:"OUTPUT_VERSION" min:"1"`
+
+	// Bucket the source is kept in once the video is transcoded, so it can
+	// be re-transcoded later. Sources stay in the temporary bucket when empty.
+	RetainedBucketName string `env:"RETAINED_BUCKET_NAME"`
+
+	Retention retention.Policy
+	Retry     task.RetryPolicy
+
+	// Where the sources and renditions are kept, S3 by default
+	Storage storage.Config
+
+	// Where the metrics go, prometheus only in worker mode
+	Metrics metrics.Config
 
-type TranscodingFormatMap map[string]string
+	// Where the spans go, nowhere by default
+	Tracing tracing.Config
+
+	// Where the events of the jobs are published, nowhere by default
+	Events eventbus.Config
+}
+
+var __config Config
+
+// Lines of the ffmpeg output kept for the error of a failed rendition
+const FFMPEG_ERROR_LINES = 10
 
 type TranscodedVideoInfo struct {
 	infoMap map[string]string
@@ -55,160 +96,607 @@ func (t *TranscodedVideoInfo) AddInfo(resolution string, url string) {
 }
 
 func main() {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(__bucketRegion),
-	})
+	// Transcoding local files doesn't need any of the configuration
+	if len(os.Args) > 1 && os.Args[1] == CLI_COMMAND {
+		os.Exit(runCLI(os.Args[2:]))
+	}
+
+	logging.Setup("transcoder")
+	config.MustLoad(&__config)
+
+	if __config.Retention.Source == retention.SOURCE_ARCHIVE && __config.RetainedBucketName == "" {
+		logging.Fatal("invalid configuration", errors.New("RETAINED_BUCKET_NAME must be set to archive sources"))
+	}
+
+	// Without an object key the container runs as a worker of the job queue
+	if __config.ObjectKey == "" && len(__config.QueueURLs) == 0 {
+		logging.Fatal("invalid configuration", errors.New("either OBJECT_KEY or JOB_QUEUE_URLS must be set"))
+	}
+
+	// A task transcoding a single video exits before it could be scraped
+	if __config.Metrics.Backend == metrics.BACKEND_PROMETHEUS && __config.ObjectKey != "" {
+		logging.Fatal("invalid configuration", errors.New("METRICS=prometheus needs the worker mode"))
+	}
+	metrics.Setup("transcoder", __config.Metrics)
+	tracing.Setup("transcoder", __config.Tracing)
+
+	// Every line of the task carries its ID, which the video records
+	taskArn := getTaskArn()
+	if taskArn != "" {
+		slog.SetDefault(slog.Default().With(logging.TASK_ID, taskArn))
+	}
+
+	sess, err := config.AWS{Region: __config.Region, Endpoints: __config.Endpoints}.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	store, err := storage.New(sess, __config.Storage)
+	if err != nil {
+		logging.Fatal("invalid storage configuration", err)
+	}
+
+	publisher, err := eventbus.New(sess, "transcoder", __config.Events)
+	if err != nil {
+		logging.Fatal("invalid events configuration", err)
+	}
+
+	videos := video.NewDynamoRepository(dynamodb.New(sess))
+
+	t := &Transcoder{
+		videos:    videos,
+		storage:   store,
+		retention: __config.Retention,
+		events:    publisher,
+
+		outputBucket:      __config.OutputBucketName,
+		retainedBucket:    __config.RetainedBucketName,
+		preview:           getPreviewDefaults(__config),
+		limits:            getValidationLimits(__config),
+		heartbeatInterval: __config.HeartbeatInterval,
+	}
+
+	if __config.ObjectKey == "" {
+		runWorker(sess, t, __config.QueueURLs, __config.Retry, taskArn)
+		tracing.Shutdown()
+		return
+	}
+
+	// ECS sends SIGTERM when the task is stopped, e.g. because the video
+	// was cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	job := task.Job{
+		ID:       __config.JobID,
+		Bucket:   __config.TemporaryBucketName,
+		Key:      __config.ObjectKey,
+		Profiles: __config.Profiles,
+		Version:  __config.OutputVersion,
+
+		TraceParent: __config.TraceParent,
+	}
 
+	err = t.Transcode(ctx, job)
+	tracing.Shutdown()
 	if err != nil {
-		log.Fatalf("failed to create AWS session, %v", err)
+		slog.Error("failed to transcode video", logging.VIDEO_KEY, job.Key, logging.JOB_ID, job.ID, logging.ERROR, err)
+		os.Exit(1)
 	}
+}
+
+type Transcoder struct {
+	videos    video.VideoRepository
+	storage   storage.Storage
+	retention retention.Policy
+	events    eventbus.Publisher
+
+	// Settings of every job, see Config
+	outputBucket      string
+	retainedBucket    string
+	preview           PreviewOptions
+	limits            ValidationLimits
+	heartbeatInterval time.Duration
+
+	// Directory the files of the jobs are kept in while they are worked on,
+	// the working directory when empty
+	workDir string
+}
 
-	s3Downloader := s3manager.NewDownloader(sess)
-	dynamoClient := dynamodb.New(sess)
+// Transcode transcodes the video of the job to every profile and uploads the
+// renditions. When ctx is cancelled the running ffmpeg processes are killed,
+// a job which is already uploading is finished regardless. A video which is
+// cancelled is left as soon as the cancellation is noticed, removing what was
+// already uploaded. Every step is logged with how long it took, a failed job
+// is counted by the step which failed. The download, every rendition and
+// every upload are spans of the trace of the job. The start of the job, every
+// stored rendition and its completion are published as events.
+func (t *Transcoder) Transcode(ctx context.Context, job task.Job) (err error) {
+	ctx, span := tracing.Start(tracing.Extract(ctx, job.TraceParent), "transcode", tracing.VIDEO_KEY.String(job.Key), tracing.JOB_ID.String(job.ID))
+	defer func() { tracing.End(span, err) }()
+
+	logger := logging.WithTrace(slog.Default().With(logging.VIDEO_KEY, job.Key, logging.JOB_ID, job.ID), ctx)
+	finished := logging.Stage(logger, "job")
+
+	stage := "prepare"
+	begin := func(name string) func(args ...any) {
+		stage = name
+		return logging.Stage(logger, name)
+	}
+	defer func() {
+		// A stopped task or worker hands the job over, it didn't fail
+		if err != nil && ctx.Err() == nil && err != errSuperseded {
+			metrics.CountFailure(stage)
+		}
+	}()
 
-	file, err := os.Create(__objectKey)
+	videoFilePath := t.localFilePath("in", job.Key)
+	if err := os.MkdirAll(filepath.Dir(videoFilePath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %q, %v", videoFilePath, err)
+	}
+
+	file, err := os.Create(videoFilePath)
 	if err != nil {
-		log.Fatalf("failed to create file %q, %v", __objectKey, err)
+		return fmt.Errorf("failed to create file %q, %v", videoFilePath, err)
 	}
 
 	defer file.Close()
 
-	_, err = dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
-		TableName: aws.String("Videos"),
-		ExpressionAttributeNames: map[string]*string{
-			"#S": aws.String("Status"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":s": {
-				S: aws.String("processing"),
-			},
-		},
-		Key: map[string]*dynamodb.AttributeValue{
-			"Key": {
-				S: aws.String(__objectKey),
-			},
-		},
-		UpdateExpression: aws.String("SET #S = :s"),
-	})
+	// Remove the files of the job, so a worker doesn't fill up its disk
+	defer os.Remove(videoFilePath)
+	defer os.RemoveAll(t.localFilePath("out", keys.Prefix(keys.Parse(job.Key).VideoID)))
+
+	profiles, err := profile.Select(job.Profiles)
 	if err != nil {
-		log.Fatalf("failed to update item in DynamoDB, %v", err)
+		return err
 	}
 
-	// STEP 1: Download the video from S3
-	_, err = s3Downloader.Download(file,
-		&s3.GetObjectInput{
-			Bucket: aws.String(__temporaryBucketName),
-			Key:    aws.String(__objectKey),
-		})
+	// A task started twice for the same upload, or after the video was
+	// cancelled, must not touch it again
+	err = t.videos.Update(job.Key, video.Update{Status: video.STATUS_PROCESSING, ForJob: job.ID})
+	if err == video.ErrInvalidTransition {
+		logger.Info("video is not queued for transcoding, skipping")
+		return nil
+	}
 	if err != nil {
-		log.Fatalf("failed to download file, %v", err)
+		return fmt.Errorf("failed to update item in DynamoDB, %v", err)
 	}
 
-	// STEP 2: Transcode the video to all resolutions
-	videoFilePath := "./" + file.Name()
+	renditions := make([]string, 0, len(profiles))
+	for r := range profiles {
+		renditions = append(renditions, r)
+	}
+	sort.Strings(renditions)
 
-	startTime := time.Now()
-	for r := range transcodingFormats {
-		outputName := getFormattedOutputName(file.Name(), r)
+	eventbus.Publish(ctx, t.events, logger, videoevents.TranscodeStarted{
+		VideoKey:      job.Key,
+		JobID:         job.ID,
+		Renditions:    renditions,
+		OutputVersion: job.Version,
+	})
 
-		wg.Add(1)
-		go transcodeVideo(videoFilePath, outputName, r, &wg, &transcodedVideoInfoMap)
+	jobCtx, watch := watchCancellation(ctx, logger, t.videos, job.Key, job.ID, t.heartbeatInterval)
+	defer watch.Stop()
+
+	stopHeartbeat := startHeartbeat(logger, t.videos, job.Key, job.ID, t.heartbeatInterval, func() { watch.Check() })
+	defer stopHeartbeat()
+
+	// Everything uploaded so far, removed again if the video is cancelled.
+	// The outputs of a job handed to another attempt are the ones that
+	// attempt writes, they are left alone.
+	var uploaded []string
+	cancelled := func() error {
+		if watch.Superseded() {
+			logger.Warn("stopped transcoding, the job was handed to another attempt")
+			return errSuperseded
+		}
+
+		logger.Info("stopped transcoding, the video was cancelled")
+		t.removeOutputs(logger, uploaded)
+		return nil
 	}
 
-	wg.Wait()
+	// STEP 1: Download the video from the storage
+	downloaded := begin("download")
+	_, downloadSpan := tracing.Start(jobCtx, "download", tracing.BUCKET.String(job.Bucket))
+	source, err := t.storage.Head(jobCtx, job.Bucket, job.Key)
+	if err == nil {
+		err = t.storage.Download(jobCtx, job.Bucket, job.Key, file)
+	}
+	tracing.End(downloadSpan, err)
+	if err != nil {
+		if watch.Check() {
+			return cancelled()
+		}
+		return fmt.Errorf("failed to download file, %v", err)
+	}
+
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+		metrics.Put(metrics.BYTES_IN, float64(size), metrics.UNIT_BYTES, nil)
+		downloadSpan.SetAttributes(tracing.BYTES.Int64(size))
+	}
+	downloaded("bytes", size)
+
+	// STEP 2: Make sure the upload is a video we are willing to transcode
+	probed := begin("probe")
+	probe, err := probeVideo(jobCtx, videoFilePath)
+	reason := rejectionReason(err)
+	if err != nil && reason == "" {
+		if watch.Check() {
+			return cancelled()
+		}
+		return fmt.Errorf("failed to probe video, %v", err)
+	}
+	if err == nil {
+		reason = validateVideo(probe, t.limits)
+		probed("duration", probe.Duration, "width", probe.Width, "height", probe.Height, "video_codec", probe.VideoCodec)
+	}
+
+	if reason != "" {
+		return t.rejectVideo(logger, job, reason)
+	}
+
+	// STEP 3: Transcode the video to all resolutions
+	startTime := time.Now()
+	transcoded := begin("transcode")
+	transcodedVideoInfoMap, err := transcodeRenditions(jobCtx, logger, videoFilePath, probe.Duration, profiles, func(r string, p profile.Profile) string {
+		return t.localFilePath("out", keys.VersionedRenditionKey(job.Key, r, p.Container, job.Version))
+	})
+	if err != nil {
+		// ffmpeg was killed because the video was cancelled, or the
+		// container is stopped for the same reason
+		if watch.Check() {
+			return cancelled()
+		}
+		return err
+	}
+	transcoded("renditions", len(profiles))
+
+	// STEP 4: Generate the preview clip shown on the listing page. A
+	// re-transcode of some renditions keeps the preview it has.
+	previewOpts := getPreviewOptions(t.preview, source.Metadata)
+	previewKey := ""
+	previewFilePath := ""
+	partial := len(job.Profiles) > 0 && job.Version > 1
+	if !partial && previewOpts.Format != PREVIEW_FORMAT_NONE {
+		previewKey = keys.VersionedRenditionKey(job.Key, keys.PREVIEW_RENDITION, previewOpts.Format, job.Version)
+		previewFilePath = t.localFilePath("out", previewKey)
+
+		// A missing preview should not fail the whole transcoding job
+		previewed := logging.Stage(logger, "preview")
+		if err := generatePreview(jobCtx, logger, videoFilePath, previewFilePath, probe.Duration, previewOpts); err != nil {
+			if watch.Check() {
+				return cancelled()
+			}
+			logger.Warn("skipping preview", logging.ERROR, err)
+			previewKey = ""
+		} else {
+			previewed("format", previewOpts.Format)
+		}
+	}
 
 	totalTime := time.Since(startTime)
 
-	// STEP 3: Upload the transcoded videos to S3
-	svc := s3.New(sess)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
+	err = t.videos.Update(job.Key, video.Update{Status: video.STATUS_UPLOADING, ForJob: job.ID})
+	if err == video.ErrInvalidTransition && watch.Check() {
+		return cancelled()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update item in DynamoDB, %v", err)
+	}
+
+	// STEP 5: Upload the transcoded videos to the storage
+	uploadedAll := begin("upload")
 	for r, url := range transcodedVideoInfoMap.infoMap {
-		file, err := os.Open(url)
+		if watch.Check() {
+			return cancelled()
+		}
+
+		key := keys.VersionedRenditionKey(job.Key, r, profiles[r].Container, job.Version)
+		uploadedRendition := logging.Stage(logger.With(logging.RENDITION, r), "upload_rendition")
+		size, err := t.uploadFile(jobCtx, url, key, "video/"+profiles[r].Container)
 		if err != nil {
-			log.Fatal("Error opening file:", err)
+			return err
 		}
-		defer file.Close()
+		uploaded = append(uploaded, key)
+		metrics.Put(metrics.BYTES_OUT, float64(size), metrics.UNIT_BYTES, metrics.Dimensions{metrics.RENDITION: r})
+		uploadedRendition("output", key, "bytes", size)
+
+		eventbus.Publish(context.Background(), t.events, logger, videoevents.RenditionCompleted{
+			VideoKey:  job.Key,
+			JobID:     job.ID,
+			Rendition: r,
+			Key:       key,
+			Size:      size,
+		})
+	}
 
-		key := getFormattedOutputName(__objectKey, r)
+	if previewKey != "" {
+		if watch.Check() {
+			return cancelled()
+		}
 
-		// Read the contents of the file into a buffer
-		var buf bytes.Buffer
-		if _, err := io.Copy(&buf, file); err != nil {
-			log.Fatal("Error reading file:", err)
+		size, err := t.uploadFile(jobCtx, previewFilePath, previewKey, getPreviewContentType(previewOpts.Format))
+		if err != nil {
+			return err
 		}
+		uploaded = append(uploaded, previewKey)
+		metrics.Put(metrics.BYTES_OUT, float64(size), metrics.UNIT_BYTES, metrics.Dimensions{metrics.RENDITION: keys.PREVIEW_RENDITION})
+	}
+	uploadedAll("outputs", len(uploaded))
 
-		// This uploads the contents of the buffer to S3
-		_, err = svc.PutObject(&s3.PutObjectInput{
-			Bucket: aws.String(__outputBucketName),
-			Key:    aws.String(key),
-			Body:   bytes.NewReader(buf.Bytes()),
-		})
+	// STEP 6: Keep the source around for re-transcoding
+	retained := begin("retain_source")
+	sourceBucket, err := t.retainSource(job)
+	if err != nil {
+		return err
+	}
+	retained("bucket", sourceBucket)
+
+	// Renditions which weren't re-transcoded keep their current outputs
+	stage = "complete"
+	v, err := t.videos.Get(job.Key)
+	if err != nil {
+		return fmt.Errorf("failed to get item from DynamoDB, %v", err)
+	}
+
+	transcodedFiles := map[string]string{}
+	if partial {
+		for r, key := range v.TranscodedFiles {
+			transcodedFiles[r] = key
+		}
+	}
+	for r, p := range profiles {
+		transcodedFiles[r] = keys.VersionedRenditionKey(job.Key, r, p.Container, job.Version)
+	}
+
+	// Players switch to the new outputs from here on
+	update := video.Update{
+		Status:          video.STATUS_COMPLETED,
+		TranscodingTime: fmt.Sprintf("%f", totalTime.Seconds()),
+		TranscodedFiles: transcodedFiles,
+		PreviewKey:      previewKey,
+		SourceBucket:    sourceBucket,
+		ExpiresAt:       t.retention.ExpiresAt(v.Tenant, time.Now()),
+		ForJob:          job.ID,
+	}
+
+	// Without a retained copy, a deleted source is gone for good
+	if t.retention.Source != retention.SOURCE_KEEP && t.retainedBucket == "" {
+		update.SourceBucket = ""
+		update.DropSource = true
+	}
+
+	err = t.videos.Update(job.Key, update)
+	if err == video.ErrInvalidTransition && watch.Check() {
+		return cancelled()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update item in DynamoDB, %v", err)
+	}
+
+	// STEP 7: Remove the upload, only once the video no longer needs it
+	if t.retention.Source != retention.SOURCE_KEEP && job.Bucket != t.retainedBucket {
+		err = t.storage.Delete(context.Background(), job.Bucket, job.Key)
 		if err != nil {
-			log.Fatal("Error uploading data to S3:", err)
+			// The video is done either way, the source is only taking space
+			logger.Error("failed to delete source", "bucket", job.Bucket, logging.ERROR, err)
 		}
+	}
 
-		fmt.Println("File uploaded successfully!!! ", file.Name())
-	}
-
-	_, err = dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
-		TableName: aws.String("Videos"),
-		ExpressionAttributeNames: map[string]*string{
-			"#S": aws.String("Status"),
-			"#T": aws.String("TranscodingTime"),
-			"#F": aws.String("TranscodedFiles"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":s": {
-				S: aws.String("completed"),
-			},
-			":t": {
-				S: aws.String(fmt.Sprintf("%f", totalTime.Seconds())),
-			},
-			":f": {
-				M: map[string]*dynamodb.AttributeValue{
-					"144p":  {S: aws.String(getFormattedOutputName(__objectKey, "144p"))},
-					"240p":  {S: aws.String(getFormattedOutputName(__objectKey, "240p"))},
-					"360p":  {S: aws.String(getFormattedOutputName(__objectKey, "360p"))},
-					"480p":  {S: aws.String(getFormattedOutputName(__objectKey, "480p"))},
-					"720p":  {S: aws.String(getFormattedOutputName(__objectKey, "720p"))},
-					"1080p": {S: aws.String(getFormattedOutputName(__objectKey, "1080p"))},
-				},
-			},
-		},
-		Key: map[string]*dynamodb.AttributeValue{
-			"Key": {
-				S: aws.String(__objectKey),
-			},
-		},
-		UpdateExpression: aws.String("SET #S = :s, #T = :t, #F = :f"),
+	eventbus.Publish(context.Background(), t.events, logger, videoevents.TranscodeCompleted{
+		VideoKey:           job.Key,
+		JobID:              job.ID,
+		Renditions:         transcodedFiles,
+		PreviewKey:         previewKey,
+		TranscodingSeconds: totalTime.Seconds(),
+		OutputVersion:      job.Version,
 	})
+
+	metrics.Put(metrics.JOBS_COMPLETED, 1, metrics.UNIT_COUNT, nil)
+	finished("status", video.STATUS_COMPLETED)
+	return nil
+}
+
+// retainSource copies the source of the job to the retained bucket, and
+// returns the bucket the source is kept in. Archived sources are copied in
+// the archive storage class.
+func (t *Transcoder) retainSource(job task.Job) (string, error) {
+	if t.retainedBucket == "" || job.Bucket == t.retainedBucket {
+		return job.Bucket, nil
+	}
+
+	storageClass := ""
+	if t.retention.Source == retention.SOURCE_ARCHIVE {
+		storageClass = t.retention.ArchiveStorageClass
+	}
+
+	err := t.storage.Copy(context.Background(), job.Bucket, job.Key, t.retainedBucket, storageClass)
 	if err != nil {
-		log.Fatalf("failed to update item in DynamoDB, %v", err)
+		return "", fmt.Errorf("failed to copy source to %s, %v", t.retainedBucket, err)
 	}
+
+	return t.retainedBucket, nil
 }
 
-func getFormattedOutputName(videoFileName string, resolution string) string {
-	return strings.Split(videoFileName, ".")[0] + "_" + resolution + "." + strings.Split(videoFileName, ".")[1]
+// uploadFile uploads the local file to the output bucket under key, and
+// returns its size. The upload is a span of the trace of ctx, it isn't
+// cancelled along with ctx.
+func (t *Transcoder) uploadFile(ctx context.Context, filePath string, key string, contentType string) (size int64, err error) {
+	_, span := tracing.Start(ctx, "upload", tracing.BUCKET.String(t.outputBucket), attribute.String("storage.key", key))
+	defer func() {
+		span.SetAttributes(tracing.BYTES.Int64(size))
+		tracing.End(span, err)
+	}()
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file %q, %v", filePath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file %q, %v", filePath, err)
+	}
+
+	// An upload which started is finished, even when the task is stopped
+	err = t.storage.Upload(context.Background(), t.outputBucket, key, file, contentType)
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload %s, %v", key, err)
+	}
+
+	return info.Size(), nil
+}
+
+// rejectVideo marks the video as rejected and removes the uploaded source so
+// it isn't picked up again.
+func (t *Transcoder) rejectVideo(logger *slog.Logger, job task.Job, reason string) error {
+	logger.Info("rejecting video", "reason", reason)
+	metrics.CountFailure("rejected")
+
+	err := t.videos.Update(job.Key, video.Update{
+		Status:          video.STATUS_REJECTED,
+		RejectionReason: reason,
+		ForJob:          job.ID,
+	})
+	if err == video.ErrInvalidTransition {
+		logger.Info("video moved on before it could be rejected")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update item in DynamoDB, %v", err)
+	}
+
+	eventbus.Publish(context.Background(), t.events, logger, videoevents.TranscodeFailed{
+		VideoKey: job.Key,
+		JobID:    job.ID,
+		Reason:   videoevents.REASON_REJECTED,
+		Message:  reason,
+	})
+
+	// The source of a re-transcode was accepted before, and is kept in case
+	// the limits are relaxed again
+	if job.Version > 1 {
+		return nil
+	}
+
+	err = t.storage.Delete(context.Background(), job.Bucket, job.Key)
+	if err != nil {
+		return fmt.Errorf("failed to delete rejected object, %v", err)
+	}
+
+	return nil
 }
 
-func transcodeVideo(filePath string, outputFileName string, resolution string, wg *sync.WaitGroup, transcodedVideoInfoMap *TranscodedVideoInfo) {
-	defer wg.Done()
-	outputFilePath := "./out/" + outputFileName
+// localFilePath mirrors the object key layout under dir of the work
+// directory, so outputs of different renditions never collide on disk.
+func (t *Transcoder) localFilePath(dir string, key string) string {
+	return filepath.Join(t.workDir, dir, filepath.FromSlash(key))
+}
 
-	scale := transcodingFormats[resolution]
+func getPreviewContentType(format string) string {
+	switch format {
+	case "gif":
+		return "image/gif"
+	case "mp4":
+		return "video/mp4"
+	default:
+		return "image/webp"
+	}
+}
 
-	fmt.Printf("ffmpeg -i %s -vf scale=%s -acodec copy -c:a copy %s\n", filePath, scale, outputFilePath)
+// transcodeRenditions transcodes the video to every profile at once, to the
+// file outputFilePath returns for it, and returns the files by rendition.
+// The duration of the video is used to work out the speed of the encodes.
+func transcodeRenditions(ctx context.Context, logger *slog.Logger, filePath string, duration float64, profiles map[string]profile.Profile, outputFilePath func(r string, p profile.Profile) string) (*TranscodedVideoInfo, error) {
+	transcodedVideoInfoMap := &TranscodedVideoInfo{
+		infoMap: make(map[string]string),
+	}
 
-	cmd := exec.Command("ffmpeg", "-i", filePath, "-vf", "scale="+scale, "-acodec", "copy", "-c:a", "copy", outputFilePath)
+	var wg sync.WaitGroup
+	errs := make(chan error, len(profiles))
+	for r, p := range profiles {
+		wg.Add(1)
+		go func(r string, p profile.Profile, outputFilePath string) {
+			defer wg.Done()
+			if err := transcodeVideo(ctx, logger.With(logging.RENDITION, r), filePath, duration, outputFilePath, r, p, transcodedVideoInfoMap); err != nil {
+				errs <- err
+			}
+		}(r, p, outputFilePath(r, p))
+	}
+
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+
+	return transcodedVideoInfoMap, nil
+}
+
+// transcodeVideo runs ffmpeg for one rendition. Its output is only logged at
+// debug level, the last lines of it end up in the error when it fails. The
+// speed of the encode, seconds of video per second, is recorded by rendition.
+func transcodeVideo(ctx context.Context, logger *slog.Logger, filePath string, duration float64, outputFilePath string, resolution string, p profile.Profile, transcodedVideoInfoMap *TranscodedVideoInfo) (err error) {
+	if err := os.MkdirAll(filepath.Dir(outputFilePath), 0755); err != nil {
+		return err
+	}
+
+	args := []string{
+		"-y",
+		"-i", filePath,
+		"-vf", "scale=" + p.Scale,
+		"-c:v", p.VideoCodec,
+		"-c:a", p.AudioCodec,
+		"-f", p.Container,
+		outputFilePath,
+	}
+
+	logger.Debug("running ffmpeg", "args", strings.Join(args, " "))
+	transcoded := logging.Stage(logger, "transcode_rendition")
+	start := time.Now()
+
+	ctx, span := tracing.Start(ctx, "transcode_rendition", tracing.RENDITION.String(resolution), attribute.String("ffmpeg.video_codec", p.VideoCodec))
+	defer func() { tracing.End(span, err) }()
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
 	stderr, _ := cmd.StderrPipe()
 	if err := cmd.Start(); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
+	var tail []string
 	scanner := bufio.NewScanner(stderr)
 	for scanner.Scan() {
-		fmt.Println(scanner.Text())
+		logger.Debug("ffmpeg", "output", scanner.Text())
+
+		tail = append(tail, scanner.Text())
+		if len(tail) > FFMPEG_ERROR_LINES {
+			tail = tail[1:]
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to transcode %s to %s, %v: %s", filePath, resolution, err, strings.Join(tail, "\n"))
+	}
+
+	if duration <= 0 {
+		transcoded()
+	} else {
+		speed := duration / time.Since(start).Seconds()
+		metrics.Put(metrics.ENCODE_SPEED, speed, metrics.UNIT_NONE, metrics.Dimensions{metrics.RENDITION: resolution})
+		transcoded("speed", speed)
+		span.SetAttributes(attribute.Float64("ffmpeg.speed", speed))
 	}
 
 	transcodedVideoInfoMap.AddInfo(resolution, outputFilePath)
+	return nil
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/eventbus"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/retention"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/storage"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+const testKey = "id/source/video.mp4"
+
+func newTestTranscoder(t *testing.T, policy retention.Policy) (*Transcoder, *storage.MemoryStorage, *video.MemoryRepository) {
+	t.Helper()
+
+	store := storage.NewMemoryStorage()
+	store.Put("temporary", testKey, []byte("video"), nil)
+
+	videos := video.NewMemoryRepository()
+	videos.Put(video.Video{Key: testKey, Status: video.STATUS_PROCESSING, SourceBucket: "temporary"})
+
+	events, err := eventbus.New(nil, "transcoder", eventbus.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Transcoder{videos: videos, storage: store, retention: policy, events: events}, store, videos
+}
+
+func TestRejectVideoKeepsTheSourceOfRetranscodes(t *testing.T) {
+	tests := []struct {
+		version int
+		kept    bool
+	}{
+		{0, false},
+		{1, false},
+		{2, true},
+	}
+
+	for _, tt := range tests {
+		tr, store, videos := newTestTranscoder(t, retention.Policy{Source: retention.SOURCE_KEEP})
+
+		job := task.Job{Bucket: "temporary", Key: testKey, Version: tt.version}
+		if err := tr.rejectVideo(slog.Default(), job, "too long"); err != nil {
+			t.Fatalf("version %d: rejectVideo() error = %v", tt.version, err)
+		}
+
+		v, _ := videos.Get(testKey)
+		if v.Status != video.STATUS_REJECTED || v.RejectionReason != "too long" {
+			t.Errorf("version %d: video is %s with reason %q", tt.version, v.Status, v.RejectionReason)
+		}
+
+		if _, ok := store.Get("temporary", testKey); ok != tt.kept {
+			t.Errorf("version %d: source kept = %v, want %v", tt.version, ok, tt.kept)
+		}
+	}
+}
+
+func TestRetainSourceCopiesToTheRetainedBucket(t *testing.T) {
+	tests := []struct {
+		retained string
+		bucket   string
+	}{
+		{"", "temporary"},
+		{"retained", "retained"},
+	}
+
+	for _, tt := range tests {
+		tr, store, _ := newTestTranscoder(t, retention.Policy{Source: retention.SOURCE_ARCHIVE})
+		tr.retainedBucket = tt.retained
+
+		bucket, err := tr.retainSource(task.Job{Bucket: "temporary", Key: testKey})
+		if err != nil {
+			t.Fatalf("retained bucket %q: retainSource() error = %v", tt.retained, err)
+		}
+		if bucket != tt.bucket {
+			t.Errorf("retained bucket %q: source kept in %q, want %q", tt.retained, bucket, tt.bucket)
+		}
+
+		if data, ok := store.Get(tt.bucket, testKey); !ok || string(data) != "video" {
+			t.Errorf("retained bucket %q: no copy of the source in %s", tt.retained, tt.bucket)
+		}
+	}
+}
+
+func TestSupersededJobStops(t *testing.T) {
+	stale := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	// The reaper gave up on job-1 and the video is worked on by job-2
+	videos := video.NewMemoryRepository()
+	videos.Put(video.Video{Key: testKey, Status: video.STATUS_PROCESSING, JobID: "job-2", HeartbeatAt: stale})
+
+	ctx, watch := watchCancellation(context.Background(), slog.Default(), videos, testKey, "job-1", time.Hour)
+	defer watch.Stop()
+
+	stop := startHeartbeat(slog.Default(), videos, testKey, "job-1", time.Hour, func() { watch.Check() })
+	stop()
+
+	if v, _ := videos.Get(testKey); v.HeartbeatAt != stale {
+		t.Errorf("heartbeat of job-2 refreshed by job-1")
+	}
+	if ctx.Err() == nil || !watch.Superseded() {
+		t.Errorf("job-1 wasn't stopped once its heartbeat was refused")
+	}
+
+	// Nor can job-1 change the status of the video
+	tr, store, videos := newTestTranscoder(t, retention.Policy{})
+	videos.Update(testKey, video.Update{JobID: "job-2"})
+
+	if err := tr.rejectVideo(slog.Default(), task.Job{ID: "job-1", Bucket: "temporary", Key: testKey}, "too long"); err != nil {
+		t.Fatalf("rejectVideo() error = %v", err)
+	}
+	if v, _ := videos.Get(testKey); v.Status != video.STATUS_PROCESSING {
+		t.Errorf("video of job-2 is %s after job-1 rejected it", v.Status)
+	}
+	if _, ok := store.Get("temporary", testKey); !ok {
+		t.Errorf("source of job-2 deleted by job-1")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/keys"
+)
+
+const (
+	DEFAULT_PREVIEW_DURATION = 3.0
+	PREVIEW_WIDTH            = 320
+
+	// Format which skips the preview
+	PREVIEW_FORMAT_NONE = "none"
+)
+
+// PreviewOptions describes the short looping clip generated for listing pages.
+// A negative Start means the segment should be picked automatically.
+type PreviewOptions struct {
+	Format   string
+	Start    float64
+	Duration float64
+}
+
+// getPreviewDefaults returns the preview options of the configuration, whose
+// segment is picked automatically.
+func getPreviewDefaults(cfg Config) PreviewOptions {
+	return PreviewOptions{
+		Format:   cfg.PreviewFormat,
+		Start:    -1,
+		Duration: cfg.PreviewDuration,
+	}
+}
+
+// getPreviewOptions returns the preview options of an upload, letting the
+// metadata on the uploaded object override the segment of the defaults.
+func getPreviewOptions(opts PreviewOptions, metadata map[string]string) PreviewOptions {
+	if opts.Duration <= 0 {
+		opts.Duration = DEFAULT_PREVIEW_DURATION
+	}
+
+	if v, ok := metadata[keys.PREVIEW_START_METADATA_KEY]; ok {
+		if s, err := strconv.ParseFloat(v, 64); err == nil && s >= 0 {
+			opts.Start = s
+		}
+	}
+
+	if v, ok := metadata[keys.PREVIEW_DURATION_METADATA_KEY]; ok {
+		if d, err := strconv.ParseFloat(v, 64); err == nil && d > 0 {
+			opts.Duration = d
+		}
+	}
+
+	return opts
+}
+
+// pickPreviewStart returns the start of the preview segment. When no start was
+// requested, the segment is taken from a quarter into the video so that intros
+// and black frames are usually skipped.
+func pickPreviewStart(opts PreviewOptions, duration float64) float64 {
+	start := opts.Start
+	if start < 0 {
+		start = duration / 4
+	}
+
+	if start+opts.Duration > duration {
+		start = duration - opts.Duration
+	}
+
+	if start < 0 {
+		start = 0
+	}
+
+	return start
+}
+
+// generatePreview renders the preview clip for the given video into
+// outputFilePath. ffmpeg is killed when ctx is done.
+func generatePreview(ctx context.Context, logger *slog.Logger, filePath string, outputFilePath string, duration float64, opts PreviewOptions) error {
+	if err := os.MkdirAll(filepath.Dir(outputFilePath), 0755); err != nil {
+		return err
+	}
+
+	start := pickPreviewStart(opts, duration)
+
+	args := []string{
+		"-y",
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+		"-t", strconv.FormatFloat(opts.Duration, 'f', 3, 64),
+		"-i", filePath,
+		"-an",
+	}
+
+	switch opts.Format {
+	case "gif":
+		args = append(args,
+			"-vf", fmt.Sprintf("fps=10,scale=%d:-1:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse", PREVIEW_WIDTH),
+			"-loop", "0",
+		)
+	case "mp4":
+		args = append(args,
+			"-vf", fmt.Sprintf("scale=%d:-2", PREVIEW_WIDTH),
+			"-c:v", "libx264", "-b:v", "200k",
+			"-movflags", "+faststart",
+		)
+	default:
+		args = append(args,
+			"-vf", fmt.Sprintf("fps=10,scale=%d:-2", PREVIEW_WIDTH),
+			"-c:v", "libwebp", "-q:v", "60",
+			"-loop", "0",
+		)
+	}
+
+	args = append(args, outputFilePath)
+
+	logger.Debug("running ffmpeg", "args", strings.Join(args, " "))
+
+	out, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to generate preview, %v: %s", err, out)
+	}
+
+	return nil
+}
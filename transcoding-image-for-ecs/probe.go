@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// ProbeResult holds the parts of the ffprobe output the transcoder cares about.
+type ProbeResult struct {
+	Duration   float64 `json:"duration"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	VideoCodec string  `json:"video_codec"`
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// rejection is returned by probeVideo for files which aren't a video we can
+// transcode. Any other error is a failure of the probe itself, e.g. ffprobe
+// couldn't be started, and is worth retrying.
+type rejection struct {
+	reason string
+}
+
+func (r *rejection) Error() string {
+	return r.reason
+}
+
+// rejectionReason returns the reason to reject the video for if err is a
+// rejection, or an empty string otherwise.
+func rejectionReason(err error) string {
+	var r *rejection
+	if errors.As(err, &r) {
+		return r.reason
+	}
+	return ""
+}
+
+// probeVideo runs ffprobe against the file and returns the properties of its
+// first video stream. Files ffprobe can't read, or which don't have a video
+// stream, are reported as a rejection.
+func probeVideo(ctx context.Context, filePath string) (*ProbeResult, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json",
+		"-show_format", "-show_streams", filePath).Output()
+	if err != nil {
+		// ffprobe is killed when ctx is done, which says nothing of the file
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, &rejection{fmt.Sprintf("ffprobe could not read the file, %v", err)}
+		}
+		return nil, fmt.Errorf("failed to run ffprobe, %v", err)
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, &rejection{fmt.Sprintf("failed to parse ffprobe output, %v", err)}
+	}
+
+	result := &ProbeResult{}
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "video" {
+			result.VideoCodec = stream.CodecName
+			result.Width = stream.Width
+			result.Height = stream.Height
+			break
+		}
+	}
+
+	if result.VideoCodec == "" {
+		return nil, &rejection{"file has no video stream"}
+	}
+
+	duration, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil {
+		return nil, &rejection{"file has no readable duration"}
+	}
+	result.Duration = duration
+
+	return result, nil
+}
+
+// ValidationLimits are the limits an upload has to satisfy to be transcoded.
+// A zero value disables the corresponding check.
+type ValidationLimits struct {
+	MaxDuration float64
+	MaxWidth    int
+	MaxHeight   int
+}
+
+func getValidationLimits(cfg Config) ValidationLimits {
+	return ValidationLimits{
+		MaxDuration: cfg.MaxDurationSeconds,
+		MaxWidth:    cfg.MaxWidth,
+		MaxHeight:   cfg.MaxHeight,
+	}
+}
+
+// validateVideo checks the probed video against the limits and returns the
+// reason for rejecting it, or an empty string if the video is acceptable.
+func validateVideo(probe *ProbeResult, limits ValidationLimits) string {
+	if probe.Duration <= 0 {
+		return "video has no duration"
+	}
+
+	if limits.MaxDuration > 0 && probe.Duration > limits.MaxDuration {
+		return fmt.Sprintf("video is %.0f seconds long, the limit is %.0f seconds", probe.Duration, limits.MaxDuration)
+	}
+
+	if limits.MaxWidth > 0 && probe.Width > limits.MaxWidth {
+		return fmt.Sprintf("video width %d exceeds the limit of %d", probe.Width, limits.MaxWidth)
+	}
+
+	if limits.MaxHeight > 0 && probe.Height > limits.MaxHeight {
+		return fmt.Sprintf("video height %d exceeds the limit of %d", probe.Height, limits.MaxHeight)
+	}
+
+	return ""
+}
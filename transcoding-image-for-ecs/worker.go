@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+)
+
+// How long the least urgent queue is long-polled for a job
+const WORKER_POLL_WAIT = 20 * time.Second
+
+// Worker transcodes the jobs of the queue one after another. It is run as an
+// ECS service scaled on the depth of the queue, instead of the job
+// dispatcher starting a task for every job.
+type Worker struct {
+	transcoder *Transcoder
+	videos     video.VideoRepository
+	queues     queue.Queues
+	failures   *task.FailureRecorder
+
+	// ARN of the ECS task the worker runs in, recorded on the videos it
+	// works on so the stuck job reaper can check on it
+	taskArn string
+}
+
+func runWorker(sess *session.Session, t *Transcoder, queueURLs []string, policy task.RetryPolicy, taskArn string) {
+	queues := queue.NewSQSQueues(sqs.New(sess), queueURLs)
+
+	w := &Worker{
+		transcoder: t,
+		videos:     t.videos,
+		queues:     queues,
+		failures: &task.FailureRecorder{
+			Videos:      t.videos,
+			DeadLetters: video.NewDynamoDeadLetterRepository(dynamodb.New(sess)),
+			Queues:      queues,
+			Policy:      policy,
+			Events:      t.events,
+		},
+		taskArn: taskArn,
+	}
+
+	// ECS sends SIGTERM when the service scales in or is redeployed
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	slog.Info("worker started", "queues", len(queues))
+	w.Run(ctx)
+	slog.Info("worker stopped")
+}
+
+// Run handles jobs until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		q, msg, err := w.receive()
+		if err != nil {
+			slog.Error("failed to receive job", logging.ERROR, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		if msg == nil {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			if err := q.Release(*msg); err != nil {
+				slog.Error("failed to release job", logging.VIDEO_KEY, msg.Job.Key, logging.JOB_ID, msg.Job.ID, logging.ERROR, err)
+			}
+			return
+		}
+
+		w.handle(ctx, q, *msg)
+	}
+}
+
+// receive returns the next job of the most urgent queue which has one. Only
+// the least urgent queue is long-polled, the others are checked before
+// every poll.
+func (w *Worker) receive() (queue.Queue, *queue.Message, error) {
+	for i, q := range w.queues {
+		wait := time.Duration(0)
+		if i == len(w.queues)-1 {
+			wait = WORKER_POLL_WAIT
+		}
+
+		messages, err := q.Receive(1, wait)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(messages) > 0 {
+			return q, &messages[0], nil
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// handle claims the job's attempt and transcodes the video. A job cut short
+// by ctx is handed back to the queue, other failures are recorded the way
+// the task state change lambda does for failed tasks.
+func (w *Worker) handle(ctx context.Context, q queue.Queue, msg queue.Message) {
+	job := msg.Job
+	logger := slog.With(logging.VIDEO_KEY, job.Key, logging.JOB_ID, job.ID, logging.ATTEMPT, job.Attempt)
+
+	v, err := w.videos.Get(job.Key)
+	if err == video.ErrNotFound {
+		logger.Warn("video not found, dropping its job")
+		w.delete(logger, q, msg)
+		return
+	}
+	if err != nil {
+		// Left in the queue, it is received again after the visibility
+		// timeout
+		logger.Error("failed to get video", logging.ERROR, err)
+		return
+	}
+
+	err = w.videos.Update(job.Key, video.Update{
+		ClaimAttempt: job.Attempt,
+		JobID:        job.ID,
+		HeartbeatAt:  time.Now().UTC().Format(time.RFC3339),
+	})
+	if err == video.ErrInvalidTransition {
+		logger.Warn("video moved on, dropping attempt", "status", v.Status)
+		w.delete(logger, q, msg)
+		return
+	}
+	if err != nil {
+		logger.Error("failed to claim attempt", logging.ERROR, err)
+		return
+	}
+
+	err = w.videos.Update(job.Key, video.Update{
+		TaskArn:     w.taskArn,
+		HeartbeatAt: time.Now().UTC().Format(time.RFC3339),
+		ForJob:      job.ID,
+	})
+	if err != nil {
+		logger.Error("failed to record worker", logging.ERROR, err)
+	}
+
+	// The video tracks the job from here on, if the worker dies the stuck
+	// job reaper notices the missing heartbeat
+	w.delete(logger, q, msg)
+
+	logger.Info("started attempt")
+
+	err = w.transcoder.Transcode(ctx, task.Job{
+		ID:       job.ID,
+		Bucket:   job.Bucket,
+		Key:      job.Key,
+		Profiles: job.Profiles,
+		Version:  job.Version,
+
+		TraceParent: job.TraceParent,
+	})
+	if err == nil {
+		return
+	}
+
+	// The stuck job reaper gave up on the job, the video belongs to the
+	// attempt it queued
+	if err == errSuperseded {
+		return
+	}
+
+	if ctx.Err() != nil {
+		w.release(logger, job)
+		return
+	}
+
+	v.TaskArn = w.taskArn
+	v.JobID = job.ID
+	if err := w.failures.Record(*v, job.Attempt, err.Error()); err != nil {
+		logger.Error("failed to record failure", logging.ERROR, err)
+	}
+}
+
+// release hands the job back to the queue without using up its attempt, so
+// another worker picks it up where this one stopped.
+func (w *Worker) release(logger *slog.Logger, job queue.Job) {
+	err := w.videos.Update(job.Key, video.Update{
+		Status:         video.STATUS_QUEUED,
+		ReleaseAttempt: job.Attempt,
+		NextRetryAt:    time.Now().UTC().Format(time.RFC3339),
+		ForJob:         job.ID,
+	})
+	if err == video.ErrInvalidTransition {
+		logger.Warn("video moved on while shutting down, not releasing it")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to release video", logging.ERROR, err)
+		return
+	}
+
+	if err := w.queues.For(job.Priority).Enqueue(job, 0); err != nil {
+		logger.Error("failed to enqueue released job", logging.ERROR, err)
+		return
+	}
+
+	logger.Info("released attempt")
+}
+
+func (w *Worker) delete(logger *slog.Logger, q queue.Queue, msg queue.Message) {
+	if err := q.Delete(msg); err != nil {
+		logger.Error("failed to delete job", logging.ERROR, err)
+	}
+}
+
+// getTaskArn reads the ARN of the ECS task the worker runs in from the task
+// metadata endpoint. It returns an empty string when not running on ECS.
+func getTaskArn() string {
+	uri := os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+	if uri == "" {
+		return ""
+	}
+
+	client := http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(uri + "/task")
+	if err != nil {
+		slog.Error("failed to read task metadata", logging.ERROR, err)
+		return ""
+	}
+	defer resp.Body.Close()
+
+	var metadata struct {
+		TaskARN string `json:"TaskARN"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		slog.Error("failed to decode task metadata", logging.ERROR, err)
+		return ""
+	}
+
+	return metadata.TaskARN
+}
@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/eventbus"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/keys"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/queue"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/tracing"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+	"github.com/thegeorgenikhil/video-transcoding-service/videoevents"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type EventDetail struct {
@@ -36,104 +47,270 @@ type Object struct {
 	Sequencer string `json:"sequencer"`
 }
 
+type Config struct {
+	config.AWS
+	Metrics       metrics.LambdaConfig
+	Tracing       tracing.Config
+	Events        eventbus.Config
+	QueueURLs     []string `env:"JOB_QUEUE_URLS" required:"true"`
+	MaxUploadSize int64    `env:"MAX_UPLOAD_SIZE_BYTES" min:"0"`
+}
+
 type App struct {
-	ecsCl    *ecs.ECS
-	dynamoCl *dynamodb.DynamoDB
+	videos video.VideoRepository
+	s3Cl   *s3.S3
+	queues queue.Queues
+	events eventbus.Publisher
+
+	// Limit enforced before a job is queued. Duration and resolution can
+	// only be checked by the transcoder, the task config passes them on.
+	maxUploadSize int64
 }
 
 func main() {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("ap-south-1"),
-	})
+	logging.Setup("upload-event-handle-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("upload-event-handle-lambda", cfg.Metrics.Config())
+	tracing.Setup("upload-event-handle-lambda", cfg.Tracing)
+
+	sess, err := cfg.Session()
 	if err != nil {
-		fmt.Println("Error creating session", err)
-		return
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	publisher, err := eventbus.New(sess, "upload-event-handle-lambda", cfg.Events)
+	if err != nil {
+		logging.Fatal("invalid events configuration", err)
 	}
 
-	ecsClient := ecs.New(sess)
 	dynamoClient := dynamodb.New(sess)
+	s3Client := s3.New(sess)
 
 	app := App{
-		ecsCl:    ecsClient,
-		dynamoCl: dynamoClient,
+		videos:        video.NewDynamoRepository(dynamoClient),
+		s3Cl:          s3Client,
+		queues:        queue.NewSQSQueues(sqs.New(sess), cfg.QueueURLs),
+		events:        publisher,
+		maxUploadSize: cfg.MaxUploadSize,
 	}
 
 	lambda.Start(app.HandleRequest)
 }
 
-func (app *App) HandleRequest(event events.EventBridgeEvent) {
+// HandleRequest checks an upload and queues the job for it. Errors reading
+// the upload or writing the video are returned, so Lambda retries the event.
+func (app *App) HandleRequest(ctx context.Context, event events.EventBridgeEvent) error {
+	logger := logging.FromLambda(ctx)
+	defer tracing.Flush()
+
 	var detail EventDetail
 	err := json.Unmarshal(event.Detail, &detail)
 	if err != nil {
-		fmt.Println("Error unmarshalling event detail", err)
-		return
-	}
-
-	_, err = app.dynamoCl.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("Videos"),
-		Item: map[string]*dynamodb.AttributeValue{
-			"Key": {
-				S: aws.String(detail.Object.Key),
-			},
-			"UploadedAt": {
-				S: aws.String(time.Now().Format(time.RFC3339)),
-			},
-			"Status": {
-				S: aws.String("uploaded"),
-			},
-		},
-	})
+		logger.Error("failed to unmarshal event detail", logging.ERROR, err)
+		return nil
+	}
+
+	logger = logger.With(logging.VIDEO_KEY, detail.Object.Key, "event_id", event.ID)
+	logger.Info("received upload", "bucket", detail.Bucket.Name, "size", detail.Object.Size)
+
+	v := video.Video{
+		Key:        detail.Object.Key,
+		UploadedAt: time.Now().Format(time.RFC3339),
+		Status:     video.STATUS_UPLOADED,
+		EventID:    event.ID,
+		ETag:       detail.Object.ETag,
+		Sequencer:  detail.Object.Sequencer,
+
+		SourceBucket: detail.Bucket.Name,
+	}
+
+	// EventBridge may deliver the same event more than once, only the first
+	// delivery gets to create the video and queue a job for it. A retry of
+	// an event which failed before its job was enqueued carries on where it
+	// stopped.
+	var retried *video.Video
+	err = app.videos.Create(v)
+	if err == video.ErrDuplicate {
+		retried = app.retryOf(v)
+		if retried == nil {
+			logger.Info("ignoring duplicate event")
+			return nil
+		}
+
+		logger.Info("retrying event", "status", retried.Status)
+		err = nil
+	}
 	if err != nil {
-		log.Fatal("Error putting item in DynamoDB", err)
-		return
-	}
-
-	_, err = app.ecsCl.RunTask(&ecs.RunTaskInput{
-		Cluster:        aws.String(""), //TODO: get from environment
-		TaskDefinition: aws.String(""), //TODO: get from environment
-		LaunchType:     aws.String("FARGATE"),
-		Count:          aws.Int64(1),
-		NetworkConfiguration: &ecs.NetworkConfiguration{
-			AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
-				AssignPublicIp: aws.String("ENABLED"),
-				Subnets: []*string{
-					aws.String(""), //TODO: get from environment
-					aws.String(""), //TODO: get from environment
-					aws.String(""), //TODO: get from environment
-				},
-			},
-		},
-		Overrides: &ecs.TaskOverride{
-			ContainerOverrides: []*ecs.ContainerOverride{
-				{
-					Name: aws.String("video-transcoding-image"),
-					Environment: []*ecs.KeyValuePair{
-						{
-							Name:  aws.String("TEMPORARY_BUCKET_NAME"),
-							Value: aws.String(detail.Bucket.Name),
-						},
-						{
-							Name:  aws.String("OUTPUT_BUCKET_NAME"),
-							Value: aws.String(""), //TODO: get from environment
-						},
-						{
-							Name:  aws.String("BUCKET_REGION"),
-							Value: aws.String("ap-south-1"),
-						},
-						{
-							Name:  aws.String("OBJECT_KEY"),
-							Value: aws.String(detail.Object.Key),
-						},
-					},
-				},
-			},
-		},
-	})
+		logger.Error("failed to put item in DynamoDB", logging.ERROR, err)
+		return err
+	}
+
+	validated := logging.Stage(logger, "validate")
+	validateStart := time.Now()
+	reason, metadata, err := app.validateUpload(detail)
 
+	uploaded := videoevents.VideoUploaded{
+		VideoKey: detail.Object.Key,
+		Bucket:   detail.Bucket.Name,
+		Size:     int64(detail.Object.Size),
+	}
+
+	tenant := aws.StringValue(metadata[keys.TENANT_METADATA_KEY])
+	if tenant == "" {
+		tenant = video.DEFAULT_TENANT
+	}
+
+	// The class picks the queue the job waits in, and the size and capacity
+	// provider of the task the dispatcher starts for it
+	class := task.ClassOrDefault(aws.StringValue(metadata[keys.CLASS_METADATA_KEY]))
+
+	// The video stays uploaded and the event is retried. Should the retries
+	// run out, the stuck job reaper queues the video without these checks,
+	// the transcoder still probes it before transcoding.
 	if err != nil {
-		fmt.Println("Error running task", err)
-		return
+		logger.Error("failed to validate upload", logging.ERROR, err)
+		metrics.CountFailure("validate")
+		return fmt.Errorf("failed to validate upload, %v", err)
 	}
 
-	fmt.Println("Received event for object", detail.Object.Key)
+	uploaded.Tenant = tenant
+	uploaded.Class = class.Name
+
+	// Set along with the first status change, so the webhook-lambda
+	// notifies the uploader of it
+	callbackURL := aws.StringValue(metadata[keys.CALLBACK_URL_METADATA_KEY])
+
+	if reason != "" {
+		err = app.videos.Update(detail.Object.Key, video.Update{
+			Status:          video.STATUS_REJECTED,
+			RejectionReason: reason,
+			CallbackURL:     callbackURL,
+			From:            []video.Status{video.STATUS_UPLOADED},
+		})
+		if err == video.ErrInvalidTransition {
+			logger.Info("ignoring duplicate event")
+			return nil
+		}
+		if err != nil {
+			logger.Error("failed to mark video as rejected", logging.ERROR, err)
+			return err
+		}
+	}
+
+	validated("rejection_reason", reason)
+
+	// The trace started by the upload Lambda, when the upload has one
+	ctx = tracing.Extract(ctx, aws.StringValue(metadata[tracing.TRACEPARENT_METADATA_KEY]))
+	ctx, span := tracing.StartAt(ctx, "handle_upload", validateStart, tracing.VIDEO_KEY.String(detail.Object.Key))
+	defer span.End()
+	logger = logging.WithTrace(logger, ctx)
+
+	if reason != "" {
+		logger.Info("rejected upload", "reason", reason)
+		span.SetAttributes(attribute.String("video.rejection_reason", reason))
+		metrics.CountFailure("rejected")
+
+		eventbus.Publish(ctx, app.events, logger, uploaded)
+		eventbus.Publish(ctx, app.events, logger, videoevents.TranscodeFailed{
+			VideoKey: detail.Object.Key,
+			Reason:   videoevents.REASON_REJECTED,
+			Message:  reason,
+		})
+
+		_, err = app.s3Cl.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(detail.Bucket.Name),
+			Key:    aws.String(detail.Object.Key),
+		})
+		if err != nil {
+			logger.Error("failed to delete rejected object", logging.ERROR, err)
+		}
+		return nil
+	}
+
+	// A retry of an event which queued the video may not have got to
+	// enqueue its job. Should it have, the attempt is claimed by the first
+	// of the two jobs and the other one is dropped.
+	if retried == nil || retried.Status != video.STATUS_QUEUED {
+		err = app.videos.Update(detail.Object.Key, video.Update{
+			Status:      video.STATUS_QUEUED,
+			Tenant:      tenant,
+			Class:       class.Name,
+			Priority:    class.Priority,
+			CallbackURL: callbackURL,
+			From:        []video.Status{video.STATUS_UPLOADED},
+		})
+		if err == video.ErrInvalidTransition {
+			logger.Info("ignoring duplicate event")
+			return nil
+		}
+		if err != nil {
+			logger.Error("failed to queue video", logging.ERROR, err)
+			tracing.Fail(span, err)
+			return err
+		}
+	}
+
+	eventbus.Publish(ctx, app.events, logger, uploaded)
+
+	// The dispatcher starts a task for the job once there is capacity for it
+	job := queue.Job{
+		ID:       queue.NewJobID(),
+		Key:      detail.Object.Key,
+		Bucket:   detail.Bucket.Name,
+		Tenant:   tenant,
+		Class:    class.Name,
+		Priority: class.Priority,
+		Attempt:  1,
+
+		TraceParent: tracing.Inject(ctx),
+	}
+	err = app.queues.For(job.Priority).Enqueue(job, 0)
+	if err != nil {
+		logger.Error("failed to enqueue job", logging.JOB_ID, job.ID, logging.ERROR, err)
+		metrics.CountFailure("queue")
+		tracing.Fail(span, err)
+
+		failureReason := fmt.Sprintf("failed to queue the job, %v", err)
+		err = app.videos.Update(detail.Object.Key, video.Update{
+			Status:        video.STATUS_FAILED,
+			FailureReason: failureReason,
+		})
+		if err != nil {
+			logger.Error("failed to mark video as failed", logging.ERROR, err)
+			return err
+		}
+
+		eventbus.Publish(ctx, app.events, logger, videoevents.TranscodeFailed{
+			VideoKey: detail.Object.Key,
+			JobID:    job.ID,
+			Reason:   videoevents.REASON_QUEUE,
+			Message:  failureReason,
+		})
+		return nil
+	}
+
+	logger.Info("queued job", logging.JOB_ID, job.ID, "tenant", tenant, "class", class.Name)
+	return nil
+}
+
+// retryOf returns the video created by an earlier delivery of the event of
+// v, when that delivery failed before the video's job was enqueued: the video
+// is still uploaded, or queued without an attempt claimed by a job. It
+// returns nil otherwise.
+func (app *App) retryOf(v video.Video) *video.Video {
+	existing, err := app.videos.Get(v.Key)
+	if err != nil || existing.EventID != v.EventID {
+		return nil
+	}
+
+	switch {
+	case existing.Status == video.STATUS_UPLOADED:
+		return existing
+	case existing.Status == video.STATUS_QUEUED && existing.Attempts == 0:
+		return existing
+	default:
+		return nil
+	}
 }
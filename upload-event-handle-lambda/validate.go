@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Number of bytes read from the start of the object to detect its type
+const SNIFF_LENGTH = 64
+
+// Signature identifies a container format by the bytes found at Offset.
+type Signature struct {
+	Format string
+	Offset int
+	Magic  []byte
+}
+
+var videoSignatures = []Signature{
+	{Format: "mp4/mov", Offset: 4, Magic: []byte("ftyp")},
+	{Format: "mov", Offset: 4, Magic: []byte("moov")},
+	{Format: "mov", Offset: 4, Magic: []byte("mdat")},
+	{Format: "mov", Offset: 4, Magic: []byte("wide")},
+	{Format: "mkv/webm", Offset: 0, Magic: []byte{0x1A, 0x45, 0xDF, 0xA3}},
+	{Format: "avi", Offset: 8, Magic: []byte("AVI ")},
+	{Format: "flv", Offset: 0, Magic: []byte("FLV")},
+	{Format: "wmv", Offset: 0, Magic: []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}},
+	{Format: "mpeg-ps", Offset: 0, Magic: []byte{0x00, 0x00, 0x01, 0xBA}},
+	{Format: "mpeg", Offset: 0, Magic: []byte{0x00, 0x00, 0x01, 0xB3}},
+	{Format: "ogg", Offset: 0, Magic: []byte("OggS")},
+}
+
+// sniffVideoFormat returns the container format matching the header, or an
+// empty string if the header doesn't look like a supported video.
+func sniffVideoFormat(header []byte) string {
+	for _, sig := range videoSignatures {
+		end := sig.Offset + len(sig.Magic)
+		if len(header) >= end && bytes.Equal(header[sig.Offset:end], sig.Magic) {
+			return sig.Format
+		}
+	}
+
+	// MPEG transport streams have a sync byte every 188 bytes, so the
+	// first one is all we can check in the sniffed header.
+	if len(header) > 0 && header[0] == 0x47 && len(header) >= SNIFF_LENGTH {
+		return "mpeg-ts"
+	}
+
+	return ""
+}
+
+// validateUpload checks the uploaded object against the configured limits
+// and its magic bytes. It returns the reason for rejecting the object, or an
+// empty string if it should be transcoded, along with the object metadata.
+func (app *App) validateUpload(detail EventDetail) (string, map[string]*string, error) {
+	if detail.Object.Size == 0 {
+		return app.rejectUnread(detail, "file is empty")
+	}
+
+	if app.maxUploadSize > 0 && int64(detail.Object.Size) > app.maxUploadSize {
+		return app.rejectUnread(detail, fmt.Sprintf("file is %d bytes, the limit is %d bytes", detail.Object.Size, app.maxUploadSize))
+	}
+
+	output, err := app.s3Cl.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(detail.Bucket.Name),
+		Key:    aws.String(detail.Object.Key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", SNIFF_LENGTH-1)),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	defer output.Body.Close()
+
+	header, err := io.ReadAll(output.Body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if sniffVideoFormat(header) == "" {
+		return "file is not a supported video format", output.Metadata, nil
+	}
+
+	return "", output.Metadata, nil
+}
+
+// rejectUnread rejects the object without reading it. Its metadata is still
+// returned, it holds the callback URL the rejection is sent to.
+func (app *App) rejectUnread(detail EventDetail, reason string) (string, map[string]*string, error) {
+	output, err := app.s3Cl.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(detail.Bucket.Name),
+		Key:    aws.String(detail.Object.Key),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return reason, output.Metadata, nil
+}
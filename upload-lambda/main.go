@@ -1,36 +1,75 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/google/uuid"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/keys"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/task"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/tracing"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/webhook"
 )
 
 const (
-	REGION      = "ap-south-1"
-	BUCKET_NAME = "video-transcoding-temp"
+	MAX_PREVIEW_DURATION = 10.0
 
-	EXPIRY_IN_MINUTES = 60 * time.Minute
+	MAX_TENANT_LENGTH = 64
 )
 
+type Config struct {
+	config.AWS
+	Metrics     metrics.LambdaConfig
+	Tracing     tracing.Config
+	AccessToken string `env:"UPLOAD_LAMBDA_ACCESS_TOKEN" required:"true"`
+
+	// Bucket the videos are uploaded to, and how long the pre-signed URLs
+	// are valid for
+	BucketName string        `env:"TEMPORARY_BUCKET_NAME" default:"video-transcoding-temp"`
+	URLExpiry  time.Duration `env:"UPLOAD_URL_EXPIRY_MINUTES" default:"60" unit:"minutes" min:"1"`
+}
+
 type RequestBody struct {
 	AccessToken string `json:"access_token"`
 	FileName    string `json:"file_name"`
+
+	// Optional segment used for the preview clip, in seconds. When not set
+	// the transcoder picks the segment itself.
+	PreviewStart    *float64 `json:"preview_start,omitempty"`
+	PreviewDuration *float64 `json:"preview_duration,omitempty"`
+
+	// Optional tenant the video is uploaded for. Jobs of different tenants
+	// take turns when tasks are started, so one tenant's bulk upload doesn't
+	// hold up everyone else.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Optional scheduling class, one of "express", "standard" or "bulk".
+	// It decides how soon the video is transcoded and by how big a task.
+	Class string `json:"class,omitempty"`
+
+	// Optional URL the status changes of the video are POSTed to, see
+	// webhook-lambda.
+	CallbackURL string `json:"callback_url,omitempty"`
 }
 
 type Response struct {
 	Key          string `json:"key"`
 	PreSignedURL string `json:"upload_url"`
+
+	// Headers that were signed into the pre-signed URL and must be sent
+	// along with the upload request.
+	UploadHeaders map[string]string `json:"upload_headers,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -38,42 +77,50 @@ type ErrorResponse struct {
 }
 
 type App struct {
-	Token    string
-	S3       *s3.S3
+	Token     string
+	S3        *s3.S3
+	Bucket    string
+	URLExpiry time.Duration
 }
 
 func main() {
-	token := os.Getenv("UPLOAD_LAMBDA_ACCESS_TOKEN")
-	if token == "" {
-		log.Fatalf("UPLOAD_LAMBDA_ACCESS_TOKEN is not set")
-	}
+	logging.Setup("upload-lambda")
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(REGION),
-	})
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("upload-lambda", cfg.Metrics.Config())
+	tracing.Setup("upload-lambda", cfg.Tracing)
+
+	sess, err := cfg.Session()
 	if err != nil {
-		log.Fatalf("failed to create AWS session, %v", err)
+		logging.Fatal("failed to create AWS session", err)
 	}
 
 	s3 := s3.New(sess)
 
-	app := App{S3: s3, Token: token}
+	app := App{S3: s3, Token: cfg.AccessToken, Bucket: cfg.BucketName, URLExpiry: cfg.URLExpiry}
 
-	lambda.Start(app.HandleRequest)
+	lambda.Start(metrics.CountRequests(app.HandleRequest))
 }
 
-func (app *App) HandleRequest(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+func (app *App) HandleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	logger := logging.FromLambda(ctx)
+
+	defer tracing.Flush()
+	ctx, span := tracing.Start(ctx, "upload")
+	defer span.End()
+
 	var reqBody RequestBody
 	err := json.Unmarshal([]byte(request.Body), &reqBody)
 	if err != nil {
-		log.Printf("failed to unmarshal request body, %v\n", err)
+		logger.Error("failed to unmarshal request body", logging.ERROR, err)
 		return nil, err
 	}
 
 	if reqBody.AccessToken == "" {
 		errResp, err := generateErrorResponse("access token is missing", 400)
 		if err != nil {
-			log.Printf("failed to generate error response, %v\n", err)
+			logger.Error("failed to generate error response", logging.ERROR, err)
 			return nil, err
 		}
 
@@ -83,7 +130,7 @@ func (app *App) HandleRequest(request events.APIGatewayProxyRequest) (*events.AP
 	if reqBody.AccessToken != app.Token {
 		errResp, err := generateErrorResponse("invalid access token", 401)
 		if err != nil {
-			log.Printf("failed to generate error response, %v\n", err)
+			logger.Error("failed to generate error response", logging.ERROR, err)
 			return nil, err
 		}
 
@@ -93,34 +140,111 @@ func (app *App) HandleRequest(request events.APIGatewayProxyRequest) (*events.AP
 	if reqBody.FileName == "" {
 		errResp, err := generateErrorResponse("file name is missing", 400)
 		if err != nil {
-			log.Printf("failed to generate error response, %v\n", err)
+			logger.Error("failed to generate error response", logging.ERROR, err)
 			return nil, err
 		}
 
 		return errResp, nil
 	}
 
-	info := strings.Split(reqBody.FileName, ".")
-	fileName := info[0]
-	exts := info[1]
-
-	uuid, err := uuid.NewV7()
+	videoID, err := keys.NewVideoID()
 	if err != nil {
-		log.Printf("failed to generate UUID, %v\n", err)
+		logger.Error("failed to generate video ID", logging.ERROR, err)
 		return nil, err
 	}
 
-	key := fmt.Sprintf("%s-%s.%s", fileName, uuid, exts)
+	key := keys.SourceKey(videoID, reqBody.FileName)
+	logger = logging.WithTrace(logger.With(logging.VIDEO_KEY, key), ctx)
+	span.SetAttributes(tracing.VIDEO_KEY.String(key))
+
+	metadata := map[string]*string{}
+
+	// The trace of the video goes on from the upload event, which only has
+	// the object to go by
+	if traceparent := tracing.Inject(ctx); traceparent != "" {
+		metadata[tracing.TRACEPARENT_METADATA_KEY] = aws.String(traceparent)
+	}
+	if reqBody.PreviewStart != nil {
+		if *reqBody.PreviewStart < 0 {
+			errResp, err := generateErrorResponse("preview start must not be negative", 400)
+			if err != nil {
+				logger.Error("failed to generate error response", logging.ERROR, err)
+				return nil, err
+			}
+
+			return errResp, nil
+		}
+
+		metadata[keys.PREVIEW_START_METADATA_KEY] = aws.String(strconv.FormatFloat(*reqBody.PreviewStart, 'f', -1, 64))
+	}
+
+	if reqBody.PreviewDuration != nil {
+		if *reqBody.PreviewDuration <= 0 || *reqBody.PreviewDuration > MAX_PREVIEW_DURATION {
+			errResp, err := generateErrorResponse(fmt.Sprintf("preview duration must be between 0 and %v seconds", MAX_PREVIEW_DURATION), 400)
+			if err != nil {
+				logger.Error("failed to generate error response", logging.ERROR, err)
+				return nil, err
+			}
+
+			return errResp, nil
+		}
+
+		metadata[keys.PREVIEW_DURATION_METADATA_KEY] = aws.String(strconv.FormatFloat(*reqBody.PreviewDuration, 'f', -1, 64))
+	}
 
-	url, err := app.GetPresignedUploadURL(key)
+	if reqBody.Tenant != "" {
+		if len(reqBody.Tenant) > MAX_TENANT_LENGTH {
+			errResp, err := generateErrorResponse(fmt.Sprintf("tenant must be at most %d characters", MAX_TENANT_LENGTH), 400)
+			if err != nil {
+				logger.Error("failed to generate error response", logging.ERROR, err)
+				return nil, err
+			}
+
+			return errResp, nil
+		}
+
+		metadata[keys.TENANT_METADATA_KEY] = aws.String(reqBody.Tenant)
+	}
+
+	if reqBody.Class != "" {
+		if _, ok := task.GetClass(reqBody.Class); !ok {
+			errResp, err := generateErrorResponse(fmt.Sprintf("class must be one of %s", strings.Join(task.ClassNames(), ", ")), 400)
+			if err != nil {
+				logger.Error("failed to generate error response", logging.ERROR, err)
+				return nil, err
+			}
+
+			return errResp, nil
+		}
+
+		metadata[keys.CLASS_METADATA_KEY] = aws.String(reqBody.Class)
+	}
+
+	if reqBody.CallbackURL != "" {
+		if err := webhook.ValidateCallbackURL(reqBody.CallbackURL); err != nil {
+			errResp, err := generateErrorResponse(err.Error(), 400)
+			if err != nil {
+				logger.Error("failed to generate error response", logging.ERROR, err)
+				return nil, err
+			}
+
+			return errResp, nil
+		}
+
+		metadata[keys.CALLBACK_URL_METADATA_KEY] = aws.String(reqBody.CallbackURL)
+	}
+
+	url, headers, err := app.GetPresignedUploadURL(key, metadata)
 	if err != nil {
-		log.Printf("failed to get presigned URL, %v\n", err)
+		logger.Error("failed to get presigned URL", logging.ERROR, err)
 		return nil, err
 	}
 
-	resp, err := json.Marshal(Response{Key: key, PreSignedURL: url})
+	logger.Info("issued upload URL", "tenant", reqBody.Tenant, "class", reqBody.Class)
+
+	resp, err := json.Marshal(Response{Key: key, PreSignedURL: url, UploadHeaders: headers})
 	if err != nil {
-		log.Printf("failed to marshal response, %v\n", err)
+		logger.Error("failed to marshal response", logging.ERROR, err)
 		return nil, err
 	}
 
@@ -130,26 +254,43 @@ func (app *App) HandleRequest(request events.APIGatewayProxyRequest) (*events.AP
 	}, nil
 }
 
-func (app *App) GetPresignedUploadURL(key string) (string, error) {
-	req, _ := app.S3.PutObjectRequest(&s3.PutObjectInput{
-		Bucket: aws.String(BUCKET_NAME),
+// GetPresignedUploadURL returns a pre-signed URL for uploading the object
+// along with the headers the client has to send with it. Metadata ends up
+// in the signed headers, so it can't be changed by the client.
+func (app *App) GetPresignedUploadURL(key string, metadata map[string]*string) (string, map[string]string, error) {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(app.Bucket),
 		Key:    aws.String(key),
-	})
+	}
 
-	url, err := req.Presign(EXPIRY_IN_MINUTES)
+	if len(metadata) > 0 {
+		input.Metadata = metadata
+	}
 
+	req, _ := app.S3.PutObjectRequest(input)
+
+	url, signedHeaders, err := req.PresignRequest(app.URLExpiry)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+
+	headers := map[string]string{}
+	for name := range signedHeaders {
+		if name == "Host" {
+			continue
+		}
+
+		headers[name] = signedHeaders.Get(name)
 	}
 
-	return url, nil
+	return url, headers, nil
 }
 
 func generateErrorResponse(msg string, status int) (*events.APIGatewayProxyResponse, error) {
 	errMsg := ErrorResponse{Message: msg}
 	body, err := json.Marshal(errMsg)
 	if err != nil {
-		log.Printf("failed to marshal error response, %v\n", err)
+		slog.Error("failed to marshal error response", logging.ERROR, err)
 		return nil, err
 	}
 
@@ -0,0 +1,3 @@
+module github.com/thegeorgenikhil/video-transcoding-service/videoevents
+
+go 1.21.6
@@ -0,0 +1,235 @@
+// Package videoevents defines the domain events the video transcoding
+// service publishes to EventBridge or SNS, for services reacting to the
+// videos it transcodes. It has no dependencies, import it to decode them:
+//
+//	var e videoevents.Envelope
+//	if err := json.Unmarshal(body, &e); err != nil { ... }
+//
+//	event, err := e.Decode()
+//	switch event := event.(type) {
+//	case *videoevents.TranscodeCompleted:
+//		...
+//	}
+//
+// Every event is wrapped in an Envelope. On EventBridge the envelope is the
+// detail of the event, its detail-type is the type of the event and its
+// source EVENTS_SOURCE, "video-transcoding-service" by default. On SNS the
+// envelope is the message, with the type and version as the message
+// attributes "type" and "version", so subscriptions can filter on them.
+//
+// The events of a video are published in the order they happen, but may be
+// delivered more than once and out of order. The ID of the envelope tells
+// deliveries of the same event apart.
+//
+// # Versions
+//
+// Each event type has a version of its own, in the envelope. Fields may be
+// added to an event without changing it; removing a field, or changing its
+// type or meaning, makes a new version. Decode refuses versions newer than
+// the ones of the package, update it to read them.
+package videoevents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Types of the events
+const (
+	VIDEO_UPLOADED      = "VideoUploaded"
+	TRANSCODE_STARTED   = "TranscodeStarted"
+	RENDITION_COMPLETED = "RenditionCompleted"
+	TRANSCODE_COMPLETED = "TranscodeCompleted"
+	TRANSCODE_FAILED    = "TranscodeFailed"
+)
+
+// Versions of the events published by this version of the package
+const (
+	VIDEO_UPLOADED_VERSION      = 1
+	TRANSCODE_STARTED_VERSION   = 1
+	RENDITION_COMPLETED_VERSION = 1
+	TRANSCODE_COMPLETED_VERSION = 1
+	TRANSCODE_FAILED_VERSION    = 1
+)
+
+// Reasons of a TranscodeFailed
+const (
+	// The upload isn't a video the service transcodes, see
+	// TranscodeFailed.Message. It isn't retried.
+	REASON_REJECTED = "rejected"
+	// The job couldn't be queued
+	REASON_QUEUE = "queue"
+	// Every attempt the retry policy allows failed
+	REASON_ATTEMPTS_EXHAUSTED = "attempts_exhausted"
+)
+
+var (
+	ErrUnknownType        = errors.New("unknown event type")
+	ErrUnsupportedVersion = errors.New("unsupported event version")
+)
+
+// Event is implemented by the events of the package.
+type Event interface {
+	EventType() string
+	EventVersion() int
+}
+
+// Envelope carries an event along with what identifies it.
+type Envelope struct {
+	// Unique ID of the event
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+
+	// Service which published the event, e.g. "transcoder"
+	Producer string `json:"producer"`
+
+	OccurredAt time.Time `json:"occurred_at"`
+
+	// The event, in the schema of Type and Version
+	Data json.RawMessage `json:"data"`
+}
+
+// NewEnvelope wraps the event.
+func NewEnvelope(id, producer string, at time.Time, event Event) (Envelope, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		ID:         id,
+		Type:       event.EventType(),
+		Version:    event.EventVersion(),
+		Producer:   producer,
+		OccurredAt: at.UTC(),
+		Data:       data,
+	}, nil
+}
+
+// Decode returns the event of the envelope, a pointer to one of the events
+// of the package. It returns ErrUnknownType for types added after this
+// version of the package, which consumers can skip.
+func (e Envelope) Decode() (Event, error) {
+	var event Event
+	switch e.Type {
+	case VIDEO_UPLOADED:
+		event = &VideoUploaded{}
+	case TRANSCODE_STARTED:
+		event = &TranscodeStarted{}
+	case RENDITION_COMPLETED:
+		event = &RenditionCompleted{}
+	case TRANSCODE_COMPLETED:
+		event = &TranscodeCompleted{}
+	case TRANSCODE_FAILED:
+		event = &TranscodeFailed{}
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownType, e.Type)
+	}
+
+	if e.Version < 1 || e.Version > event.EventVersion() {
+		return nil, fmt.Errorf("%w %d of %s", ErrUnsupportedVersion, e.Version, e.Type)
+	}
+
+	if err := json.Unmarshal(e.Data, event); err != nil {
+		return nil, fmt.Errorf("failed to decode %s, %v", e.Type, err)
+	}
+
+	return event, nil
+}
+
+// VideoUploaded is published once an upload was received and checked. An
+// upload which is rejected is followed by a TranscodeFailed, the others by a
+// TranscodeStarted once a task picks up the job.
+type VideoUploaded struct {
+	// Key of the video, which identifies it in every event and in the API
+	VideoKey string `json:"video_key"`
+
+	// Bucket the upload was received in and its size in bytes
+	Bucket string `json:"bucket"`
+	Size   int64  `json:"size"`
+
+	// Tenant the video was uploaded for, "default" when none was given, and
+	// its scheduling class: "express", "standard" or "bulk". Both are empty
+	// when the upload couldn't be read.
+	Tenant string `json:"tenant,omitempty"`
+	Class  string `json:"class,omitempty"`
+}
+
+func (VideoUploaded) EventType() string { return VIDEO_UPLOADED }
+func (VideoUploaded) EventVersion() int { return VIDEO_UPLOADED_VERSION }
+
+// TranscodeStarted is published when a transcoding task starts working on
+// the job of a video. A job whose task fails is started again while it has
+// attempts left.
+type TranscodeStarted struct {
+	VideoKey string `json:"video_key"`
+
+	// ID of the job, shared by the events of the same attempt
+	JobID string `json:"job_id,omitempty"`
+
+	// Renditions transcoded, e.g. "720p". A re-transcode may only
+	// transcode some of them.
+	Renditions []string `json:"renditions,omitempty"`
+
+	// Version of the outputs, 1 for the first transcode of a video and
+	// higher for the re-transcodes
+	OutputVersion int `json:"output_version,omitempty"`
+}
+
+func (TranscodeStarted) EventType() string { return TRANSCODE_STARTED }
+func (TranscodeStarted) EventVersion() int { return TRANSCODE_STARTED_VERSION }
+
+// RenditionCompleted is published once a rendition was transcoded and
+// stored. Players only switch to it with the TranscodeCompleted.
+type RenditionCompleted struct {
+	VideoKey  string `json:"video_key"`
+	JobID     string `json:"job_id,omitempty"`
+	Rendition string `json:"rendition"`
+
+	// Key of the rendition in the output bucket, and its size in bytes
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+func (RenditionCompleted) EventType() string { return RENDITION_COMPLETED }
+func (RenditionCompleted) EventVersion() int { return RENDITION_COMPLETED_VERSION }
+
+// TranscodeCompleted is published when the job of a video completed. The
+// video can be played from then on.
+type TranscodeCompleted struct {
+	VideoKey string `json:"video_key"`
+	JobID    string `json:"job_id,omitempty"`
+
+	// Keys of the renditions in the output bucket, by rendition, including
+	// the ones a re-transcode kept, and of the preview clip, if any
+	Renditions map[string]string `json:"renditions"`
+	PreviewKey string            `json:"preview_key,omitempty"`
+
+	// Time spent transcoding, in seconds
+	TranscodingSeconds float64 `json:"transcoding_seconds"`
+
+	OutputVersion int `json:"output_version,omitempty"`
+}
+
+func (TranscodeCompleted) EventType() string { return TRANSCODE_COMPLETED }
+func (TranscodeCompleted) EventVersion() int { return TRANSCODE_COMPLETED_VERSION }
+
+// TranscodeFailed is published when the job of a video is given up on. A
+// failed attempt which is retried doesn't publish it.
+type TranscodeFailed struct {
+	VideoKey string `json:"video_key"`
+	JobID    string `json:"job_id,omitempty"`
+
+	// One of the REASON_ constants, and a message for people
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+
+	// Attempts made, 0 when the job never started
+	Attempts int `json:"attempts,omitempty"`
+}
+
+func (TranscodeFailed) EventType() string { return TRANSCODE_FAILED }
+func (TranscodeFailed) EventVersion() int { return TRANSCODE_FAILED_VERSION }
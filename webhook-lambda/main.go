@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/config"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/logging"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/metrics"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/video"
+	"github.com/thegeorgenikhil/video-transcoding-service/internal/webhook"
+)
+
+// Time kept at the end of an invocation to log the deliveries, retries are
+// given up on once it is reached
+const DELIVERY_LOG_MARGIN = 5 * time.Second
+
+type Config struct {
+	config.AWS
+	Metrics metrics.LambdaConfig
+	Webhook webhook.Config
+}
+
+type App struct {
+	videos video.VideoRepository
+	sender *webhook.Sender
+}
+
+// change is a status change of a video to notify its uploader of.
+type change struct {
+	video video.Video
+	event webhook.Event
+}
+
+func main() {
+	logging.Setup("webhook-lambda")
+
+	var cfg Config
+	config.MustLoad(&cfg)
+	metrics.Setup("webhook-lambda", cfg.Metrics.Config())
+
+	sess, err := cfg.Session()
+	if err != nil {
+		logging.Fatal("failed to create AWS session", err)
+	}
+
+	app := App{
+		videos: video.NewDynamoRepository(dynamodb.New(sess)),
+		sender: webhook.NewSender(cfg.Webhook),
+	}
+
+	lambda.Start(metrics.CountInvocations(app.HandleRequest))
+}
+
+// HandleRequest follows the stream of the Videos table and POSTs every status
+// change of a video uploaded with a callback URL to it. The changes of a
+// video are sent in order, the ones of different videos at the same time.
+// A webhook which can't be delivered is logged on the video and given up on,
+// so one unreachable receiver doesn't hold up the stream.
+func (app *App) HandleRequest(ctx context.Context, event events.DynamoDBEvent) error {
+	logger := logging.FromLambda(ctx)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-DELIVERY_LOG_MARGIN))
+		defer cancel()
+	}
+
+	var keys []string
+	changes := map[string][]change{}
+	for _, record := range event.Records {
+		if record.EventName != string(events.DynamoDBOperationTypeModify) {
+			continue
+		}
+
+		old, err := video.UnmarshalStreamImage(record.Change.OldImage)
+		if err != nil {
+			logger.Error("failed to unmarshal old image", logging.ERROR, err)
+			return err
+		}
+
+		v, err := video.UnmarshalStreamImage(record.Change.NewImage)
+		if err != nil {
+			logger.Error("failed to unmarshal new image", logging.ERROR, err)
+			return err
+		}
+
+		if v.CallbackURL == "" || v.Status == old.Status {
+			continue
+		}
+
+		if _, ok := changes[v.Key]; !ok {
+			keys = append(keys, v.Key)
+		}
+
+		// The ID of the stream record stays the same when the batch is
+		// delivered again, receivers can tell the event apart by it
+		changes[v.Key] = append(changes[v.Key], change{
+			video: v,
+			event: webhook.NewEvent(record.EventID, record.Change.ApproximateCreationDateTime.Time, old, v),
+		})
+	}
+
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(changes []change) {
+			defer wg.Done()
+
+			for _, c := range changes {
+				app.deliver(ctx, logger, c)
+			}
+		}(changes[key])
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// deliver sends the webhook of the change and logs the delivery on the video.
+func (app *App) deliver(ctx context.Context, logger *slog.Logger, c change) {
+	logger = logger.With(logging.VIDEO_KEY, c.video.Key, "event_id", c.event.ID, "status", c.video.Status)
+
+	delivery := app.sender.Send(ctx, c.video.CallbackURL, c.event)
+	if delivery.Delivered {
+		logger.Info("delivered webhook", logging.ATTEMPT, delivery.Attempts, "status_code", delivery.StatusCode)
+		metrics.Put(metrics.WEBHOOK_DELIVERIES, 1, metrics.UNIT_COUNT, metrics.Dimensions{metrics.RESULT: "delivered"})
+	} else {
+		logger.Error("failed to deliver webhook", logging.ATTEMPT, delivery.Attempts, "status_code", delivery.StatusCode, logging.ERROR, delivery.Error)
+		metrics.Put(metrics.WEBHOOK_DELIVERIES, 1, metrics.UNIT_COUNT, metrics.Dimensions{metrics.RESULT: "failed"})
+	}
+
+	err := app.videos.Update(c.video.Key, video.Update{AppendDeliveries: []video.Delivery{delivery}})
+	if err == video.ErrNotFound {
+		logger.Info("video not found, dropping its delivery log")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to log delivery", logging.ERROR, err)
+	}
+}